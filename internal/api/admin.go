@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hionay/quotes/internal/auth"
+)
+
+// requireAdmin protects next with HTTP basic authentication against the
+// administrator accounts created with "quotes user add".
+func (a *API) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if ok {
+			user, err := a.userRepo.GetByUsername(r.Context(), username)
+			if err == nil && auth.CheckPassword(user.PasswordHash, password) == nil {
+				next(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="quotes admin", charset="UTF-8"`)
+		a.error(w, r, http.StatusUnauthorized, "authentication required", nil)
+	}
+}
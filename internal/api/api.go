@@ -1,56 +1,229 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"path"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/hionay/quotes/internal/cache"
 	"github.com/hionay/quotes/internal/config"
+	"github.com/hionay/quotes/internal/dedup"
 	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/events"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/qotd"
+	"github.com/hionay/quotes/internal/related"
+	"github.com/hionay/quotes/internal/render"
 	"github.com/hionay/quotes/internal/repository"
+	"github.com/hionay/quotes/internal/schedule"
+	"github.com/hionay/quotes/internal/service"
+	"github.com/hionay/quotes/internal/spam"
+	"github.com/hionay/quotes/internal/stats"
 )
 
-var tagRe = regexp.MustCompile(`<([^<]+)>`)
-
 type API struct {
 	srv       *http.Server
 	logger    *slog.Logger
 	quoteRepo domain.QuoteRepository
+	quotes    *service.QuoteService
+	comments  *service.CommentService
+	reactions *service.ReactionService
+	// collections keeps favourites and named collections of visitors.
+	collections *service.CollectionService
+	relatedRepo domain.RelatedRepository
+	userRepo    domain.UserRepository
+	qotd        *qotd.Selector
+	stats       *stats.Service
+	events      *events.Hub
+	// scheduler runs background jobs, listed on /admin/jobs with their
+	// history from jobRepo.
+	scheduler *schedule.Scheduler
+	jobRepo   domain.JobRepository
+	jobs      []schedule.Job
 	tmpl      *template.Template
+	pow       *spam.ProofOfWork
+	// classifier scores submissions; its model is saved by a background
+	// job and at shutdown.
+	classifier *spam.Classifier
+	// db tells whether the database is up, if the connection knows.
+	db availability
+
+	trustedProxies []netip.Prefix
+	// activity is when this process last changed a comment or reaction,
+	// in Unix nanoseconds, for the validators of cached pages.
+	activity atomic.Int64
+	// replicated is set when reading from replicas, a sign that other
+	// instances write to the same database.
+	replicated      bool
+	markup          render.Markup
+	pageSize        int
+	shutdownTimeout time.Duration
 }
 
-func NewAPI(cfg *config.Config, logger *slog.Logger, db repository.Connection) *API {
+// NewAPI returns the server for the database db. Quotes and statistics
+// are read from the replicas, if any.
+func NewAPI(cfg *config.Config, logger *slog.Logger, db repository.Connection, replicas ...repository.Connection) (*API, error) {
 	tmpl := template.Must(template.New("").ParseGlob("templates/*.html"))
 	api := &API{
-		logger:    logger,
-		quoteRepo: repository.NewQuoteRepository(db),
-		tmpl:      tmpl,
+		logger:          logger,
+		quoteRepo:       newQuoteRepository(cfg, db, replicas),
+		userRepo:        repository.NewUserRepository(db),
+		relatedRepo:     repository.NewRelatedRepository(db),
+		tmpl:            tmpl,
+		events:          events.NewHub(eventBuffer),
+		replicated:      len(replicas) > 0,
+		pageSize:        cfg.PageSize(),
+		shutdownTimeout: cfg.ShutdownTimeout(),
+	}
+	loc, err := time.LoadLocation(cfg.QOTDTimezone())
+	if err != nil {
+		return nil, fmt.Errorf("time.LoadLocation(%q): %w", cfg.QOTDTimezone(), err)
+	}
+	if db, ok := db.(availability); ok {
+		api.db = db
+	}
+	api.stats = stats.NewService(repository.NewQuoteRepository(db, replicas...), cfg.StatsCacheTTL())
+	api.qotd = qotd.NewSelector(api.quoteRepo, repository.NewDailyQuoteRepository(db), loc, cfg.QOTDWindowDays())
+	api.jobRepo = repository.NewJobRepository(db)
+	api.scheduler = schedule.NewScheduler(api.jobRepo, logger, loc)
+	ips, err := privacy.NewAnonymizer(privacy.Mode(cfg.IPMode()), cfg.IPHashKey())
+	if err != nil {
+		return nil, fmt.Errorf("privacy.NewAnonymizer(): %w", err)
+	}
+	api.trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies())
+	if err != nil {
+		return nil, err
+	}
+	api.markup, err = render.ParseMarkup(cfg.Markup())
+	if err != nil {
+		return nil, err
+	}
+	quoteFilter, commentFilter, err := api.submissionFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	api.jobs = api.backgroundJobs(cfg)
+	api.quotes = service.NewQuoteService(api.quoteRepo, service.Options{
+		Filter:     quoteFilter,
+		IPs:        ips,
+		Duplicates: dedup.NewIndex(repository.NewFingerprintRepository(db), repository.NewQuoteRepository(db)),
+		Location:   loc,
+		Listener:   liveUpdates{api},
+		Logger:     logger,
+	})
+	api.comments = service.NewCommentService(repository.NewCommentRepository(db), api.quoteRepo, service.Options{
+		Filter: commentFilter,
+		IPs:    ips,
+		Logger: logger,
+	})
+	reactions, err := service.ParseReactions(cfg.Reactions())
+	if err != nil {
+		return nil, err
 	}
+	api.reactions = service.NewReactionService(repository.NewReactionRepository(db), api.quoteRepo, reactions)
+	api.collections = service.NewCollectionService(repository.NewCollectionRepository(db), api.quoteRepo)
 
 	mux := http.NewServeMux()
-	mux.Handle("/", api.listHandler(api.quoteRepo.GetLatest))
-	mux.Handle("/top", api.listHandler(api.quoteRepo.GetTop))
+	mux.HandleFunc("/", api.notFoundHandler)
+	mux.Handle("/{$}", api.listHandler("", api.quotes.Latest))
+	mux.Handle("/top", api.listHandler("", api.quotes.Top))
+	mux.HandleFunc("/top/{reaction}", api.topReactionHandler)
+	mux.Handle("/on-this-day", api.listHandler("On this day", api.quotes.OnThisDay))
+	mux.HandleFunc("/archive", api.archiveHandler)
+	mux.HandleFunc("/stats", api.statsHandler)
+	mux.HandleFunc("/events", api.eventsHandler)
+	mux.HandleFunc("/archive/{year}", api.archiveHandler)
+	mux.HandleFunc("/archive/{year}/{month}", api.archiveHandler)
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 	mux.HandleFunc("/random", api.randomHandler)
+	mux.HandleFunc("GET /pow", api.powHandler)
 	mux.HandleFunc("/add", api.addQuote)
 	mux.HandleFunc("/vote", api.voteHandler)
+	mux.HandleFunc("/react", api.reactHandler)
+	mux.HandleFunc("/favourite", api.favouriteHandler)
+	mux.HandleFunc("/favourites", api.favouritesHandler)
+	mux.HandleFunc("/collections", api.collectionsHandler)
+	mux.HandleFunc("POST /collections/add", api.addToCollectionHandler)
+	mux.HandleFunc("GET /c/{slug}", api.collectionHandler)
+	mux.HandleFunc("POST /c/{slug}", api.editCollectionHandler)
+	mux.HandleFunc("/account/link", api.requireAdmin(api.linkAccountHandler))
 	mux.HandleFunc("/quote/", api.viewHandler)
+	mux.HandleFunc("POST /quote/{id}/comments", api.postCommentHandler)
+	mux.HandleFunc("/qotd", api.qotdHandler)
+	mux.HandleFunc("/qotd/history", api.qotdHistoryHandler)
+	mux.HandleFunc("/admin/qotd", api.requireAdmin(api.adminQOTDHandler))
+	mux.HandleFunc("/admin/comments", api.requireAdmin(api.adminCommentsHandler))
+	mux.HandleFunc("/admin/duplicates", api.requireAdmin(api.adminDuplicatesHandler))
+	mux.HandleFunc("/admin/jobs", api.requireAdmin(api.adminJobsHandler))
 
 	api.srv = &http.Server{
 		Addr:         ":" + strconv.Itoa(cfg.ServerPort()),
-		Handler:      mux,
-		ReadTimeout:  apiReadTimeout,
-		WriteTimeout: apiWriteTimeout,
-		IdleTimeout:  apiIdleTimeout,
+		Handler:      api.clientIPMiddleware(api.csrfMiddleware(api.visitorMiddleware(readYourWrites(mux)))),
+		ReadTimeout:  cfg.ReadTimeout(),
+		WriteTimeout: cfg.WriteTimeout(),
+		IdleTimeout:  cfg.IdleTimeout(),
 	}
-	return api
+	return api, nil
+}
+
+// availability is implemented by connections that notice when the database
+// goes down, such as repository.DB.
+type availability interface {
+	Available() bool
+}
+
+// readOnly reports whether the database is down, in which case pages come
+// from the cache and changes are refused.
+func (a *API) readOnly() bool {
+	return a.db != nil && !a.db.Available()
+}
+
+// submissionFilters returns the filters for new quotes and for comments.
+// They share the proof-of-work challenges and the classifier, and each
+// limits how often an address may submit. Duplicate quotes are left to the
+// quote service, which lets the submitter add them anyway.
+func (a *API) submissionFilters(cfg *config.Config) (quotes, comments spam.Filter, _ error) {
+	classifier, err := spam.NewClassifier(cfg.SpamModelPath(), classifierMinDocs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("spam.NewClassifier(): %w", err)
+	}
+	a.classifier = classifier
+	if cfg.PowDifficulty() > 0 {
+		a.pow, err = spam.NewProofOfWork(cfg.PowDifficulty(), powChallengeTTL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("spam.NewProofOfWork(): %w", err)
+		}
+	}
+	pipeline := func(length spam.Filter) spam.Filter {
+		filters := []spam.Filter{length}
+		if limit := cfg.SpamRateLimit(); limit > 0 {
+			filters = append(filters, spam.RateLimitFilter(limit, time.Hour))
+		}
+		if a.pow != nil {
+			filters = append(filters, a.pow)
+		}
+		filters = append(filters,
+			spam.LinkFilter(cfg.SpamMaxLinks()),
+			spam.BannedWordsFilter(cfg.SpamBannedWords()),
+			classifier.Filter(classifierThreshold),
+		)
+		return spam.NewPipeline(classifier, filters...)
+	}
+	quotes = pipeline(spam.LengthFilter(cfg.QuoteMinLength(), cfg.QuoteMaxLength()))
+	comments = pipeline(spam.CommentLengthFilter(cfg.QuoteMaxLength()))
+	return quotes, comments, nil
 }
 
 func (a *API) ListenAndServe() error {
@@ -62,166 +235,433 @@ func (a *API) ListenAndServe() error {
 	return nil
 }
 
+// Shutdown disconnects the event streams, which would otherwise keep the
+// server busy, waits for the remaining requests and saves what the spam
+// classifier learnt from them.
 func (a *API) Shutdown() error {
-	ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
 	defer cancel()
-	return a.srv.Shutdown(ctx)
+	a.events.Close()
+	if err := a.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	return a.classifier.Save()
+}
+
+// newQuoteRepository returns the quote repository, behind an in-memory
+// cache unless it is disabled.
+func newQuoteRepository(cfg *config.Config, db repository.Connection, replicas []repository.Connection) domain.QuoteRepository {
+	repo := repository.NewQuoteRepository(db, replicas...)
+	if cfg.CacheSize() == 0 {
+		return repo
+	}
+	return cache.NewQuoteRepository(repo, cache.NewLRU(cfg.CacheSize()), cfg.CacheTTL())
+}
+
+// readYourWrites makes each request a repository session, so that what a
+// request shows after changing a quote, such as the card after a vote, is
+// read from the primary rather than a replica that may lag behind. A
+// request that writes also sets a short-lived cookie, so that the page a
+// form redirects to, such as the listing after adding a quote, is read
+// from the primary too.
+func readYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := repository.WithSession(r.Context())
+		if _, err := r.Cookie(wroteCookieName); err == nil {
+			ctx = repository.Primary(r.Context())
+		}
+		next.ServeHTTP(&wroteWriter{ResponseWriter: w, r: r, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// wroteWriter sets the cookie of readYourWrites before the response is
+// written, if the request has written by then.
+type wroteWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	ctx     context.Context
+	written bool
+}
+
+func (w *wroteWriter) WriteHeader(code int) {
+	if !w.written && repository.HasWritten(w.ctx) {
+		http.SetCookie(w.ResponseWriter, &http.Cookie{
+			Name:     wroteCookieName,
+			Value:    "1",
+			Path:     "/",
+			MaxAge:   int(repository.ReplicaLag / time.Second),
+			HttpOnly: true,
+			Secure:   w.r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *wroteWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the writer underneath, to
+// flush event streams.
+func (w *wroteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 func (a *API) listHandler(
-	fetch func(ctx context.Context, page, limit int) ([]*domain.Quote, error),
+	heading string,
+	fetch func(ctx context.Context, cursor string, limit int) (*domain.Page, error),
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		page := parsePage(r)
-		q, err := fetch(r.Context(), page, defaultLimit)
+		page, err := fetch(r.Context(), r.URL.Query().Get("cursor"), a.pageSize)
 		if err != nil {
-			a.error(w, http.StatusInternalServerError, "fetching quotes", err)
+			a.fail(w, r, "fetching quotes", err)
 			return
 		}
-		vms := toViewModels(q)
-		a.render(w, "index.html", map[string]any{
-			"Quotes":   vms,
-			"HasPrev":  page > 1,
-			"HasNext":  len(q) == defaultLimit,
-			"PrevPage": page - 1,
-			"NextPage": page + 1,
-			"Endpoint": path.Clean(r.URL.Path),
-		})
+		a.renderList(w, r, heading, page, map[string]any{}, "")
+	}
+}
+
+// renderList renders a page of a listing with pagination, adding it to
+// data. edit is the slug of the collection the visitor may rearrange, so
+// the cards get controls for it; it is empty for other listings.
+func (a *API) renderList(w http.ResponseWriter, r *http.Request, heading string, page *domain.Page, data map[string]any, edit string) {
+	endpoint := path.Clean(r.URL.Path)
+	if notModified(w, r, a.quotesETag(r.Context(), page.Quotes, heading, page.Prev, page.Next, edit), a.lastModified()) {
+		return
 	}
+	vms := a.toViewModels(r.Context(), page.Quotes)
+	for i := range vms {
+		vms[i].Collection = edit
+	}
+	data["Heading"] = heading
+	data["Quotes"] = vms
+	data["PrevCursor"] = page.Prev
+	data["NextCursor"] = page.Next
+	data["Endpoint"] = endpoint
+	data["FrontPage"] = endpoint == "/" && page.Prev == ""
+	a.renderPage(w, r, data)
 }
 
+// randomHandler picks a random quote matching the optional min_likes, from
+// and to (YYYY-MM-DD, inclusive) parameters. Quotes the visitor saw recently
+// are skipped until every matching quote has been shown.
 func (a *API) randomHandler(w http.ResponseWriter, r *http.Request) {
-	quote, err := a.quoteRepo.GetRandom(r.Context())
+	filter, err := parseRandomFilter(r)
 	if err != nil {
-		a.error(w, http.StatusInternalServerError, "fetching random quote", err)
+		a.error(w, r, http.StatusBadRequest, "invalid filter", err)
 		return
 	}
-	vms := toViewModels([]*domain.Quote{quote})
-	a.render(w, "index.html", map[string]any{"Quotes": vms})
+	recent := recentQuoteIDs(r)
+	filter.ExcludeIDs = recent
+	quote, err := a.quotes.Random(r.Context(), filter)
+	if err != nil {
+		a.fail(w, r, "fetching random quote", err)
+		return
+	}
+	setRecentQuoteIDs(w, append(recent, quote.ID))
+	w.Header().Set("Vary", "Accept")
+	if f := responseFormat(r); f != render.FormatHTML {
+		w.Header().Set("Content-Type", f.ContentType())
+		_ = render.Write(w, f, quote)
+		return
+	}
+	vms := a.toViewModels(r.Context(), []*domain.Quote{quote})
+	a.renderPage(w, r, map[string]any{"Quotes": vms})
 }
 
 func (a *API) voteHandler(w http.ResponseWriter, r *http.Request) {
-	id, vote, err := parseVote(r)
-	if err != nil {
-		a.error(w, http.StatusBadRequest, "invalid vote request", err)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		a.error(w, r, http.StatusMethodNotAllowed, "use POST to vote", nil)
 		return
 	}
-	action := map[string]func(context.Context, int) error{
-		"up":   a.quoteRepo.LikeQuote,
-		"down": a.quoteRepo.DislikeQuote,
-	}[vote]
-
-	if err := action(r.Context(), id); err != nil {
-		a.error(w, http.StatusInternalServerError, "applying vote", err)
+	id, vote, err := parseVote(r)
+	if err != nil {
+		a.error(w, r, http.StatusBadRequest, "invalid vote request", err)
 		return
 	}
-
-	quote, err := a.quoteRepo.GetByID(r.Context(), id)
+	quote, err := a.quotes.Vote(r.Context(), id, vote)
 	if err != nil {
-		a.error(w, http.StatusInternalServerError, "fetching updated quote", err)
+		a.fail(w, r, "applying vote", err)
 		return
 	}
-	vm := toViewModels([]*domain.Quote{quote})[0]
-	a.render(w, "quote-card.html", vm)
+	vm := a.toViewModels(r.Context(), []*domain.Quote{quote})[0]
+	a.render(w, r, "quote-card.html", vm)
 }
 
 func (a *API) viewHandler(w http.ResponseWriter, r *http.Request) {
 	parts := strings.TrimPrefix(r.URL.Path, "/quote/")
 	id, err := strconv.Atoi(parts)
 	if err != nil {
-		a.error(w, http.StatusBadRequest, "invalid quote ID", err)
+		a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
 		return
 	}
-	quote, err := a.quoteRepo.GetByID(r.Context(), id)
+	quote, err := a.quotes.Get(r.Context(), id)
+	if errors.Is(err, domain.ErrNotFound) {
+		if to, rerr := a.quotes.Redirect(r.Context(), id); rerr == nil {
+			target := url.URL{Path: "/quote/" + strconv.Itoa(to), RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+			return
+		}
+	}
 	if err != nil {
-		a.error(w, http.StatusNotFound, "quote not found", err)
+		a.fail(w, r, "fetching quote", err)
+		return
+	}
+	f := responseFormat(r)
+	var suggested []*domain.Quote
+	if f == render.FormatHTML {
+		suggested = a.relatedQuotes(r.Context(), id)
+	}
+	w.Header().Set("Vary", "Accept")
+	etag := a.quotesETag(r.Context(), append([]*domain.Quote{quote}, suggested...), string(f))
+	if notModified(w, r, etag, a.lastModified()) {
+		return
+	}
+	if f != render.FormatHTML {
+		w.Header().Set("Content-Type", f.ContentType())
+		_ = render.Write(w, f, quote)
+		return
+	}
+	// Without the database, the quote is still shown from the cache.
+	thread, err := a.thread(r, id)
+	if err != nil && !errors.Is(err, domain.ErrUnavailable) {
+		a.fail(w, r, "fetching comments", err)
+		return
+	}
+	addTo, err := a.addTo(r, id)
+	if err != nil && !errors.Is(err, domain.ErrUnavailable) {
+		a.fail(w, r, "fetching collections", err)
 		return
 	}
-	vms := toViewModels([]*domain.Quote{quote})
-	a.render(w, "index.html", map[string]any{"Quotes": vms})
+	vms := a.toViewModels(r.Context(), []*domain.Quote{quote})
+	a.renderPage(w, r, map[string]any{
+		"Quotes":  vms,
+		"Thread":  thread,
+		"AddTo":   addTo,
+		"Related": toQuoteLinks(suggested),
+	})
+}
+
+// relatedQuotes returns the quotes suggested below a quote. They are an
+// extra, so failing to fetch them only leaves them out.
+func (a *API) relatedQuotes(ctx context.Context, id int) []*domain.Quote {
+	if a.relatedRepo == nil {
+		return nil
+	}
+	quotes, err := a.relatedRepo.Get(ctx, id, related.Count)
+	if err != nil {
+		a.logger.Warn("Failed to fetch related quotes", slog.Int("id", id), slog.Any("err", err))
+		return nil
+	}
+	return quotes
 }
 
 func (a *API) addQuote(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		a.error(w, http.StatusMethodNotAllowed, "use POST to add quote", nil)
+		w.Header().Set("Allow", http.MethodPost)
+		a.error(w, r, http.StatusMethodNotAllowed, "use POST to add quote", nil)
 		return
 	}
-	quote := &domain.Quote{
-		Quote:   nl2br(r.FormValue("quote")),
-		Comment: nl2br(r.FormValue("comment")),
-		Date:    time.Now(),
-		IP:      r.RemoteAddr,
+	_, err := a.quotes.Add(r.Context(), service.Submission{
+		Quote:          r.FormValue("quote"),
+		Comment:        r.FormValue("comment"),
+		IP:             clientIP(r),
+		Challenge:      r.FormValue("pow_challenge"),
+		Nonce:          r.FormValue("pow_nonce"),
+		AllowDuplicate: r.FormValue("allow_duplicate") != "",
+	})
+	var dup *service.DuplicateError
+	if errors.As(err, &dup) && r.Header.Get("HX-Request") == "true" {
+		a.duplicateWarning(w, r, dup)
+		return
 	}
-	if err := a.quoteRepo.Create(r.Context(), quote); err != nil {
-		a.error(w, http.StatusInternalServerError, "adding quote", err)
+	if err != nil {
+		a.fail(w, r, "adding quote", err)
 		return
 	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func (a *API) render(w http.ResponseWriter, tpl string, data any) {
-	if err := a.tmpl.ExecuteTemplate(w, tpl, data); err != nil {
-		a.error(w, http.StatusInternalServerError, "rendering "+tpl, err)
+// duplicateWarning shows the quotes a submission looks like in the page's
+// error banner, and arms the form to add it anyway when sent again.
+func (a *API) duplicateWarning(w http.ResponseWriter, r *http.Request, dup *service.DuplicateError) {
+	data := map[string]any{"Quotes": toQuoteLinks(dup.Quotes)}
+	if a.pow != nil {
+		data["PowDifficulty"] = a.pow.Difficulty()
 	}
+	var buf bytes.Buffer
+	if err := a.tmpl.ExecuteTemplate(&buf, "duplicate-warning.html", data); err != nil {
+		a.error(w, r, http.StatusInternalServerError, "rendering duplicate-warning.html", err)
+		return
+	}
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("HX-Retarget", "#error-banner")
+	h.Set("HX-Reswap", "innerHTML")
+	h.Set("HX-Reselect", "#error-message")
+	w.WriteHeader(http.StatusConflict)
+	buf.WriteTo(w)
 }
 
-func (a *API) error(w http.ResponseWriter, status int, msg string, err error) {
-	http.Error(w, msg, status)
+// renderPage renders index.html, adding the request's CSRF token so the page
+// can hand it to htmx, whether the site is read-only, and the difficulty of
+// the proof of work for the form.
+func (a *API) renderPage(w http.ResponseWriter, r *http.Request, data map[string]any) {
+	data["CSRFToken"] = csrfToken(r.Context())
+	data["ReadOnly"] = a.readOnly()
+	if a.reactions != nil {
+		data["Reactions"] = a.reactions.Available()
+	}
+	if a.pow != nil {
+		data["PowDifficulty"] = a.pow.Difficulty()
+	}
+	a.render(w, r, "index.html", data)
+}
+
+// powHandler hands out a proof-of-work challenge to a form about to be
+// sent. Challenges can be redeemed once, so forms fetch one for every
+// submission instead of carrying one in pages that browsers revalidate and
+// reuse.
+func (a *API) powHandler(w http.ResponseWriter, r *http.Request) {
+	if a.pow == nil {
+		a.notFoundHandler(w, r)
+		return
+	}
+	challenge, err := a.pow.NewChallenge()
 	if err != nil {
-		a.logger.Error(msg, slog.Any("error", err))
+		a.error(w, r, http.StatusInternalServerError, "generating challenge", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, challenge)
+}
+
+func parseRandomFilter(r *http.Request) (domain.RandomFilter, error) {
+	var f domain.RandomFilter
+	q := r.URL.Query()
+	if v := q.Get("min_likes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("min_likes: %w", err)
+		}
+		f.MinLikes = &n
+	}
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return f, fmt.Errorf("from: %w", err)
+		}
+		f.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return f, fmt.Errorf("to: %w", err)
+		}
+		f.To = t.AddDate(0, 0, 1)
 	}
+	return f, nil
 }
 
-func parsePage(r *http.Request) int {
-	if p := r.URL.Query().Get("page"); p != "" {
-		if i, err := strconv.Atoi(p); err == nil && i > 0 {
-			return i
+// recentQuoteIDs returns the IDs of the random quotes recently shown to the
+// visitor, oldest first.
+func recentQuoteIDs(r *http.Request) []int {
+	c, err := r.Cookie(randomHistoryCookie)
+	if err != nil {
+		return nil
+	}
+	var ids []int
+	for _, s := range strings.Split(c.Value, ".") {
+		if id, err := strconv.Atoi(s); err == nil && id > 0 {
+			ids = append(ids, id)
 		}
 	}
-	return 1
+	if len(ids) > randomHistorySize {
+		ids = ids[len(ids)-randomHistorySize:]
+	}
+	return ids
 }
 
-func parseVote(r *http.Request) (id int, vote string, _ error) {
+func setRecentQuoteIDs(w http.ResponseWriter, ids []int) {
+	if len(ids) > randomHistorySize {
+		ids = ids[len(ids)-randomHistorySize:]
+	}
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     randomHistoryCookie,
+		Value:    strings.Join(parts, "."),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func parseVote(r *http.Request) (id int, vote service.Vote, _ error) {
 	q := r.URL.Query()
-	vote = q.Get("type")
-	if vote != "up" && vote != "down" {
-		return 0, "", errors.New("must be up or down")
+	vote, err := service.ParseVote(q.Get("type"))
+	if err != nil {
+		return 0, 0, err
 	}
-	idStr := q.Get("id")
-	id, err := strconv.Atoi(idStr)
+	id, err = strconv.Atoi(q.Get("id"))
 	return id, vote, err
 }
 
-func toViewModels(quotes []*domain.Quote) []Quote {
+// toViewModels renders quotes for the templates, with the reactions and
+// favourites of the visitor in ctx. Comment counts, reactions and
+// favourites are decoration, so failing to look them up is only logged.
+func (a *API) toViewModels(ctx context.Context, quotes []*domain.Quote) []Quote {
+	var counts map[int]int
+	var tallies map[int][]service.Tally
+	var favourites map[int]bool
+	if len(quotes) > 0 {
+		var err error
+		if a.comments != nil {
+			if counts, err = a.comments.Counts(ctx, quotes); err != nil {
+				a.logger.Warn("Failed to count comments", slog.Any("err", err))
+			}
+		}
+		if a.reactions != nil {
+			if tallies, err = a.reactions.Tallies(ctx, quotes, visitor(ctx)); err != nil {
+				a.logger.Warn("Failed to count reactions", slog.Any("err", err))
+			}
+		}
+		if a.collections != nil && visitor(ctx) != "" {
+			if favourites, err = a.favourited(ctx, quotes); err != nil {
+				a.logger.Warn("Failed to look up favourites", slog.Any("err", err))
+			}
+		}
+	}
 	vms := make([]Quote, len(quotes))
 	for i, q := range quotes {
 		vms[i] = Quote{
-			ID:      q.ID,
-			Quote:   sanitize(q.Quote),
-			Comment: sanitize(q.Comment),
-			Date:    q.Date,
-			IP:      q.IP,
-			Likes:   q.Likes,
-			Votes:   q.Votes,
+			ID:        q.ID,
+			Quote:     render.HTML(q.Quote, a.markup),
+			Comment:   render.HTML(q.Comment, a.markup),
+			Date:      q.Date,
+			Likes:     q.Likes,
+			Votes:     q.Votes,
+			Comments:  counts[q.ID],
+			Favourite: favourites[q.ID],
+		}
+		for _, t := range tallies[q.ID] {
+			vms[i].Reactions = append(vms[i].Reactions, Reaction{
+				Name:  t.Name,
+				Emoji: t.Emoji,
+				Count: t.Count,
+				Mine:  t.Mine,
+			})
 		}
 	}
 	return vms
 }
-
-func nl2br(s string) string {
-	return strings.ReplaceAll(s, "\n", "<br />")
-}
-
-func sanitize(raw string) template.HTML {
-	r := strings.NewReplacer(
-		"<br />", "<br>",
-		`<br \/>`, "<br>",
-	)
-	raw = r.Replace(raw)
-	return template.HTML(tagRe.ReplaceAllStringFunc(raw, func(m string) string {
-		if m == "<br>" {
-			return m
-		}
-		return template.HTMLEscapeString(m)
-	}))
-}
@@ -2,40 +2,67 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hionay/quotes/internal/cache"
+	"github.com/hionay/quotes/internal/dedup"
 	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/events"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/qotd"
+	"github.com/hionay/quotes/internal/render"
+	"github.com/hionay/quotes/internal/repository"
+	"github.com/hionay/quotes/internal/schedule"
+	"github.com/hionay/quotes/internal/service"
+	"github.com/hionay/quotes/internal/spam"
 )
 
 type mockRepo struct {
-	GetLatestFunc    func(ctx context.Context, page, limit int) ([]*domain.Quote, error)
-	GetTopFunc       func(ctx context.Context, page, limit int) ([]*domain.Quote, error)
-	GetRandomFunc    func(ctx context.Context) (*domain.Quote, error)
+	GetLatestFunc    func(ctx context.Context, cursor string, limit int) (*domain.Page, error)
+	GetTopFunc       func(ctx context.Context, cursor string, limit int) (*domain.Page, error)
+	GetRandomFunc    func(ctx context.Context, f domain.RandomFilter) (*domain.Quote, error)
 	CreateFunc       func(ctx context.Context, q *domain.Quote) error
+	DeleteFunc       func(ctx context.Context, id int) error
 	LikeQuoteFunc    func(ctx context.Context, id int) error
 	DislikeQuoteFunc func(ctx context.Context, id int) error
 	GetByIDFunc      func(ctx context.Context, id int) (*domain.Quote, error)
+	GetByIDsFunc     func(ctx context.Context, ids []int) ([]*domain.Quote, error)
+	GetOnThisDayFunc func(ctx context.Context, day time.Time, cursor string, limit int) (*domain.Page, error)
+	GetByPeriodFunc  func(ctx context.Context, from, to time.Time, cursor string, limit int) (*domain.Page, error)
+	CountByYearFunc  func(ctx context.Context) ([]domain.PeriodCount, error)
+	CountByMonthFunc func(ctx context.Context, year int) ([]domain.PeriodCount, error)
+	MergeFunc        func(ctx context.Context, keep int, dups []int) error
+	GetRedirectFunc  func(ctx context.Context, id int) (int, error)
 }
 
-func (m *mockRepo) GetLatest(ctx context.Context, page, limit int) ([]*domain.Quote, error) {
-	return m.GetLatestFunc(ctx, page, limit)
+func (m *mockRepo) GetLatest(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return m.GetLatestFunc(ctx, cursor, limit)
 }
-func (m *mockRepo) GetTop(ctx context.Context, page, limit int) ([]*domain.Quote, error) {
-	return m.GetTopFunc(ctx, page, limit)
+func (m *mockRepo) GetTop(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return m.GetTopFunc(ctx, cursor, limit)
 }
-func (m *mockRepo) GetRandom(ctx context.Context) (*domain.Quote, error) {
-	return m.GetRandomFunc(ctx)
+func (m *mockRepo) GetRandom(ctx context.Context, f domain.RandomFilter) (*domain.Quote, error) {
+	return m.GetRandomFunc(ctx, f)
 }
 func (m *mockRepo) Create(ctx context.Context, q *domain.Quote) error {
 	return m.CreateFunc(ctx, q)
 }
+func (m *mockRepo) Delete(ctx context.Context, id int) error {
+	return m.DeleteFunc(ctx, id)
+}
 func (m *mockRepo) LikeQuote(ctx context.Context, id int) error {
 	return m.LikeQuoteFunc(ctx, id)
 }
@@ -45,39 +72,135 @@ func (m *mockRepo) DislikeQuote(ctx context.Context, id int) error {
 func (m *mockRepo) GetByID(ctx context.Context, id int) (*domain.Quote, error) {
 	return m.GetByIDFunc(ctx, id)
 }
+func (m *mockRepo) GetByIDs(ctx context.Context, ids []int) ([]*domain.Quote, error) {
+	return m.GetByIDsFunc(ctx, ids)
+}
+func (m *mockRepo) GetOnThisDay(ctx context.Context, day time.Time, cursor string, limit int) (*domain.Page, error) {
+	return m.GetOnThisDayFunc(ctx, day, cursor, limit)
+}
+func (m *mockRepo) GetByPeriod(ctx context.Context, from, to time.Time, cursor string, limit int) (*domain.Page, error) {
+	return m.GetByPeriodFunc(ctx, from, to, cursor, limit)
+}
+func (m *mockRepo) CountByYear(ctx context.Context) ([]domain.PeriodCount, error) {
+	return m.CountByYearFunc(ctx)
+}
+func (m *mockRepo) CountByMonth(ctx context.Context, year int) ([]domain.PeriodCount, error) {
+	return m.CountByMonthFunc(ctx, year)
+}
+func (m *mockRepo) Merge(ctx context.Context, keep int, dups []int) error {
+	return m.MergeFunc(ctx, keep, dups)
+}
+func (m *mockRepo) GetRedirect(ctx context.Context, id int) (int, error) {
+	if m.GetRedirectFunc == nil {
+		return 0, domain.ErrNotFound
+	}
+	return m.GetRedirectFunc(ctx, id)
+}
 
-func TestParsePage(t *testing.T) {
-	tests := []struct {
-		query  string
-		expect int
-	}{
-		{"", 1},
-		{"?page=abc", 1},
-		{"?page=0", 1},
-		{"?page=3", 3},
+// mockCommentRepo keeps comments in memory.
+type mockCommentRepo struct {
+	comments []*domain.Comment
+}
+
+func (m *mockCommentRepo) Create(_ context.Context, c *domain.Comment) error {
+	c.ID = len(m.comments) + 1
+	m.comments = append(m.comments, c)
+	return nil
+}
+func (m *mockCommentRepo) GetByID(_ context.Context, id int) (*domain.Comment, error) {
+	for _, c := range m.comments {
+		if c.ID == id {
+			return c, nil
+		}
 	}
-	for _, tt := range tests {
-		r := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
-		p := parsePage(r)
-		if p != tt.expect {
-			t.Errorf("parsePage(%q) = %d; want %d", tt.query, p, tt.expect)
+	return nil, domain.ErrNotFound
+}
+func (m *mockCommentRepo) ListByQuote(_ context.Context, quoteID int) ([]*domain.Comment, error) {
+	var list []*domain.Comment
+	for _, c := range m.comments {
+		if c.QuoteID == quoteID {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+func (m *mockCommentRepo) Recent(context.Context, int) ([]*domain.Comment, error) {
+	return m.comments, nil
+}
+func (m *mockCommentRepo) CountVisible(_ context.Context, ids []int) (map[int]int, error) {
+	counts := map[int]int{}
+	for _, c := range m.comments {
+		if !c.Hidden {
+			counts[c.QuoteID]++
 		}
 	}
+	return counts, nil
+}
+func (m *mockCommentRepo) SetHidden(ctx context.Context, id int, hidden bool) error {
+	c, err := m.GetByID(ctx, id)
+	if err == nil {
+		c.Hidden = hidden
+	}
+	return err
+}
+func (m *mockCommentRepo) Delete(context.Context, int) error {
+	return nil
+}
+
+type reactionKey struct {
+	quoteID           int
+	visitor, reaction string
+}
+
+// mockReactionRepo keeps reactions in memory.
+type mockReactionRepo struct {
+	domain.ReactionRepository
+	given map[reactionKey]bool
+}
+
+func (m *mockReactionRepo) Toggle(_ context.Context, id int, visitor, reaction string) (bool, error) {
+	k := reactionKey{id, visitor, reaction}
+	m.given[k] = !m.given[k]
+	return m.given[k], nil
+}
+
+func (m *mockReactionRepo) Counts(context.Context, []int) (map[int]map[string]int, error) {
+	counts := map[int]map[string]int{}
+	for k, ok := range m.given {
+		if ok {
+			if counts[k.quoteID] == nil {
+				counts[k.quoteID] = map[string]int{}
+			}
+			counts[k.quoteID][k.reaction]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *mockReactionRepo) ByVisitor(_ context.Context, _ []int, visitor string) (map[int][]string, error) {
+	mine := map[int][]string{}
+	for k, ok := range m.given {
+		if ok && k.visitor == visitor {
+			mine[k.quoteID] = append(mine[k.quoteID], k.reaction)
+		}
+	}
+	return mine, nil
 }
 
 func TestParseVote(t *testing.T) {
 	tests := []struct {
 		url     string
 		wantID  int
-		wantTyp string
+		wantTyp service.Vote
 		errOK   bool
 	}{
-		{"/vote", 0, "", false},
-		{"/vote?id=1", 0, "", false},
-		{"/vote?type=up", 0, "", false},
-		{"/vote?id=x&type=up", 0, "", false},
-		{"/vote?id=5&type=up", 5, "up", true},
-		{"/vote?id=8&type=down", 8, "down", true},
+		{"/vote", 0, 0, false},
+		{"/vote?id=1", 0, 0, false},
+		{"/vote?type=up", 0, 0, false},
+		{"/vote?id=x&type=up", 0, 0, false},
+		{"/vote?id=5&type=up", 5, service.VoteUp, true},
+		{"/vote?id=8&type=down", 8, service.VoteDown, true},
 	}
 	for _, tt := range tests {
 		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
@@ -88,7 +211,7 @@ func TestParseVote(t *testing.T) {
 				continue
 			}
 			if id != tt.wantID || vt != tt.wantTyp {
-				t.Errorf("parseVote(%q) = (%d,%q); want (%d,%q)", tt.url, id, vt, tt.wantID, tt.wantTyp)
+				t.Errorf("parseVote(%q) = (%d,%d); want (%d,%d)", tt.url, id, vt, tt.wantID, tt.wantTyp)
 			}
 		} else {
 			if err == nil {
@@ -99,27 +222,139 @@ func TestParseVote(t *testing.T) {
 }
 
 func TestListHandler(t *testing.T) {
+	var gotCursor string
 	repo := &mockRepo{
-		GetLatestFunc: func(ctx context.Context, page, limit int) ([]*domain.Quote, error) {
-			return []*domain.Quote{{ID: 1, Quote: "q1"}, {ID: 2, Quote: "q2"}}, nil
+		GetLatestFunc: func(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+			gotCursor = cursor
+			if cursor == "bad" {
+				return nil, domain.ErrInvalidCursor
+			}
+			return &domain.Page{
+				Quotes: []*domain.Quote{{ID: 1, Quote: "q1"}, {ID: 2, Quote: "q2"}},
+				Next:   "n2",
+			}, nil
 		},
 	}
 	a := &API{
 		logger:    slog.Default(),
 		quoteRepo: repo,
-		tmpl:      template.Must(template.New("index.html").Parse(`{{len .Quotes}} quotes`)),
+		tmpl:      template.Must(template.New("index.html").Parse(`{{len .Quotes}} quotes next={{.NextCursor}} prev={{.PrevCursor}}`)),
+		pageSize:  10,
 	}
-	r := httptest.NewRequest(http.MethodGet, "/?page=2", nil)
+	r := httptest.NewRequest(http.MethodGet, "/?cursor=abc", nil)
 	w := httptest.NewRecorder()
-	h := a.listHandler(repo.GetLatest)
+	h := a.listHandler("", repo.GetLatest)
 	h(w, r)
 	res := w.Result()
 	if res.StatusCode != http.StatusOK {
 		t.Fatalf("status = %d; want %d", res.StatusCode, http.StatusOK)
 	}
 	body, _ := io.ReadAll(w.Body)
-	if !strings.Contains(string(body), "2 quotes") {
-		t.Errorf("body = %q; want contains %q", string(body), "2 quotes")
+	if !strings.Contains(string(body), "2 quotes next=n2 prev=") {
+		t.Errorf("body = %q; want contains %q", string(body), "2 quotes next=n2 prev=")
+	}
+	if gotCursor != "abc" {
+		t.Errorf("cursor = %q; want %q", gotCursor, "abc")
+	}
+
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag set")
+	}
+	if vary := res.Header.Values("Vary"); !slices.Contains(vary, "HX-Request") {
+		t.Errorf("Vary = %q; want HX-Request", vary)
+	}
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/?cursor=abc", nil)
+	r.Header.Set("If-None-Match", `"other", `+etag)
+	h(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("revalidation: status = %d with %d bytes; want %d and no body", w.Code, w.Body.Len(), http.StatusNotModified)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/?cursor=bad", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLastModifiedOnlyWithoutReplicas(t *testing.T) {
+	a := &API{quoteRepo: cache.NewQuoteRepository(&mockRepo{}, cache.NewLRU(10), time.Minute)}
+	if a.lastModified().IsZero() {
+		t.Fatal("lastModified() is zero without replicas")
+	}
+
+	a.replicated = true
+	modified := a.lastModified()
+	if !modified.IsZero() {
+		t.Fatalf("lastModified() = %v with replicas; want zero", modified)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w := httptest.NewRecorder()
+	if notModified(w, r, `W/"x"`, modified) {
+		t.Error("notModified() = true for If-Modified-Since with replicas")
+	}
+	if lm := w.Header().Get("Last-Modified"); lm != "" {
+		t.Errorf("Last-Modified = %q with replicas; want none", lm)
+	}
+}
+
+func TestRandomHandler(t *testing.T) {
+	var filters []domain.RandomFilter
+	repo := &mockRepo{
+		GetRandomFunc: func(ctx context.Context, f domain.RandomFilter) (*domain.Quote, error) {
+			filters = append(filters, f)
+			if len(f.ExcludeIDs) > 2 {
+				return nil, domain.ErrNotFound
+			}
+			return &domain.Quote{ID: 9}, nil
+		},
+	}
+	a := &API{
+		logger: slog.Default(),
+		quotes: service.NewQuoteService(repo, service.Options{}),
+		tmpl:   template.Must(template.New("index.html").Parse(`ID={{(index .Quotes 0).ID}}`)),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/random?min_likes=3&from=2007-01-01&to=2007-12-31", nil)
+	r.AddCookie(&http.Cookie{Name: randomHistoryCookie, Value: "4.5"})
+	w := httptest.NewRecorder()
+	a.randomHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	f := filters[0]
+	if f.MinLikes == nil || *f.MinLikes != 3 || f.From.Year() != 2007 || f.To.Format(time.DateOnly) != "2008-01-01" {
+		t.Errorf("filter = %+v; want min_likes 3 in 2007", f)
+	}
+	if len(f.ExcludeIDs) != 2 {
+		t.Errorf("ExcludeIDs = %v; want [4 5]", f.ExcludeIDs)
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Value != "4.5.9" {
+		t.Errorf("cookies = %v; want history 4.5.9", c)
+	}
+
+	filters = nil
+	r = httptest.NewRequest(http.MethodGet, "/random", nil)
+	r.AddCookie(&http.Cookie{Name: randomHistoryCookie, Value: "4.5.9"})
+	w = httptest.NewRecorder()
+	a.randomHandler(w, r)
+	if w.Code != http.StatusOK || len(filters) != 2 || filters[1].ExcludeIDs != nil {
+		t.Errorf("exhausted history: status %d, filters %+v; want retry without exclusions", w.Code, filters)
+	}
+
+	w = httptest.NewRecorder()
+	a.randomHandler(w, httptest.NewRequest(http.MethodGet, "/random?from=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = httptest.NewRecorder()
+	a.randomHandler(w, httptest.NewRequest(http.MethodGet, "/random?format=json", nil))
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || !strings.HasPrefix(ct, "application/json") || !strings.Contains(w.Body.String(), `"id":9`) {
+		t.Errorf("JSON: status %d, Content-Type %q, body %q; want the quote as JSON", w.Code, ct, w.Body.String())
 	}
 }
 
@@ -131,7 +366,12 @@ func TestAddQuote(t *testing.T) {
 			return nil
 		},
 	}
-	a := &API{quoteRepo: repo, logger: slog.Default()}
+	a := &API{logger: slog.Default(), events: events.NewHub(1)}
+	a.quotes = service.NewQuoteService(repo, service.Options{
+		Filter:   spam.NewPipeline(nil),
+		IPs:      testAnonymizer(t),
+		Listener: liveUpdates{a},
+	})
 	r := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("quote=hello+world&comment=nice"))
 	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
@@ -149,6 +389,117 @@ func TestAddQuote(t *testing.T) {
 	if created.Comment != "nice" {
 		t.Errorf("created.Comment = %q; want %q", created.Comment, "nice")
 	}
+	if created.IP != "192.0.2.0/24" {
+		t.Errorf("created.IP = %q; want %q", created.IP, "192.0.2.0/24")
+	}
+}
+
+func testAnonymizer(t *testing.T) *privacy.Anonymizer {
+	t.Helper()
+	ips, err := privacy.NewAnonymizer(privacy.ModeTruncate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ips
+}
+
+func TestPowHandler(t *testing.T) {
+	pow, err := spam.NewProofOfWork(8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &API{logger: slog.Default(), pow: pow}
+	var challenges []string
+	for range 2 {
+		w := httptest.NewRecorder()
+		a.powHandler(w, httptest.NewRequest(http.MethodGet, "/pow", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("GET /pow = %d with Cache-Control %q; want 200 and no-store", w.Code, w.Header().Get("Cache-Control"))
+		}
+		challenges = append(challenges, w.Body.String())
+	}
+	if challenges[0] == "" || challenges[0] == challenges[1] {
+		t.Errorf("challenges = %q; want a fresh one for each request", challenges)
+	}
+}
+
+func TestAddQuoteRejected(t *testing.T) {
+	repo := &mockRepo{
+		CreateFunc: func(ctx context.Context, q *domain.Quote) error {
+			t.Fatal("rejected quote must not be created")
+			return nil
+		},
+	}
+	a := &API{logger: slog.Default(), quotes: service.NewQuoteService(repo, service.Options{
+		Filter: spam.NewPipeline(nil, spam.LengthFilter(3, 100)),
+		IPs:    testAnonymizer(t),
+	})}
+	r := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("quote=ab&comment=nice"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	a.addQuote(w, r)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+// sameFingerprints finds every quote it was given as a near-duplicate.
+type sameFingerprints []int
+
+func (f sameFingerprints) Put(context.Context, int, uint64) error { return nil }
+
+func (f sameFingerprints) Near(context.Context, uint64, int) ([]int, error) { return f, nil }
+
+func (f sameFingerprints) All(context.Context) (map[int]uint64, error) { return nil, nil }
+
+func TestAddQuoteDuplicate(t *testing.T) {
+	created := 0
+	repo := &mockRepo{
+		CreateFunc: func(ctx context.Context, q *domain.Quote) error {
+			created++
+			q.ID = 10
+			return nil
+		},
+		GetByIDsFunc: func(ctx context.Context, ids []int) ([]*domain.Quote, error) {
+			var list []*domain.Quote
+			for _, id := range ids {
+				list = append(list, &domain.Quote{ID: id, Quote: "<a> is it plugged in?"})
+			}
+			return list, nil
+		},
+	}
+	a := &API{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		quotes: service.NewQuoteService(repo, service.Options{
+			IPs:        testAnonymizer(t),
+			Duplicates: dedup.NewIndex(sameFingerprints{7}, nil),
+		}),
+		tmpl: template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+	add := func(form string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("HX-Request", "true")
+		w := httptest.NewRecorder()
+		a.addQuote(w, r)
+		return w
+	}
+
+	w := add("quote=%3Ca%3E+is+it+plugged+in")
+	body := w.Body.String()
+	if w.Code != http.StatusConflict || w.Header().Get("HX-Retarget") != "#error-banner" {
+		t.Fatalf("status = %d, HX-Retarget = %q; want 409 into the error banner", w.Code, w.Header().Get("HX-Retarget"))
+	}
+	if !strings.Contains(body, `href="/quote/7"`) || !strings.Contains(body, `name="allow_duplicate"`) {
+		t.Errorf("warning does not link the duplicate or allow resubmitting:\n%s", body)
+	}
+	if created != 0 {
+		t.Fatal("duplicate was stored without confirmation")
+	}
+
+	if w := add("quote=%3Ca%3E+is+it+plugged+in&allow_duplicate=1"); w.Code >= 400 || created != 1 {
+		t.Errorf("confirmed duplicate: status = %d, stored %d; want it stored", w.Code, created)
+	}
 }
 
 func TestVoteHandler(t *testing.T) {
@@ -162,16 +513,18 @@ func TestVoteHandler(t *testing.T) {
 			return nil
 		},
 		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
-			return &domain.Quote{ID: id, Quote: "q"}, nil
+			return &domain.Quote{ID: id, Quote: "q", Likes: 3}, nil
 		},
 	}
 	a := &API{
-		logger:    slog.Default(),
-		quoteRepo: repo,
-		tmpl:      template.Must(template.New("quote-card.html").Parse(`quote {{.ID}}`)),
+		logger: slog.Default(),
+		tmpl:   template.Must(template.New("quote-card.html").Parse(`quote {{.ID}}`)),
+		events: events.NewHub(1),
 	}
+	a.quotes = service.NewQuoteService(repo, service.Options{Listener: liveUpdates{a}})
+	sub := a.events.Subscribe()
 
-	r := httptest.NewRequest(http.MethodGet, "/vote?id=7&type=up", nil)
+	r := httptest.NewRequest(http.MethodPost, "/vote?id=7&type=up", nil)
 	w := httptest.NewRecorder()
 	a.voteHandler(w, r)
 	res := w.Result()
@@ -185,21 +538,109 @@ func TestVoteHandler(t *testing.T) {
 	if !strings.Contains(string(body), "quote 7") {
 		t.Errorf("body = %q; want contains %q", string(body), "quote 7")
 	}
+	if e := <-sub.C; e.Name != "likes-7" || e.Data != "Likes: 3" {
+		t.Errorf("published %+v; want likes-7 with %q", e, "Likes: 3")
+	}
+}
+
+type availableFunc func() bool
+
+func (f availableFunc) Available() bool { return f() }
+
+func TestReadOnly(t *testing.T) {
+	up := true
+	repo := &mockRepo{
+		GetLatestFunc: func(context.Context, string, int) (*domain.Page, error) {
+			return &domain.Page{Quotes: []*domain.Quote{{ID: 1, Quote: "q1"}}}, nil
+		},
+		LikeQuoteFunc: func(context.Context, int) error {
+			return fmt.Errorf("like quote: %w", domain.ErrUnavailable)
+		},
+	}
+	a := &API{
+		logger:   slog.Default(),
+		tmpl:     template.Must(template.New("index.html").Parse(`{{len .Quotes}} quotes{{if .ReadOnly}} read-only{{end}}`)),
+		pageSize: 10,
+		db:       availableFunc(func() bool { return up }),
+	}
+	a.quotes = service.NewQuoteService(repo, service.Options{})
+
+	w := httptest.NewRecorder()
+	a.listHandler("", repo.GetLatest)(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := w.Header().Get("ETag")
+	up = false
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	a.listHandler("", repo.GetLatest)(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "1 quotes read-only" {
+		t.Errorf("list with the database down = %d %q; want the page with the banner", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/vote?id=7&type=up&format=json", nil)
+	a.voteHandler(w, r)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "read-only") {
+		t.Errorf("vote with the database down = %d %q; want 503 saying the site is read-only", w.Code, w.Body.String())
+	}
+
+	a.qotd = qotd.NewSelector(repo, downDays{}, time.UTC, 365)
+	w = httptest.NewRecorder()
+	a.qotdHandler(w, httptest.NewRequest(http.MethodGet, "/qotd?format=json", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "read-only") {
+		t.Errorf("quote of the day with the database down = %d %q; want 503 saying the site is read-only", w.Code, w.Body.String())
+	}
+}
+
+// downDays is a DailyQuoteRepository whose database is unavailable.
+type downDays struct {
+	domain.DailyQuoteRepository
+}
+
+func (downDays) Get(context.Context, time.Time) (*domain.DailyQuote, error) {
+	return nil, fmt.Errorf("query daily quote: %w", domain.ErrUnavailable)
+}
+
+func TestWriteEvent(t *testing.T) {
+	var b strings.Builder
+	writeEvent(&b, events.Event{Name: "quote", Data: "<article>\n  hi\n</article>\n"})
+	want := "event: quote\ndata: <article>\ndata:   hi\ndata: </article>\n\n"
+	if b.String() != want {
+		t.Errorf("writeEvent() wrote %q; want %q", b.String(), want)
+	}
+}
+
+func TestVoteHandlerRejectsGet(t *testing.T) {
+	a := &API{logger: slog.Default(), quotes: service.NewQuoteService(&mockRepo{}, service.Options{})}
+	r := httptest.NewRequest(http.MethodGet, "/vote?id=7&type=up", nil)
+	w := httptest.NewRecorder()
+	a.voteHandler(w, r)
+	res := w.Result()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d; want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if got := res.Header.Get("Allow"); got != http.MethodPost {
+		t.Errorf("Allow = %q; want %q", got, http.MethodPost)
+	}
 }
 
 func TestViewHandler(t *testing.T) {
 	repo := &mockRepo{
 		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
-			if id != 42 {
-				return nil, errors.New("not found")
+			switch id {
+			case 42:
+				return &domain.Quote{ID: 42, Quote: "x"}, nil
+			case 500:
+				return nil, errors.New("connection refused")
 			}
-			return &domain.Quote{ID: 42, Quote: "x"}, nil
+			return nil, fmt.Errorf("quote %d: %w", id, domain.ErrNotFound)
 		},
 	}
 	a := &API{
-		logger:    slog.Default(),
-		quoteRepo: repo,
-		tmpl:      template.Must(template.New("index.html").Parse(`ID={{(index .Quotes 0).ID}}`)),
+		logger:   slog.Default(),
+		quotes:   service.NewQuoteService(repo, service.Options{}),
+		comments: service.NewCommentService(&mockCommentRepo{}, repo, service.Options{}),
+		tmpl:     template.Must(template.New("index.html").Parse(`ID={{(index .Quotes 0).ID}}`)),
 	}
 
 	r1 := httptest.NewRequest(http.MethodGet, "/quote/42", nil)
@@ -221,4 +662,492 @@ func TestViewHandler(t *testing.T) {
 	if rsp2.StatusCode != http.StatusBadRequest {
 		t.Errorf("status = %d; want %d", rsp2.StatusCode, http.StatusBadRequest)
 	}
+
+	for path, want := range map[string]int{"/quote/7": http.StatusNotFound, "/quote/500": http.StatusInternalServerError} {
+		w := httptest.NewRecorder()
+		a.viewHandler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: status = %d; want %d", path, w.Code, want)
+		}
+	}
+}
+
+type mockRelatedRepo struct {
+	domain.RelatedRepository
+	related []*domain.Quote
+	err     error
+}
+
+func (m *mockRelatedRepo) Get(context.Context, int, int) ([]*domain.Quote, error) {
+	return m.related, m.err
+}
+
+func TestViewHandlerRelated(t *testing.T) {
+	repo := &mockRepo{
+		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
+			return &domain.Quote{ID: id, Quote: "<alice> coffee"}, nil
+		},
+	}
+	related := &mockRelatedRepo{related: []*domain.Quote{
+		{ID: 8, Quote: "<bob> more\n  coffee"},
+		{ID: 9, Quote: strings.Repeat("long ", 40)},
+	}}
+	a := &API{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		quotes:      service.NewQuoteService(repo, service.Options{}),
+		comments:    service.NewCommentService(&mockCommentRepo{}, repo, service.Options{}),
+		relatedRepo: related,
+		tmpl:        template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+	view := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.viewHandler(w, httptest.NewRequest(http.MethodGet, "/quote/3", nil))
+		return w
+	}
+
+	w := view()
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Related quotes") || !strings.Contains(body, `href="/quote/8"`) {
+		t.Fatalf("status = %d; related quotes missing:\n%s", w.Code, body)
+	}
+	if !strings.Contains(body, "&lt;bob&gt; more coffee") || !strings.Contains(body, "long long…") {
+		t.Errorf("excerpts not on one line and shortened:\n%s", body)
+	}
+	etag := w.Header().Get("ETag")
+
+	related.related, related.err = nil, errors.New("connection refused")
+	w = view()
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Related quotes") {
+		t.Errorf("failing related quotes: status = %d; want the page without them", w.Code)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag did not change with the related quotes")
+	}
+}
+
+func TestViewHandlerFormats(t *testing.T) {
+	repo := &mockRepo{
+		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
+			return &domain.Quote{ID: id, Quote: "<alice> coffee"}, nil
+		},
+	}
+	a := &API{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		quotes:      service.NewQuoteService(repo, service.Options{}),
+		comments:    service.NewCommentService(&mockCommentRepo{}, repo, service.Options{}),
+		relatedRepo: &mockRelatedRepo{},
+		tmpl:        template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+	view := func(accept, match string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/quote/3", nil)
+		r.Header.Set("Accept", accept)
+		if match != "" {
+			r.Header.Set("If-None-Match", match)
+		}
+		w := httptest.NewRecorder()
+		a.viewHandler(w, r)
+		return w
+	}
+
+	w := view("application/json", "")
+	var doc render.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || doc.ID != 3 || doc.Quote != "<alice> coffee" {
+		t.Fatalf("JSON body = %q (%v); want the quote document", w.Body.String(), err)
+	}
+	if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+		t.Errorf("Vary = %q; want Accept", w.Header().Values("Vary"))
+	}
+	etag := w.Header().Get("ETag")
+	if w = view("text/markdown", etag); w.Code != http.StatusOK {
+		t.Errorf("Markdown with the JSON ETag: status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag does not depend on the format")
+	}
+	if w = view("application/json", etag); w.Code != http.StatusNotModified {
+		t.Errorf("JSON with its own ETag: status = %d; want %d", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestViewHandlerMerged(t *testing.T) {
+	repo := &mockRepo{
+		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
+			return nil, domain.ErrNotFound
+		},
+		GetRedirectFunc: func(ctx context.Context, id int) (int, error) {
+			if id == 4 {
+				return 2, nil
+			}
+			return 0, domain.ErrNotFound
+		},
+	}
+	a := &API{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		quotes: service.NewQuoteService(repo, service.Options{}),
+		tmpl:   template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+
+	w := httptest.NewRecorder()
+	a.viewHandler(w, httptest.NewRequest(http.MethodGet, "/quote/4?format=json", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/quote/2?format=json" {
+		t.Errorf("merged quote: status = %d, Location = %q; want 301 to /quote/2?format=json", w.Code, w.Header().Get("Location"))
+	}
+	w = httptest.NewRecorder()
+	a.viewHandler(w, httptest.NewRequest(http.MethodGet, "/quote/5", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing quote: status = %d; want 404", w.Code)
+	}
+}
+
+type mockJobRepo struct {
+	domain.JobRepository
+	runs []*domain.JobRun
+}
+
+func (m *mockJobRepo) Runs(context.Context, int) ([]*domain.JobRun, error) { return m.runs, nil }
+
+func (m *mockJobRepo) Latest(context.Context) ([]*domain.JobRun, error) { return m.runs[:1], nil }
+
+func TestAdminJobsHandler(t *testing.T) {
+	started := time.Date(2026, time.March, 6, 12, 0, 0, 0, time.UTC)
+	jobs := &mockJobRepo{runs: []*domain.JobRun{
+		{Job: "related", Holder: "web-1:7", Started: started, Duration: 1500 * time.Millisecond, Status: domain.JobFailed, Error: "connection refused"},
+		{Job: "related", Holder: "web-2:9", Started: started.Add(-time.Hour), Status: domain.JobRunning},
+	}}
+	scheduler := schedule.NewScheduler(jobs, slog.Default(), time.UTC)
+	if err := scheduler.Add(schedule.Job{Name: "related", Spec: "@hourly"}); err != nil {
+		t.Fatal(err)
+	}
+	a := &API{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		scheduler: scheduler,
+		jobRepo:   jobs,
+		tmpl:      template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+	w := httptest.NewRecorder()
+	a.adminJobsHandler(w, httptest.NewRequest(http.MethodGet, "/admin/jobs", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	for _, want := range []string{"@hourly", "last failed Mar 6 12:00 UTC in 1.5s", "connection refused", "web-2:9", "running"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	a := &API{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		tmpl:   template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+	err := fmt.Errorf("quote 7: %w", domain.ErrNotFound)
+
+	tests := []struct {
+		name        string
+		header      map[string]string
+		contentType string
+		body        string
+	}{
+		{"page", nil, "text/html", "Back to the quotes"},
+		{"htmx", map[string]string{"HX-Request": "true"}, "text/html", `id="error-message"`},
+		{"json", map[string]string{"Accept": "application/json"}, "application/json", `"status":404`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/quote/7", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		a.fail(w, r, "fetching quote", err)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, http.StatusNotFound)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+			t.Errorf("%s: Content-Type = %q; want %s", tt.name, ct, tt.contentType)
+		}
+		if body := w.Body.String(); !strings.Contains(body, tt.body) || !strings.Contains(body, "quote 7: not found") {
+			t.Errorf("%s: body = %q; want it to contain %q and the message", tt.name, body, tt.body)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	a.fail(w, r, "fetching quote", errors.New("connection refused"))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "refused") {
+		t.Errorf("internal error: status %d, body %q; want 500 without the cause", w.Code, w.Body.String())
+	}
+	if w.Header().Get("HX-Retarget") != "#error-banner" {
+		t.Errorf("htmx error not retargeted to the error banner")
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		url, accept string
+		want        render.Format
+	}{
+		{"/qotd", "", "html"},
+		{"/qotd", "text/html,application/xhtml+xml", "html"},
+		{"/qotd", "application/json", "json"},
+		{"/qotd", "text/plain", "text"},
+		{"/qotd?format=text", "application/json", "text"},
+		{"/qotd?format=bogus", "application/json", "json"},
+		{"/quote/1?format=markdown", "", "markdown"},
+		{"/quote/1", "text/markdown", "markdown"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := responseFormat(r); got != tt.want {
+			t.Errorf("responseFormat(%q, Accept %q) = %q; want %q", tt.url, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestParseArchivePath(t *testing.T) {
+	tests := []struct {
+		year, month string
+		wantYear    int
+		wantMonth   time.Month
+		wantErr     bool
+	}{
+		{"", "", 0, 0, false},
+		{"2006", "", 2006, 0, false},
+		{"2006", "03", 2006, time.March, false},
+		{"2006", "12", 2006, time.December, false},
+		{"20x6", "", 0, 0, true},
+		{"0", "", 0, 0, true},
+		{"2006", "13", 0, 0, true},
+		{"2006", "0", 0, 0, true},
+	}
+	for _, tt := range tests {
+		year, month, err := parseArchivePath(tt.year, tt.month)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseArchivePath(%q, %q) error = %v; want error %v", tt.year, tt.month, err, tt.wantErr)
+			continue
+		}
+		if year != tt.wantYear || month != tt.wantMonth {
+			t.Errorf("parseArchivePath(%q, %q) = (%d, %v); want (%d, %v)", tt.year, tt.month, year, month, tt.wantYear, tt.wantMonth)
+		}
+	}
+}
+
+func TestToStatsViewRenders(t *testing.T) {
+	st := &domain.Stats{
+		Total:      4,
+		TotalVotes: 9,
+		ByMonth: []domain.PeriodCount{
+			{Year: 2006, Month: time.May, Count: 1},
+			{Year: 2006, Month: time.June, Count: 2},
+			{Year: 2007, Month: time.January, Count: 1},
+		},
+		Votes:       []domain.VoteBucket{{Min: -5, Max: -1, Count: 1}, {Min: 0, Max: 4, Count: 3}},
+		MostVoted:   []*domain.Quote{{ID: 1, Quote: "<a> hi", Votes: 5}},
+		TopSpeakers: []domain.SpeakerCount{{Nick: "a", Count: 1}},
+		GeneratedAt: time.Now(),
+	}
+	st.Activity[time.Sunday][23] = 4
+	v := (&API{}).toStatsView(context.Background(), st)
+
+	if len(v.Years) != 2 || v.Years[0].Count != 3 || v.Years[0].Percent != 100 || v.Years[1].Percent != 33 {
+		t.Errorf("Years = %+v; want 2006 with 3 (100%%) and 2007 with 1 (33%%)", v.Years)
+	}
+	if v.Heatmap[0].Label != "Mon" || v.Heatmap[6].Cells[23].Percent != 100 {
+		t.Errorf("Heatmap should start on Monday and end with the Sunday 23:00 peak")
+	}
+
+	tmpl := template.Must(template.ParseGlob("../../templates/*.html"))
+	if err := tmpl.ExecuteTemplate(io.Discard, "index.html", map[string]any{"Heading": "Statistics", "Stats": v}); err != nil {
+		t.Errorf("rendering statistics: %v", err)
+	}
+}
+
+func TestPostComment(t *testing.T) {
+	repo := &mockRepo{
+		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
+			return &domain.Quote{ID: id}, nil
+		},
+	}
+	a := &API{
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		comments: service.NewCommentService(&mockCommentRepo{}, repo, service.Options{}),
+		tmpl:     template.Must(template.ParseGlob("../../templates/*.html")),
+		markup:   render.AllMarkup,
+	}
+	post := func(form url.Values, htmx bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/quote/3/comments", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if htmx {
+			r.Header.Set("HX-Request", "true")
+		}
+		r.SetPathValue("id", "3")
+		w := httptest.NewRecorder()
+		a.postCommentHandler(w, r)
+		return w
+	}
+
+	w := post(url.Values{"author": {"bob"}, "body": {"first!"}}, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/quote/3#comment-1" {
+		t.Errorf("form post: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = post(url.Values{"parent_id": {"1"}, "body": {"`second`"}}, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("htmx post: status = %d; body %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`id="comment-1"`, `id="comment-2"`, "first!", "<code>second</code>", service.AnonymousAuthor} {
+		if !strings.Contains(body, want) {
+			t.Errorf("thread does not contain %q:\n%s", want, body)
+		}
+	}
+
+	if w := post(url.Values{"body": {" "}}, true); w.Code != http.StatusBadRequest {
+		t.Errorf("empty comment: status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestReactHandler(t *testing.T) {
+	repo := &mockRepo{
+		GetByIDFunc: func(ctx context.Context, id int) (*domain.Quote, error) {
+			return &domain.Quote{ID: id, Quote: "x"}, nil
+		},
+	}
+	reactions := &mockReactionRepo{given: map[reactionKey]bool{}}
+	a := &API{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		reactions: service.NewReactionService(reactions, repo, []domain.Reaction{{Name: "funny", Emoji: "😂"}}),
+		tmpl:      template.Must(template.ParseGlob("../../templates/*.html")),
+	}
+	handler := a.visitorMiddleware(http.HandlerFunc(a.reactHandler))
+	react := func(cookie *http.Cookie, reaction string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/react?id=5&reaction="+reaction, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := react(nil, "funny")
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != visitorCookieName {
+		t.Fatalf("first reaction: status = %d, cookies = %v", w.Code, cookies)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `aria-pressed="true"`) || !strings.Contains(body, "😂 <span") {
+		t.Errorf("card does not show the reaction as given:\n%s", body)
+	}
+
+	w = react(cookies[0], "funny")
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("visitor got a new ID despite its cookie")
+	}
+	if body := w.Body.String(); !strings.Contains(body, `aria-pressed="false"`) {
+		t.Errorf("second reaction did not take the first back:\n%s", body)
+	}
+
+	if w := react(cookies[0], "sad"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown reaction: status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// lagConn is a database that counts the queries sent to it. Inserts get
+// the next ID; reads find nothing.
+type lagConn struct {
+	queries int
+}
+
+type insertResult int64
+
+func (r insertResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r insertResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (c *lagConn) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	c.queries++
+	return insertResult(c.queries), nil
+}
+
+func (c *lagConn) QueryContext(context.Context, string, ...any) (repository.Rows, error) {
+	c.queries++
+	return emptyRows{}, nil
+}
+
+func (c *lagConn) QueryRowContext(ctx context.Context, query string, args ...any) repository.Row {
+	c.queries++
+	return emptyRows{}
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Next() bool                 { return false }
+func (emptyRows) Scan(...any) error          { return sql.ErrNoRows }
+func (emptyRows) Columns() ([]string, error) { return nil, nil }
+func (emptyRows) Err() error                 { return nil }
+func (emptyRows) Close() error               { return nil }
+
+func TestAddQuoteRedirectReadsPrimary(t *testing.T) {
+	primary, replica := &lagConn{}, &lagConn{}
+	// server returns one of the processes serving the site, each with its
+	// own cache.
+	server := func() http.Handler {
+		repo := cache.NewQuoteRepository(repository.NewQuoteRepository(primary, replica), cache.NewLRU(100), time.Minute)
+		a := &API{
+			logger:    slog.Default(),
+			events:    events.NewHub(1),
+			quoteRepo: repo,
+			tmpl:      template.Must(template.New("index.html").Parse(`{{len .Quotes}} quotes`)),
+			pageSize:  10,
+		}
+		a.quotes = service.NewQuoteService(repo, service.Options{Filter: spam.NewPipeline(nil), Listener: liveUpdates{a}})
+		mux := http.NewServeMux()
+		mux.HandleFunc("/add", a.addQuote)
+		mux.Handle("/{$}", a.listHandler("", a.quotes.Latest))
+		return readYourWrites(mux)
+	}
+	// reads returns how many queries a request to h sent to each database.
+	reads := func(h http.Handler, r *http.Request) (fromPrimary, fromReplica int) {
+		p, q := primary.queries, replica.queries
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d; want %d", r.URL, w.Code, http.StatusOK)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("GET %s cookies = %v; want none", r.URL, w.Result().Cookies())
+		}
+		return primary.queries - p, replica.queries - q
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader("quote=hello+world"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server().ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("POST /add status = %d; want %d", w.Code, http.StatusSeeOther)
+	}
+	var wrote *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == wroteCookieName {
+			wrote = c
+		}
+	}
+	if wrote == nil || wrote.MaxAge <= 0 {
+		t.Fatalf("POST /add cookies = %v; want a short-lived %s cookie", w.Result().Cookies(), wroteCookieName)
+	}
+
+	// The redirect may reach another process, whose cache knows nothing of
+	// the write: the cookie sends its reads to the primary.
+	r = httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil)
+	r.AddCookie(wrote)
+	if p, q := reads(server(), r); p == 0 || q != 0 {
+		t.Errorf("GET / after adding read %d queries from the primary and %d from the replica; want only the primary", p, q)
+	}
+	if p, q := reads(server(), httptest.NewRequest(http.MethodGet, "/", nil)); p != 0 || q == 0 {
+		t.Errorf("GET / by another visitor read %d queries from the primary and %d from the replica; want only the replica", p, q)
+	}
 }
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// Period is a link to a year or month of the archive.
+type Period struct {
+	Label   string
+	URL     string
+	Count   int
+	Current bool
+}
+
+// archiveHandler serves /archive (years), /archive/{year} (its months) and
+// /archive/{year}/{month} (the quotes of that month, paginated).
+func (a *API) archiveHandler(w http.ResponseWriter, r *http.Request) {
+	year, month, err := parseArchivePath(r.PathValue("year"), r.PathValue("month"))
+	if err != nil {
+		a.error(w, r, http.StatusNotFound, "no such archive period", nil)
+		return
+	}
+	ctx := r.Context()
+
+	if year == 0 {
+		counts, err := a.quotes.CountByYear(ctx)
+		if err != nil {
+			a.fail(w, r, "counting quotes", err)
+			return
+		}
+		a.renderPage(w, r, map[string]any{
+			"Heading": "Archive",
+			"Periods": toPeriods(counts, 0),
+		})
+		return
+	}
+
+	counts, err := a.quotes.CountByMonth(ctx, year)
+	if err != nil {
+		a.fail(w, r, "counting quotes", err)
+		return
+	}
+	data := map[string]any{
+		"Heading": fmt.Sprintf("Archive · %d", year),
+		"Periods": toPeriods(counts, month),
+	}
+	if month != 0 {
+		from := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		page, err := a.quotes.Month(ctx, year, month, r.URL.Query().Get("cursor"), a.pageSize)
+		if err != nil {
+			a.fail(w, r, "fetching quotes", err)
+			return
+		}
+		etag := a.quotesETag(r.Context(), page.Quotes, archiveURL(year, month), page.Prev, page.Next, fmt.Sprint(counts))
+		if notModified(w, r, etag, a.lastModified()) {
+			return
+		}
+		data["Heading"] = "Archive · " + from.Format("January 2006")
+		data["Quotes"] = a.toViewModels(r.Context(), page.Quotes)
+		data["PrevCursor"] = page.Prev
+		data["NextCursor"] = page.Next
+		data["Endpoint"] = archiveURL(year, month)
+	}
+	a.renderPage(w, r, data)
+}
+
+// parseArchivePath validates the year and month path values. Either may be
+// empty, in which case it is returned as zero.
+func parseArchivePath(yearStr, monthStr string) (int, time.Month, error) {
+	if yearStr == "" {
+		return 0, 0, nil
+	}
+	year, err := strconv.Atoi(yearStr)
+	if err != nil || year < 1 || year > 9999 {
+		return 0, 0, fmt.Errorf("invalid year %q", yearStr)
+	}
+	if monthStr == "" {
+		return year, 0, nil
+	}
+	m, err := strconv.Atoi(monthStr)
+	if err != nil || m < 1 || m > 12 {
+		return 0, 0, fmt.Errorf("invalid month %q", monthStr)
+	}
+	return year, time.Month(m), nil
+}
+
+func toPeriods(counts []domain.PeriodCount, current time.Month) []Period {
+	periods := make([]Period, len(counts))
+	for i, c := range counts {
+		if c.Month == 0 {
+			periods[i] = Period{Label: strconv.Itoa(c.Year), URL: archiveURL(c.Year, 0), Count: c.Count}
+			continue
+		}
+		periods[i] = Period{
+			Label:   c.Month.String(),
+			URL:     archiveURL(c.Year, c.Month),
+			Count:   c.Count,
+			Current: c.Month == current,
+		}
+	}
+	return periods
+}
+
+func archiveURL(year int, month time.Month) string {
+	if month == 0 {
+		return fmt.Sprintf("/archive/%d", year)
+	}
+	return fmt.Sprintf("/archive/%d/%02d", year, month)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "198.51.100.7:1234", nil, "198.51.100.7"},
+		{"untrusted peer ignores headers", "198.51.100.7:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "198.51.100.7"},
+		{"xff", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"xff skips trusted hops", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "6.6.6.6, 203.0.113.9, 10.9.9.9"}, "203.0.113.9"},
+		{"xff all trusted", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "10.4.4.4, 192.0.2.1"}, "10.4.4.4"},
+		{"xff garbage", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "nonsense"}, "10.1.2.3"},
+		{"real ip", "192.0.2.1:80", map[string]string{"X-Real-IP": "203.0.113.9"}, "203.0.113.9"},
+		{"forwarded", "10.1.2.3:80", map[string]string{
+			"Forwarded":       `for=198.51.100.1;proto=https, for="[2001:db8:cafe::17]:4711";by=10.1.2.3`,
+			"X-Forwarded-For": "6.6.6.6",
+		}, "2001:db8:cafe::17"},
+		{"forwarded obfuscated", "10.1.2.3:80", map[string]string{"Forwarded": "for=_hidden"}, "10.1.2.3"},
+		{"mapped v4", "[::ffff:10.1.2.3]:80", map[string]string{"X-Forwarded-For": "::ffff:203.0.113.9"}, "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := resolveClientIP(r, trusted).String(); got != tt.want {
+			t.Errorf("%s: resolveClientIP() = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := parseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("parseTrustedProxies(bad CIDR) = nil error; want error")
+	}
+	if _, err := parseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("parseTrustedProxies(hostname) = nil error; want error")
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/render"
+)
+
+// favouriteHandler stars a quote for the visitor, or unstars it, and
+// returns the updated card.
+func (a *API) favouriteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		a.error(w, r, http.StatusMethodNotAllowed, "use POST to keep a favourite", nil)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+		return
+	}
+	r, owner, ok := a.collectionOwner(w, r)
+	if !ok {
+		return
+	}
+	quote, err := a.collections.ToggleFavourite(r.Context(), owner, id)
+	if err != nil {
+		a.fail(w, r, "keeping favourite", err)
+		return
+	}
+	a.activity.Store(time.Now().UnixNano())
+	vm := a.toViewModels(r.Context(), []*domain.Quote{quote})[0]
+	a.render(w, r, "quote-card.html", vm)
+}
+
+// favouritesHandler sends visitors to their favourites collection.
+func (a *API) favouritesHandler(w http.ResponseWriter, r *http.Request) {
+	owner, err := a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		a.fail(w, r, "fetching favourites", err)
+		return
+	}
+	c, err := a.collections.Favourites(r.Context(), owner)
+	if errors.Is(err, domain.ErrNotFound) {
+		a.renderPage(w, r, map[string]any{"Heading": "No favourites yet: star a quote to keep it here."})
+		return
+	}
+	if err != nil {
+		a.fail(w, r, "fetching favourites", err)
+		return
+	}
+	http.Redirect(w, r, collectionURL(c.Slug), http.StatusSeeOther)
+}
+
+// collectionsHandler lists the visitor's collections and creates new ones
+// on POST.
+func (a *API) collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r, owner, ok := a.collectionOwner(w, r)
+		if !ok {
+			return
+		}
+		c, err := a.collections.Create(r.Context(), owner, r.PostFormValue("name"))
+		if err != nil {
+			a.fail(w, r, "creating collection", err)
+			return
+		}
+		a.activity.Store(time.Now().UnixNano())
+		http.Redirect(w, r, collectionURL(c.Slug), http.StatusSeeOther)
+		return
+	}
+	owner, err := a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		a.fail(w, r, "fetching collections", err)
+		return
+	}
+	mine, err := a.collections.Mine(r.Context(), owner)
+	if err != nil {
+		a.fail(w, r, "fetching collections", err)
+		return
+	}
+	list := &Collections{CSRFToken: csrfToken(r.Context())}
+	for _, c := range mine {
+		list.Items = append(list.Items, toCollectionView(c, true))
+	}
+	a.renderPage(w, r, map[string]any{"Collections": list})
+}
+
+// addToCollectionHandler adds a quote to the collection picked on its page.
+func (a *API) addToCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := strconv.Atoi(r.PostFormValue("quote_id"))
+	if err != nil {
+		a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+		return
+	}
+	owner, err := a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		a.fail(w, r, "adding to collection", err)
+		return
+	}
+	slug := r.PostFormValue("slug")
+	if err := a.collections.Add(r.Context(), owner, slug, quoteID); err != nil {
+		a.fail(w, r, "adding to collection", err)
+		return
+	}
+	a.activity.Store(time.Now().UnixNano())
+	http.Redirect(w, r, collectionURL(slug), http.StatusSeeOther)
+}
+
+// collectionHandler shows a collection like any other listing, or exports
+// all of it with ?format=text, markdown or json.
+func (a *API) collectionHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := a.collections.Get(r.Context(), r.PathValue("slug"))
+	if err != nil {
+		a.fail(w, r, "fetching collection", err)
+		return
+	}
+	if f := responseFormat(r); f != render.FormatHTML {
+		quotes, err := a.collections.All(r.Context(), c)
+		if err != nil {
+			a.fail(w, r, "exporting collection", err)
+			return
+		}
+		w.Header().Set("Content-Type", f.ContentType())
+		_ = render.WriteList(w, f, c.Name, quotes)
+		return
+	}
+
+	owner, err := a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		a.fail(w, r, "fetching collection", err)
+		return
+	}
+	page, err := a.collections.Quotes(r.Context(), c, r.URL.Query().Get("cursor"), a.pageSize)
+	if err != nil {
+		a.fail(w, r, "fetching collection", err)
+		return
+	}
+	view := toCollectionView(c, owner != "" && owner == c.Owner)
+	view.CSRFToken = csrfToken(r.Context())
+	edit := ""
+	if view.Owned {
+		edit = c.Slug
+	}
+	w.Header().Set("Vary", "Accept")
+	a.renderList(w, r, "", page, map[string]any{"Collection": view}, edit)
+}
+
+// editCollectionHandler applies a change to a collection of the visitor:
+// rename, delete, or remove, up and down for the quote in quote_id.
+func (a *API) editCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+	owner, err := a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		a.fail(w, r, "changing collection", err)
+		return
+	}
+	quoteID := func() (int, error) {
+		return strconv.Atoi(r.PostFormValue("quote_id"))
+	}
+	next := collectionURL(slug)
+	switch action := r.PostFormValue("action"); action {
+	case "rename":
+		err = a.collections.Rename(r.Context(), owner, slug, r.PostFormValue("name"))
+	case "delete":
+		err = a.collections.Delete(r.Context(), owner, slug)
+		next = "/collections"
+	case "remove", "up", "down":
+		var id int
+		if id, err = quoteID(); err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+			return
+		}
+		switch action {
+		case "remove":
+			err = a.collections.Remove(r.Context(), owner, slug, id)
+		case "up":
+			err = a.collections.Move(r.Context(), owner, slug, id, -1)
+		case "down":
+			err = a.collections.Move(r.Context(), owner, slug, id, 1)
+		}
+	default:
+		a.error(w, r, http.StatusBadRequest, "unknown collection action", nil)
+		return
+	}
+	if err != nil {
+		a.fail(w, r, "changing collection", err)
+		return
+	}
+	a.activity.Store(time.Now().UnixNano())
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// linkAccountHandler ties the visitor to the account it authenticated as,
+// so its collections follow it to every browser linked the same way.
+func (a *API) linkAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		a.error(w, r, http.StatusMethodNotAllowed, "use POST to link an account", nil)
+		return
+	}
+	username, _, _ := r.BasicAuth()
+	user, err := a.userRepo.GetByUsername(r.Context(), username)
+	if err != nil {
+		a.fail(w, r, "linking account", err)
+		return
+	}
+	r, err = ensureVisitor(w, r)
+	if err != nil {
+		a.error(w, r, http.StatusInternalServerError, "generating visitor ID", err)
+		return
+	}
+	if err := a.collections.Link(r.Context(), visitor(r.Context()), user.ID); err != nil {
+		a.fail(w, r, "linking account", err)
+		return
+	}
+	a.activity.Store(time.Now().UnixNano())
+	http.Redirect(w, r, "/collections", http.StatusSeeOther)
+}
+
+// collectionOwner returns r with a visitor ID, handing one out if needed,
+// and the owner of that visitor's collections. It has replied with an error
+// if ok is false.
+func (a *API) collectionOwner(w http.ResponseWriter, r *http.Request) (_ *http.Request, owner string, ok bool) {
+	r, err := ensureVisitor(w, r)
+	if err != nil {
+		a.error(w, r, http.StatusInternalServerError, "generating visitor ID", err)
+		return r, "", false
+	}
+	owner, err = a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		a.fail(w, r, "fetching collections", err)
+		return r, "", false
+	}
+	return r, owner, true
+}
+
+func collectionURL(slug string) string {
+	return "/c/" + slug
+}
+
+func toCollectionView(c *domain.Collection, owned bool) Collection {
+	return Collection{
+		Name:       c.Name,
+		Slug:       c.Slug,
+		URL:        collectionURL(c.Slug),
+		Favourites: c.Favourites,
+		Size:       c.Size,
+		Owned:      owned,
+	}
+}
+
+// favourited returns which of the quotes the visitor in ctx keeps as
+// favourites.
+func (a *API) favourited(ctx context.Context, quotes []*domain.Quote) (map[int]bool, error) {
+	owner, err := a.collections.Owner(ctx, visitor(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return a.collections.Favourited(ctx, owner, quotes)
+}
+
+// addTo returns the form for adding a quote to one of the visitor's named
+// collections, or nil if the visitor has none.
+func (a *API) addTo(r *http.Request, quoteID int) (*AddTo, error) {
+	if a.collections == nil {
+		return nil, nil
+	}
+	owner, err := a.collections.Owner(r.Context(), visitor(r.Context()))
+	if err != nil {
+		return nil, err
+	}
+	mine, err := a.collections.Mine(r.Context(), owner)
+	if err != nil {
+		return nil, err
+	}
+	form := &AddTo{QuoteID: quoteID, CSRFToken: csrfToken(r.Context())}
+	for _, c := range mine {
+		if !c.Favourites {
+			form.Collections = append(form.Collections, toCollectionView(c, true))
+		}
+	}
+	if len(form.Collections) == 0 {
+		return nil, nil
+	}
+	return form, nil
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/render"
+	"github.com/hionay/quotes/internal/service"
+)
+
+const (
+	// maxCommentDepth is how deep replies are indented; deeper replies are
+	// listed flat under their ancestor at this depth.
+	maxCommentDepth = 4
+	// moderationPageSize is how many comments /admin/comments lists.
+	moderationPageSize = 50
+)
+
+// postCommentHandler adds a comment to the discussion of a quote. htmx
+// requests get the updated thread back; plain form posts are redirected
+// to the new comment.
+func (a *API) postCommentHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+		return
+	}
+	var parentID int
+	if v := r.PostFormValue("parent_id"); v != "" {
+		if parentID, err = strconv.Atoi(v); err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid parent comment ID", err)
+			return
+		}
+	}
+	c, err := a.comments.Post(r.Context(), service.CommentSubmission{
+		QuoteID:   quoteID,
+		ParentID:  parentID,
+		Author:    r.PostFormValue("author"),
+		Body:      r.PostFormValue("body"),
+		IP:        clientIP(r),
+		Challenge: r.PostFormValue("pow_challenge"),
+		Nonce:     r.PostFormValue("pow_nonce"),
+	})
+	if err != nil {
+		a.fail(w, r, "posting comment", err)
+		return
+	}
+	a.activity.Store(time.Now().UnixNano())
+
+	if r.Header.Get("HX-Request") != "true" {
+		http.Redirect(w, r, fmt.Sprintf("/quote/%d#comment-%d", quoteID, c.ID), http.StatusSeeOther)
+		return
+	}
+	thread, err := a.thread(r, quoteID)
+	if err != nil {
+		a.fail(w, r, "fetching comments", err)
+		return
+	}
+	a.render(w, r, "comments.html", thread)
+}
+
+// thread returns the template data of a quote's discussion, with the
+// difficulty of the proof of work for its form.
+func (a *API) thread(r *http.Request, quoteID int) (*Thread, error) {
+	comments, err := a.comments.Thread(r.Context(), quoteID, false)
+	if err != nil {
+		return nil, err
+	}
+	t := &Thread{
+		QuoteID:   quoteID,
+		CSRFToken: csrfToken(r.Context()),
+	}
+	t.Comments, t.Count = a.toCommentViews(comments, 0)
+	if a.pow != nil {
+		t.PowDifficulty = a.pow.Difficulty()
+	}
+	return t, nil
+}
+
+// toCommentViews renders a comment tree and counts its visible comments.
+// Replies below maxCommentDepth are flattened into their ancestor's list.
+func (a *API) toCommentViews(comments []*domain.Comment, depth int) ([]Comment, int) {
+	var views []Comment
+	count := 0
+	for _, c := range comments {
+		v := a.toCommentView(c)
+		if !c.Hidden {
+			count++
+		}
+		replies, n := a.toCommentViews(c.Replies, depth+1)
+		count += n
+		if depth+1 < maxCommentDepth {
+			v.Replies = replies
+			views = append(views, v)
+		} else {
+			views = append(views, v)
+			views = append(views, replies...)
+		}
+	}
+	return views, count
+}
+
+func (a *API) toCommentView(c *domain.Comment) Comment {
+	return Comment{
+		ID:       c.ID,
+		QuoteID:  c.QuoteID,
+		ParentID: c.ParentID,
+		Author:   c.Author,
+		Body:     render.HTML(c.Body, a.markup),
+		Date:     c.Date,
+		Hidden:   c.Hidden,
+	}
+}
+
+// adminCommentsHandler lists the newest comments for moderation and hides,
+// shows or deletes one on POST.
+func (a *API) adminCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{"CSRFToken": csrfToken(r.Context())}
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.PostFormValue("id"))
+		if err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid comment ID", err)
+			return
+		}
+		var verb string
+		switch action := r.PostFormValue("action"); action {
+		case "hide", "show":
+			err = a.comments.SetHidden(r.Context(), id, action == "hide")
+			verb = map[string]string{"hide": "hidden", "show": "shown again"}[action]
+		case "delete":
+			err = a.comments.Delete(r.Context(), id)
+			verb = "deleted with its replies"
+		default:
+			a.error(w, r, http.StatusBadRequest, "unknown moderation action", nil)
+			return
+		}
+		if err != nil {
+			a.fail(w, r, "moderating comment", err)
+			return
+		}
+		a.activity.Store(time.Now().UnixNano())
+		data["Message"] = fmt.Sprintf("Comment %d was %s.", id, verb)
+	}
+	comments, err := a.comments.Recent(r.Context(), moderationPageSize)
+	if err != nil {
+		a.fail(w, r, "fetching comments", err)
+		return
+	}
+	views := make([]Comment, len(comments))
+	for i, c := range comments {
+		views[i] = a.toCommentView(c)
+	}
+	data["Comments"] = views
+	a.render(w, r, "admin-comments.html", data)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// etagEpoch changes the ETags on every start, so a deploy with new
+// templates isn't answered with 304s for pages rendered by the old ones.
+var etagEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// quotesETag returns a weak ETag for a page made of quotes and any other
+// values it shows, such as pagination cursors. Comments and reactions are
+// covered by the time they last changed, and the visitor's own reactions by
+// their ID. The CSRF token the page carries is covered too, so a copy with
+// a token the visitor no longer has isn't reused; proof-of-work challenges
+// are fetched when a form is sent, not carried. Pages shown while the
+// database is down differ too, since they carry a banner.
+func (a *API) quotesETag(ctx context.Context, quotes []*domain.Quote, extra ...string) string {
+	h := sha256.New()
+	fmt.Fprint(h, etagEpoch, "\x00", a.activity.Load(), "\x00", visitor(ctx), "\x00", csrfToken(ctx), "\x00", a.readOnly())
+	for _, q := range quotes {
+		fmt.Fprintf(h, "\x00%d\x00%d\x00%d\x00%s\x00%s", q.ID, q.Likes, q.Votes, q.Quote, q.Comment)
+	}
+	for _, e := range extra {
+		fmt.Fprintf(h, "\x00%s", e)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// lastModified returns when the quotes, comments or reactions last changed,
+// if the repository keeps track of it. It only knows of the changes made
+// by this process, so none is returned when reading from replicas, which
+// means other instances share the database: pages are then revalidated by
+// their ETags alone.
+func (a *API) lastModified() time.Time {
+	lm, ok := a.quoteRepo.(interface{ LastModified() time.Time })
+	if !ok || a.replicated {
+		return time.Time{}
+	}
+	t := lm.LastModified()
+	if c := a.activity.Load(); c != 0 && time.Unix(0, c).After(t) {
+		t = time.Unix(0, c)
+	}
+	return t
+}
+
+// notModified sets the validators of a response and reports whether the
+// client's copy is still current, in which case it has replied with 304.
+// Browsers are asked to revalidate on every use, and to keep the fragments
+// htmx asks for apart from the full pages.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "no-cache")
+	h.Add("Vary", "HX-Request")
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	match := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		match = etagMatches(inm, etag)
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		match = err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	if match {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return match
+}
+
+// etagMatches implements the weak comparison of If-None-Match.
+func etagMatches(header, etag string) bool {
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
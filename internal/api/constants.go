@@ -3,10 +3,48 @@ package api
 import "time"
 
 const (
-	apiReadTimeout     = 10 * time.Second
-	apiWriteTimeout    = 30 * time.Second
-	apiIdleTimeout     = 120 * time.Second
-	apiShutdownTimeout = 30 * time.Second
+	classifierMinDocs   = 20
+	classifierThreshold = 0.95
+	// classifierSaveInterval is how often the spam model is written to
+	// disk when it has changed.
+	classifierSaveInterval = 5 * time.Minute
+	powChallengeTTL        = time.Hour
 )
 
-const defaultLimit = 10
+const (
+	csrfCookieName = "quotes_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+	csrfTokenBytes = 32
+)
+
+const (
+	randomHistoryCookie = "quotes_recent"
+	randomHistorySize   = 20
+)
+
+// wroteCookieName marks a visitor who changed a quote in the last
+// repository.ReplicaLag, whose pages are read from the primary.
+const wroteCookieName = "quotes_wrote"
+
+const (
+	visitorCookieName = "quotes_visitor"
+	visitorIDBytes    = 16
+	visitorCookieAge  = 365 * 24 * time.Hour
+)
+
+// readOnlyMessage answers requests that need the database while it is down.
+const readOnlyMessage = "the database is unavailable, so the site is read-only until it is back"
+
+const (
+	eventBuffer    = 16
+	eventHeartbeat = 30 * time.Second
+)
+
+type ctxKey int
+
+const (
+	csrfTokenKey ctxKey = iota
+	clientIPKey
+	visitorKey
+)
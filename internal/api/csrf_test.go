@@ -0,0 +1,67 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	const token = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	a := &API{logger: slog.Default()}
+	var seen string
+	h := a.csrfMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = csrfToken(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		form   string
+		want   int
+	}{
+		{"get without cookie", http.MethodGet, "", "", "", http.StatusOK},
+		{"post without cookie", http.MethodPost, "", token, "", http.StatusForbidden},
+		{"post without token", http.MethodPost, token, "", "", http.StatusForbidden},
+		{"post with wrong token", http.MethodPost, token, strings.Repeat("B", len(token)), "", http.StatusForbidden},
+		{"post with header token", http.MethodPost, token, token, "", http.StatusOK},
+		{"post with form token", http.MethodPost, token, "", "csrf_token=" + token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		seen = ""
+		r := httptest.NewRequest(tt.method, "/add", strings.NewReader(tt.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tt.cookie})
+		}
+		if tt.header != "" {
+			r.Header.Set(csrfHeaderName, tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && seen == "" {
+			t.Errorf("%s: expected token in request context", tt.name)
+		}
+	}
+}
+
+func TestCSRFMiddlewareIssuesCookie(t *testing.T) {
+	a := &API{logger: slog.Default()}
+	h := a.csrfMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookieName || cookies[0].Value == "" {
+		t.Fatalf("cookies = %v; want one %s cookie", cookies, csrfCookieName)
+	}
+	if !cookies[0].HttpOnly {
+		t.Error("expected CSRF cookie to be HttpOnly")
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// adminDuplicatesHandler lists the groups of near-duplicate quotes and, on
+// POST, merges the quotes in id into the one in keep.
+func (a *API) adminDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{"CSRFToken": csrfToken(r.Context())}
+	if r.Method == http.MethodPost {
+		keep, err := strconv.Atoi(r.PostFormValue("keep"))
+		if err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+			return
+		}
+		ids := make([]int, 0, len(r.PostForm["id"]))
+		for _, v := range r.PostForm["id"] {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+				return
+			}
+			ids = append(ids, id)
+		}
+		q, err := a.quotes.Merge(r.Context(), keep, ids)
+		if err != nil {
+			a.fail(w, r, "merging quotes", err)
+			return
+		}
+		a.activity.Store(time.Now().UnixNano())
+		data["Message"] = fmt.Sprintf("Merged into quote %d, which now has %d likes from %d votes.", q.ID, q.Likes, q.Votes)
+	}
+	groups, err := a.quotes.Duplicates(r.Context())
+	if err != nil {
+		a.fail(w, r, "finding duplicates", err)
+		return
+	}
+	clusters := make([][]QuoteLink, len(groups))
+	for i, g := range groups {
+		clusters[i] = toQuoteLinks(g)
+	}
+	data["Clusters"] = clusters
+	a.render(w, r, "admin-duplicates.html", data)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/spam"
+)
+
+// httpStatus maps an error to the status of the response reporting it.
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	if rej, ok := spam.AsRejection(err); ok {
+		if rej.Code == spam.CodeRateLimited {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// fail reports err with the status httpStatus maps it to. Client errors
+// are shown as they are, since their messages come from the repositories
+// and filters; anything else is logged and shown as msg. The database
+// being down isn't logged each time, since the connection logs it once.
+func (a *API) fail(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	status := httpStatus(err)
+	switch rej, ok := spam.AsRejection(err); {
+	case ok:
+		a.error(w, r, status, rej.Reason, nil)
+	case status == http.StatusServiceUnavailable:
+		a.error(w, r, status, readOnlyMessage, nil)
+	case status < http.StatusInternalServerError:
+		a.error(w, r, status, err.Error(), nil)
+	default:
+		a.error(w, r, status, msg, err)
+	}
+}
+
+// error writes an error response in the form the client asked for: JSON,
+// a fragment for htmx to show in the page's error banner, or a full page.
+// err, if set, is logged and never shown.
+func (a *API) error(w http.ResponseWriter, r *http.Request, status int, msg string, err error) {
+	if err != nil {
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		a.logger.Log(r.Context(), level, msg, slog.Int("status", status), slog.Any("error", err))
+	}
+
+	h := w.Header()
+	h.Del("ETag")
+	h.Del("Last-Modified")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if responseFormat(r) == "json" {
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": msg, "status": status})
+		return
+	}
+
+	tpl := "error.html"
+	if r.Header.Get("HX-Request") == "true" {
+		tpl = "error-fragment.html"
+		h.Set("HX-Retarget", "#error-banner")
+		h.Set("HX-Reswap", "innerHTML")
+		h.Set("HX-Reselect", "#error-message")
+	}
+	var buf bytes.Buffer
+	if a.tmpl == nil || a.tmpl.Lookup(tpl) == nil || a.tmpl.ExecuteTemplate(&buf, tpl, map[string]any{
+		"Status":  status,
+		"Title":   http.StatusText(status),
+		"Message": msg,
+	}) != nil {
+		http.Error(w, msg, status)
+		return
+	}
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// notFoundHandler answers requests no other route matches.
+func (a *API) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	a.error(w, r, http.StatusNotFound, "page not found", nil)
+}
+
+// render executes tpl into a buffer first, so a failing template still
+// gets a proper error response.
+func (a *API) render(w http.ResponseWriter, r *http.Request, tpl string, data any) {
+	var buf bytes.Buffer
+	if err := a.tmpl.ExecuteTemplate(&buf, tpl, data); err != nil {
+		a.error(w, r, http.StatusInternalServerError, "rendering "+tpl, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/events"
+)
+
+// eventsHandler streams live updates as Server-Sent Events. Pages consume
+// them with the htmx SSE extension: "likes-{id}" carries a quote's new
+// likes count and "quote" the card of a newly added quote.
+func (a *API) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	sub := a.events.Subscribe()
+	if sub == nil {
+		a.error(w, r, http.StatusServiceUnavailable, "shutting down", nil)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout would end the stream.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		a.error(w, r, http.StatusInternalServerError, "streaming not supported", err)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes e in the text/event-stream format, one data line per
+// line of its data.
+func writeEvent(w io.Writer, e events.Event) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", e.Name)
+	for line := range strings.Lines(e.Data) {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimRight(line, "\r\n"))
+	}
+	b.WriteString("\n")
+	io.WriteString(w, b.String())
+}
+
+// liveUpdates pushes the changes reported by the quote service to the event
+// stream.
+type liveUpdates struct {
+	*API
+}
+
+func (u liveUpdates) QuoteVoted(q *domain.Quote) {
+	a := u.API
+	a.events.Publish(events.Event{
+		Name: fmt.Sprintf("likes-%d", q.ID),
+		Data: fmt.Sprintf("Likes: %d", q.Likes),
+	})
+}
+
+func (u liveUpdates) QuoteAdded(q *domain.Quote) {
+	a := u.API
+	if a.events.Len() == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if err := a.tmpl.ExecuteTemplate(&buf, "quote-card.html", a.toViewModels(context.Background(), []*domain.Quote{q})[0]); err != nil {
+		a.logger.Error("Failed to render quote event", slog.Any("error", err))
+		return
+	}
+	a.events.Publish(events.Event{Name: "quote", Data: buf.String()})
+}
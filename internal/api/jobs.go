@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hionay/quotes/internal/config"
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/schedule"
+)
+
+// jobHistorySize is how many runs /admin/jobs lists.
+const jobHistorySize = 50
+
+// Job is a background job on /admin/jobs.
+type Job struct {
+	Name    string
+	Spec    string
+	Local   bool
+	Next    time.Time
+	Running bool
+	Last    *JobRun
+}
+
+// JobRun is a run of a background job on /admin/jobs.
+type JobRun struct {
+	Job      string
+	Holder   string
+	Started  time.Time
+	Duration string
+	Status   string
+	Error    string
+}
+
+// Scheduler returns the scheduler of background jobs, which the server
+// adds its jobs to and runs.
+func (a *API) Scheduler() *schedule.Scheduler {
+	return a.scheduler
+}
+
+// Jobs returns the background jobs of the API: choosing the Quote of the
+// Day at midnight, keeping the statistics and caches of this replica warm
+// and saving its spam classifier.
+func (a *API) Jobs() []schedule.Job {
+	return a.jobs
+}
+
+func (a *API) backgroundJobs(cfg *config.Config) []schedule.Job {
+	jobs := []schedule.Job{{Name: "qotd", Spec: "@daily", Run: a.chooseQOTD}}
+	if ttl := cfg.StatsCacheTTL(); ttl > 0 {
+		jobs = append(jobs, schedule.Job{Name: "stats", Spec: schedule.Every(ttl), Run: a.stats.Refresh, Local: true})
+	}
+	jobs = append(jobs, schedule.Job{Name: "speakers", Spec: "@hourly", Run: a.stats.RefreshSpeakers, Local: true})
+	if cfg.CacheSize() > 0 {
+		jobs = append(jobs, schedule.Job{Name: "warm-caches", Spec: schedule.Every(cfg.CacheTTL()), Run: a.warmCaches, Local: true})
+	}
+	if cfg.SpamModelPath() != "" {
+		jobs = append(jobs, schedule.Job{Name: "spam-model", Spec: schedule.Every(classifierSaveInterval), Run: a.saveSpamModel, Local: true})
+	}
+	return jobs
+}
+
+// chooseQOTD picks the Quote of the Day as the day starts, instead of on
+// the first request for it.
+func (a *API) chooseQOTD(ctx context.Context) error {
+	_, err := a.qotd.For(ctx, a.qotd.Today())
+	return err
+}
+
+// saveSpamModel writes what the spam classifier has learnt to disk, so
+// that training doesn't write the file for every submission.
+func (a *API) saveSpamModel(context.Context) error {
+	return a.classifier.Save()
+}
+
+// warmCaches loads the first pages of the busiest listings and the Quote
+// of the Day into the cache before visitors ask for them.
+func (a *API) warmCaches(ctx context.Context) error {
+	if _, err := a.quoteRepo.GetLatest(ctx, "", a.pageSize); err != nil {
+		return err
+	}
+	if _, err := a.quoteRepo.GetTop(ctx, "", a.pageSize); err != nil {
+		return err
+	}
+	return a.chooseQOTD(ctx)
+}
+
+// adminJobsHandler lists the background jobs with their last runs, and the
+// recent runs of every job.
+func (a *API) adminJobsHandler(w http.ResponseWriter, r *http.Request) {
+	latest, err := a.jobRepo.Latest(r.Context())
+	if err != nil {
+		a.fail(w, r, "fetching job runs", err)
+		return
+	}
+	runs, err := a.jobRepo.Runs(r.Context(), jobHistorySize)
+	if err != nil {
+		a.fail(w, r, "fetching job runs", err)
+		return
+	}
+	last := make(map[string]*JobRun, len(latest))
+	for _, run := range latest {
+		v := toJobRunView(run)
+		last[run.Job] = &v
+	}
+	var jobs []Job
+	for _, s := range a.scheduler.Jobs() {
+		jobs = append(jobs, Job{
+			Name:    s.Name,
+			Spec:    s.Spec,
+			Local:   s.Local,
+			Next:    s.Next,
+			Running: s.Running,
+			Last:    last[s.Name],
+		})
+	}
+	views := make([]JobRun, len(runs))
+	for i, run := range runs {
+		views[i] = toJobRunView(run)
+	}
+	a.render(w, r, "admin-jobs.html", map[string]any{"Jobs": jobs, "Runs": views})
+}
+
+func toJobRunView(run *domain.JobRun) JobRun {
+	v := JobRun{
+		Job:     run.Job,
+		Holder:  run.Holder,
+		Started: run.Started,
+		Status:  string(run.Status),
+		Error:   run.Error,
+	}
+	if run.Status != domain.JobRunning {
+		v.Duration = run.Duration.Round(time.Millisecond).String()
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/render"
+)
+
+// qotdHandler serves today's Quote of the Day as a page, or as JSON or plain
+// text when asked for with ?format= or the Accept header.
+func (a *API) qotdHandler(w http.ResponseWriter, r *http.Request) {
+	day := a.qotd.Today()
+	dq, err := a.qotd.For(r.Context(), day)
+	if errors.Is(err, domain.ErrNotFound) {
+		a.error(w, r, http.StatusNotFound, "no quotes yet", nil)
+		return
+	}
+	if err != nil {
+		a.fail(w, r, "fetching quote of the day", err)
+		return
+	}
+
+	switch f := responseFormat(r); f {
+	case render.FormatJSON, render.FormatText, render.FormatMarkdown:
+		w.Header().Set("Content-Type", f.ContentType())
+		_ = render.Write(w, f, dq.Quote)
+	default:
+		vm := a.toViewModels(r.Context(), []*domain.Quote{dq.Quote})
+		vm[0].Label = qotdLabel(dq)
+		a.renderPage(w, r, map[string]any{
+			"Heading": "Quote of the Day",
+			"Quotes":  vm,
+		})
+	}
+}
+
+// qotdHistoryHandler lists past selections, newest first. The cursor is the
+// date of the oldest selection on the previous page.
+func (a *API) qotdHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	before := a.qotd.Today().AddDate(0, 0, 1)
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		t, err := time.Parse(time.DateOnly, c)
+		if err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid cursor", err)
+			return
+		}
+		before = t
+	}
+	days, err := a.qotd.History(r.Context(), before, a.pageSize+1)
+	if err != nil {
+		a.fail(w, r, "fetching quote of the day history", err)
+		return
+	}
+	var next string
+	if len(days) > a.pageSize {
+		days = days[:a.pageSize]
+		next = days[len(days)-1].Day.Format(time.DateOnly)
+	}
+	quotes := make([]*domain.Quote, len(days))
+	for i, dq := range days {
+		quotes[i] = dq.Quote
+	}
+	vms := a.toViewModels(r.Context(), quotes)
+	for i, dq := range days {
+		vms[i].Label = qotdLabel(dq)
+	}
+	a.renderPage(w, r, map[string]any{
+		"Heading":    "Quote of the Day history",
+		"Quotes":     vms,
+		"NextCursor": next,
+		"Endpoint":   "/qotd/history",
+	})
+}
+
+// adminQOTDHandler shows the form to pin a quote to a day and handles it.
+func (a *API) adminQOTDHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{
+		"CSRFToken": csrfToken(r.Context()),
+		"Day":       a.qotd.Today().Format(time.DateOnly),
+	}
+	if r.Method == http.MethodPost {
+		day, err := time.Parse(time.DateOnly, r.PostFormValue("day"))
+		if err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid day", err)
+			return
+		}
+		id, err := strconv.Atoi(r.PostFormValue("quote_id"))
+		if err != nil {
+			a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+			return
+		}
+		if err := a.qotd.Pin(r.Context(), day, id); err != nil {
+			a.fail(w, r, "pinning quote of the day", err)
+			return
+		}
+		data["Day"] = day.Format(time.DateOnly)
+		data["Message"] = fmt.Sprintf("Quote %d is the quote of the day for %s.", id, day.Format(time.DateOnly))
+	}
+	a.render(w, r, "admin-qotd.html", data)
+}
+
+func qotdLabel(dq *domain.DailyQuote) string {
+	return "Quote of the Day · " + dq.Day.Format("Jan 2, 2006")
+}
+
+// responseFormat returns the format asked for with the format query
+// parameter or, failing that, the Accept header. It defaults to HTML.
+func responseFormat(r *http.Request) render.Format {
+	switch f := render.Format(r.URL.Query().Get("format")); f {
+	case render.FormatJSON, render.FormatText, render.FormatMarkdown, render.FormatHTML:
+		return f
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/json"):
+		return render.FormatJSON
+	case strings.HasPrefix(accept, "text/plain"):
+		return render.FormatText
+	case strings.HasPrefix(accept, "text/markdown"):
+		return render.FormatMarkdown
+	}
+	return render.FormatHTML
+}
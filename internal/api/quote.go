@@ -2,15 +2,112 @@ package api
 
 import (
 	"html/template"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/hionay/quotes/internal/domain"
 )
 
+// excerptLength is how many characters of a quote a link to it shows.
+const excerptLength = 120
+
 type Quote struct {
 	Date    time.Time
 	Quote   template.HTML
 	Comment template.HTML
-	IP      string
+	Label   string
+	ID      int
+	Likes   int
+	Votes   int
+	// Comments is the number of visible comments.
+	Comments  int
+	Reactions []Reaction
+	// Favourite is whether the visitor keeps the quote as a favourite.
+	Favourite bool
+	// Collection is the slug of the collection the card is shown in, if
+	// the visitor may rearrange it.
+	Collection string
+}
+
+// Reaction is an emoji reaction offered on a quote, with how many visitors
+// gave it and whether the current one did.
+type Reaction struct {
+	Name  string
+	Emoji string
+	Count int
+	Mine  bool
+}
+
+// QuoteLink links to a quote by the start of its text, such as one
+// suggested below another.
+type QuoteLink struct {
+	Date    time.Time
+	Excerpt string
 	ID      int
 	Likes   int
 	Votes   int
 }
+
+func toQuoteLinks(quotes []*domain.Quote) []QuoteLink {
+	links := make([]QuoteLink, len(quotes))
+	for i, q := range quotes {
+		links[i] = QuoteLink{Date: q.Date, Excerpt: excerpt(q.Quote), ID: q.ID, Likes: q.Likes, Votes: q.Votes}
+	}
+	return links
+}
+
+// excerpt returns the start of a quote's text on a single line.
+func excerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= excerptLength {
+		return text
+	}
+	return string([]rune(text)[:excerptLength-1]) + "…"
+}
+
+// Comment is one comment of a discussion thread, with its replies.
+type Comment struct {
+	Date     time.Time
+	Body     template.HTML
+	Author   string
+	ID       int
+	QuoteID  int
+	ParentID int
+	Hidden   bool
+	Replies  []Comment
+}
+
+// Thread is the template data of the discussion below a quote.
+type Thread struct {
+	QuoteID       int
+	Count         int
+	Comments      []Comment
+	CSRFToken     string
+	PowDifficulty int
+}
+
+// Collection is a visitor's collection of quotes. Owned is whether the
+// current visitor may change it.
+type Collection struct {
+	Name       string
+	Slug       string
+	URL        string
+	Favourites bool
+	Size       int
+	Owned      bool
+	CSRFToken  string
+}
+
+// Collections is the template data of a visitor's list of collections.
+type Collections struct {
+	Items     []Collection
+	CSRFToken string
+}
+
+// AddTo is the form that adds a quote to one of the visitor's collections.
+type AddTo struct {
+	QuoteID     int
+	Collections []Collection
+	CSRFToken   string
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// reactHandler toggles a reaction of the visitor on a quote and returns the
+// updated card. Visitors get their ID with their first reaction.
+func (a *API) reactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		a.error(w, r, http.StatusMethodNotAllowed, "use POST to react", nil)
+		return
+	}
+	q := r.URL.Query()
+	id, err := strconv.Atoi(q.Get("id"))
+	if err != nil {
+		a.error(w, r, http.StatusBadRequest, "invalid quote ID", err)
+		return
+	}
+	r, err = ensureVisitor(w, r)
+	if err != nil {
+		a.error(w, r, http.StatusInternalServerError, "generating visitor ID", err)
+		return
+	}
+	quote, err := a.reactions.Toggle(r.Context(), id, visitor(r.Context()), q.Get("reaction"))
+	if err != nil {
+		a.fail(w, r, "applying reaction", err)
+		return
+	}
+	a.activity.Store(time.Now().UnixNano())
+	vm := a.toViewModels(r.Context(), []*domain.Quote{quote})[0]
+	a.render(w, r, "quote-card.html", vm)
+}
+
+// topReactionHandler lists the quotes most visitors gave a reaction, such
+// as /top/funny.
+func (a *API) topReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reaction, err := a.reactions.Lookup(r.PathValue("reaction"))
+	if err != nil {
+		a.notFoundHandler(w, r)
+		return
+	}
+	fetch := func(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+		return a.reactions.Top(ctx, reaction.Name, cursor, limit)
+	}
+	a.listHandler("Top "+reaction.Emoji, fetch)(w, r)
+}
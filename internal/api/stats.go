@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// bar is one bar of a chart; Percent is relative to the largest bar.
+type bar struct {
+	Label   string
+	Count   int
+	Percent int
+}
+
+type heatRow struct {
+	Label string
+	Cells []heatCell
+}
+
+type heatCell struct {
+	Hour    int
+	Count   int
+	Percent int
+}
+
+// statsView is the template data of the statistics page.
+type statsView struct {
+	Total             int
+	TotalVotes        int
+	Years             []bar
+	Months            []bar
+	Votes             []bar
+	MostVoted         []Quote
+	MostControversial []Quote
+	Heatmap           []heatRow
+	Speakers          []bar
+	GeneratedAt       time.Time
+}
+
+func (a *API) statsHandler(w http.ResponseWriter, r *http.Request) {
+	st, err := a.stats.Get(r.Context())
+	if err != nil {
+		a.fail(w, r, "computing statistics", err)
+		return
+	}
+	a.renderPage(w, r, map[string]any{
+		"Heading": "Statistics",
+		"Stats":   a.toStatsView(r.Context(), st),
+	})
+}
+
+func (a *API) toStatsView(ctx context.Context, st *domain.Stats) statsView {
+	v := statsView{
+		Total:             st.Total,
+		TotalVotes:        st.TotalVotes,
+		MostVoted:         a.toViewModels(ctx, st.MostVoted),
+		MostControversial: a.toViewModels(ctx, st.MostControversial),
+		GeneratedAt:       st.GeneratedAt,
+	}
+
+	for _, c := range st.ByMonth {
+		label := strconv.Itoa(c.Year)
+		if n := len(v.Years); n == 0 || v.Years[n-1].Label != label {
+			v.Years = append(v.Years, bar{Label: label})
+		}
+		v.Years[len(v.Years)-1].Count += c.Count
+		v.Months = append(v.Months, bar{Label: fmt.Sprintf("%s %d", c.Month.String()[:3], c.Year), Count: c.Count})
+	}
+	for _, b := range st.Votes {
+		v.Votes = append(v.Votes, bar{Label: fmt.Sprintf("%d to %d", b.Min, b.Max), Count: b.Count})
+	}
+	for _, s := range st.TopSpeakers {
+		v.Speakers = append(v.Speakers, bar{Label: s.Nick, Count: s.Count})
+	}
+	for _, bars := range [][]bar{v.Years, v.Months, v.Votes, v.Speakers} {
+		scaleBars(bars)
+	}
+
+	peak := 0
+	for _, row := range st.Activity {
+		for _, n := range row {
+			peak = max(peak, n)
+		}
+	}
+	// Weeks start on Monday.
+	for i := range 7 {
+		day := time.Weekday((i + 1) % 7)
+		row := heatRow{Label: day.String()[:3]}
+		for hour, n := range st.Activity[day] {
+			row.Cells = append(row.Cells, heatCell{Hour: hour, Count: n, Percent: percent(n, peak)})
+		}
+		v.Heatmap = append(v.Heatmap, row)
+	}
+	return v
+}
+
+func scaleBars(bars []bar) {
+	peak := 0
+	for _, b := range bars {
+		peak = max(peak, b.Count)
+	}
+	for i := range bars {
+		bars[i].Percent = percent(bars[i].Count, peak)
+	}
+}
+
+func percent(n, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return n * 100 / total
+}
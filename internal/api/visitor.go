@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+)
+
+// visitorMiddleware stores the visitor ID from the request's cookie, if any,
+// in the request context (see visitor). IDs are only handed out when a
+// visitor first reacts to a quote.
+func (a *API) visitorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(visitorCookieName); err == nil && validVisitorID(c.Value) {
+			r = r.WithContext(context.WithValue(r.Context(), visitorKey, c.Value))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// visitor returns the ID of the visitor making the request, or "".
+func visitor(ctx context.Context) string {
+	id, _ := ctx.Value(visitorKey).(string)
+	return id
+}
+
+// ensureVisitor returns r with a visitor ID, giving the visitor a new one
+// in a long-lived cookie if it has none. On error it returns r unchanged.
+func ensureVisitor(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	if visitor(r.Context()) != "" {
+		return r, nil
+	}
+	b := make([]byte, visitorIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return r, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  time.Now().Add(visitorCookieAge),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return r.WithContext(context.WithValue(r.Context(), visitorKey, id)), nil
+}
+
+func validVisitorID(s string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	return err == nil && len(b) == visitorIDBytes
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 600_000
+	saltBytes      = 16
+	keyBytes       = 32
+)
+
+var ErrMismatch = errors.New("password does not match")
+
+// HashPassword returns an encoded PBKDF2-SHA256 hash of password in the form
+// pbkdf2-sha256$iterations$salt$key.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("rand.Read(): %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, keyBytes)
+	if err != nil {
+		return "", fmt.Errorf("pbkdf2.Key(): %w", err)
+	}
+	enc := base64.RawStdEncoding
+	return strings.Join([]string{
+		hashScheme,
+		strconv.Itoa(hashIterations),
+		enc.EncodeToString(salt),
+		enc.EncodeToString(key),
+	}, "$"), nil
+}
+
+// CheckPassword returns nil if password matches the encoded hash and
+// ErrMismatch if it doesn't.
+func CheckPassword(encoded, password string) error {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return errors.New("unsupported password hash")
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return errors.New("malformed password hash")
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed password hash")
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return errors.New("malformed password hash")
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return fmt.Errorf("pbkdf2.Key(): %w", err)
+	}
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPassword(hash, "hunter2"); err != nil {
+		t.Errorf("CheckPassword(right) = %v; want nil", err)
+	}
+	if err := CheckPassword(hash, "hunter3"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("CheckPassword(wrong) = %v; want ErrMismatch", err)
+	}
+	if err := CheckPassword("md5$abc", "hunter2"); err == nil || errors.Is(err, ErrMismatch) {
+		t.Errorf("CheckPassword(unsupported) = %v; want format error", err)
+	}
+	other, _ := HashPassword("hunter2")
+	if other == hash {
+		t.Error("HashPassword() returned the same hash twice; want random salt")
+	}
+}
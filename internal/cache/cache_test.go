@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/repository"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, ok := c.Get(ctx, "b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(ctx, key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d; want 2", c.Len())
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+
+	now = now.Add(59 * time.Second)
+	if _, ok := c.Get(ctx, "a"); !ok {
+		t.Error("a expired too early")
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get(ctx, "a"); ok {
+		t.Error("a should have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d; want expired entry dropped", c.Len())
+	}
+}
+
+type countingRepo struct {
+	domain.QuoteRepository
+	likes map[int]int
+	reads int
+	down  bool
+}
+
+func (r *countingRepo) GetByID(_ context.Context, id int) (*domain.Quote, error) {
+	r.reads++
+	if r.down {
+		return nil, fmt.Errorf("get quote: %w", domain.ErrUnavailable)
+	}
+	return &domain.Quote{ID: id, Likes: r.likes[id]}, nil
+}
+
+func (r *countingRepo) GetLatest(context.Context, string, int) (*domain.Page, error) {
+	r.reads++
+	return &domain.Page{Quotes: []*domain.Quote{{ID: 1, Likes: r.likes[1]}}}, nil
+}
+
+func (r *countingRepo) LikeQuote(_ context.Context, id int) error {
+	r.likes[id]++
+	return nil
+}
+
+func TestQuoteRepositoryInvalidatesOnVote(t *testing.T) {
+	ctx := context.Background()
+	next := &countingRepo{likes: map[int]int{}}
+	c := NewQuoteRepository(next, NewLRU(100), time.Minute)
+
+	for range 2 {
+		if _, err := c.GetByID(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetLatest(ctx, "", 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next.reads != 2 {
+		t.Fatalf("reads = %d; want 2 with the second round cached", next.reads)
+	}
+
+	if err := c.LikeQuote(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	q, err := c.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := c.GetLatest(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Likes != 1 || page.Quotes[0].Likes != 1 {
+		t.Errorf("got likes %d and %d after a vote; want fresh values of 1", q.Likes, page.Quotes[0].Likes)
+	}
+}
+
+func TestQuoteRepositoryServesStaleWhileUnavailable(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	next := &countingRepo{likes: map[int]int{1: 3}}
+	c := NewQuoteRepository(next, NewLRU(100), time.Minute)
+	c.now = func() time.Time { return now }
+
+	if _, err := c.GetByID(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	next.down = true
+	q, err := c.GetByID(ctx, 1)
+	if err != nil || q.Likes != 3 {
+		t.Fatalf("GetByID() = %+v, %v; want the expired quote", q, err)
+	}
+	if next.reads != 2 {
+		t.Errorf("reads = %d; want the expired quote reloaded first", next.reads)
+	}
+	if _, err := c.GetByID(ctx, 2); !errors.Is(err, domain.ErrUnavailable) {
+		t.Errorf("GetByID() of an uncached quote = %v; want ErrUnavailable", err)
+	}
+}
+
+// queryConn counts the queries sent to it and finds no rows.
+type queryConn struct {
+	queries int
+}
+
+func (c *queryConn) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	c.queries++
+	return driver.RowsAffected(1), nil
+}
+
+func (c *queryConn) QueryContext(context.Context, string, ...any) (repository.Rows, error) {
+	c.queries++
+	return emptyRows{}, nil
+}
+
+func (c *queryConn) QueryRowContext(ctx context.Context, query string, args ...any) repository.Row {
+	c.queries++
+	return errRow{sql.ErrNoRows}
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Next() bool                 { return false }
+func (emptyRows) Scan(...any) error          { return sql.ErrNoRows }
+func (emptyRows) Columns() ([]string, error) { return nil, nil }
+func (emptyRows) Err() error                 { return nil }
+func (emptyRows) Close() error               { return nil }
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(...any) error { return r.err }
+func (r errRow) Err() error        { return r.err }
+
+func TestQuoteRepositoryFillsFromPrimaryAfterWrite(t *testing.T) {
+	now := time.Now()
+	primary, replica := &queryConn{}, &queryConn{}
+	c := NewQuoteRepository(repository.NewQuoteRepository(primary, replica), NewLRU(100), time.Minute)
+	c.now = func() time.Time { return now }
+	reads := func() [2]int { return [2]int{primary.queries, replica.queries} }
+
+	if _, err := c.GetLatest(repository.WithSession(context.Background()), "", 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := reads(); got[0] != 0 || got[1] == 0 {
+		t.Fatalf("queries before a write = %v; want the replica read", got)
+	}
+
+	if err := c.LikeQuote(repository.WithSession(context.Background()), 1); err != nil {
+		t.Fatal(err)
+	}
+	before := reads()
+	// Another visitor, who hasn't written, refills the cache after the vote.
+	other := repository.WithSession(context.Background())
+	c.GetByID(other, 1)
+	c.GetLatest(other, "", 10)
+	if got := reads(); got[0] == before[0] || got[1] != before[1] {
+		t.Errorf("queries refilling the cache after a write = %v, from %v; want only the primary read", got, before)
+	}
+
+	now = now.Add(repository.ReplicaLag)
+	before = reads()
+	c.GetTop(other, "", 10)
+	if got := reads(); got[0] != before[0] || got[1] == before[1] {
+		t.Errorf("queries once the replicas caught up = %v, from %v; want only the replica read", got, before)
+	}
+}
+
+// racingRepo votes for a quote while it is being read, as another request
+// would.
+type racingRepo struct {
+	countingRepo
+	cache *QuoteRepository
+	raced bool
+}
+
+func (r *racingRepo) GetByID(ctx context.Context, id int) (*domain.Quote, error) {
+	q, err := r.countingRepo.GetByID(ctx, id)
+	if !r.raced {
+		r.raced = true
+		r.cache.LikeQuote(ctx, id)
+	}
+	return q, err
+}
+
+func TestQuoteRepositoryDropsLoadRacingWrite(t *testing.T) {
+	ctx := context.Background()
+	next := &racingRepo{countingRepo: countingRepo{likes: map[int]int{}}}
+	c := NewQuoteRepository(next, NewLRU(100), time.Minute)
+	next.cache = c
+
+	if q, _ := c.GetByID(ctx, 1); q.Likes != 0 {
+		t.Fatalf("first GetByID() likes = %d; want the value read before the vote", q.Likes)
+	}
+	q, err := c.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Likes != 1 || next.reads != 2 {
+		t.Errorf("GetByID() after a racing vote = %d likes with %d reads; want 1 like reloaded", q.Likes, next.reads)
+	}
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/repository"
+)
+
+// QuoteRepository caches the reads of another domain.QuoteRepository.
+//
+// Single quotes are cached by ID and dropped when voted on. Every listing
+// and count depends on the whole archive, so their keys carry a generation
+// number that any write bumps, orphaning the old entries until they are
+// evicted. The generation lives in this process: other processes writing
+// to the database are only picked up when entries expire.
+//
+// Expired entries are kept for staleFor longer, and served instead of an
+// error while the database is unavailable. For repository.ReplicaLag after
+// a write, entries are loaded from the primary, so that a replica that
+// hasn't caught up yet doesn't fill the cache with what the write changed.
+type QuoteRepository struct {
+	next    domain.QuoteRepository
+	backend Backend
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	gen      uint64
+	modified time.Time
+	// wrote is when this process last wrote, zero if it hasn't.
+	wrote time.Time
+}
+
+func NewQuoteRepository(next domain.QuoteRepository, backend Backend, ttl time.Duration) *QuoteRepository {
+	c := &QuoteRepository{next: next, backend: backend, ttl: ttl, now: time.Now}
+	c.modified = c.now()
+	return c
+}
+
+// LastModified returns when this process last changed a quote, or when the
+// cache was created. Like the generation, it misses the writes of other
+// processes.
+func (c *QuoteRepository) LastModified() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.modified
+}
+
+func (c *QuoteRepository) Create(ctx context.Context, q *domain.Quote) error {
+	if err := c.next.Create(ctx, q); err != nil {
+		return err
+	}
+	c.invalidate(ctx, 0)
+	return nil
+}
+
+func (c *QuoteRepository) Delete(ctx context.Context, id int) error {
+	if err := c.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	c.invalidate(ctx, id)
+	return nil
+}
+
+func (c *QuoteRepository) LikeQuote(ctx context.Context, id int) error {
+	if err := c.next.LikeQuote(ctx, id); err != nil {
+		return err
+	}
+	c.invalidate(ctx, id)
+	return nil
+}
+
+func (c *QuoteRepository) DislikeQuote(ctx context.Context, id int) error {
+	if err := c.next.DislikeQuote(ctx, id); err != nil {
+		return err
+	}
+	c.invalidate(ctx, id)
+	return nil
+}
+
+func (c *QuoteRepository) Merge(ctx context.Context, keep int, dups []int) error {
+	if err := c.next.Merge(ctx, keep, dups); err != nil {
+		return err
+	}
+	c.invalidate(ctx, keep)
+	for _, id := range dups {
+		c.invalidate(ctx, id)
+	}
+	return nil
+}
+
+func (c *QuoteRepository) GetRedirect(ctx context.Context, id int) (int, error) {
+	return c.next.GetRedirect(ctx, id)
+}
+
+func (c *QuoteRepository) GetRandom(ctx context.Context, f domain.RandomFilter) (*domain.Quote, error) {
+	return c.next.GetRandom(ctx, f)
+}
+
+func (c *QuoteRepository) GetByID(ctx context.Context, id int) (*domain.Quote, error) {
+	return cached(ctx, c, quoteKey(id), func(ctx context.Context) (*domain.Quote, error) {
+		return c.next.GetByID(ctx, id)
+	})
+}
+
+// GetByIDs isn't cached: it serves the duplicate tools, which should see
+// the quotes as they are.
+func (c *QuoteRepository) GetByIDs(ctx context.Context, ids []int) ([]*domain.Quote, error) {
+	return c.next.GetByIDs(ctx, ids)
+}
+
+func (c *QuoteRepository) GetLatest(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return cached(ctx, c, c.listKey("latest", cursor, limit), func(ctx context.Context) (*domain.Page, error) {
+		return c.next.GetLatest(ctx, cursor, limit)
+	})
+}
+
+func (c *QuoteRepository) GetTop(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return cached(ctx, c, c.listKey("top", cursor, limit), func(ctx context.Context) (*domain.Page, error) {
+		return c.next.GetTop(ctx, cursor, limit)
+	})
+}
+
+func (c *QuoteRepository) GetOnThisDay(ctx context.Context, day time.Time, cursor string, limit int) (*domain.Page, error) {
+	key := c.listKey("onthisday", day.Format(time.DateOnly), cursor, limit)
+	return cached(ctx, c, key, func(ctx context.Context) (*domain.Page, error) {
+		return c.next.GetOnThisDay(ctx, day, cursor, limit)
+	})
+}
+
+func (c *QuoteRepository) GetByPeriod(ctx context.Context, from, to time.Time, cursor string, limit int) (*domain.Page, error) {
+	key := c.listKey("period", from.Unix(), to.Unix(), cursor, limit)
+	return cached(ctx, c, key, func(ctx context.Context) (*domain.Page, error) {
+		return c.next.GetByPeriod(ctx, from, to, cursor, limit)
+	})
+}
+
+func (c *QuoteRepository) CountByYear(ctx context.Context) ([]domain.PeriodCount, error) {
+	return cached(ctx, c, c.listKey("years"), func(ctx context.Context) ([]domain.PeriodCount, error) {
+		return c.next.CountByYear(ctx)
+	})
+}
+
+func (c *QuoteRepository) CountByMonth(ctx context.Context, year int) ([]domain.PeriodCount, error) {
+	return cached(ctx, c, c.listKey("months", year), func(ctx context.Context) ([]domain.PeriodCount, error) {
+		return c.next.CountByMonth(ctx, year)
+	})
+}
+
+// invalidate drops every listing and, if id is set, that quote.
+func (c *QuoteRepository) invalidate(ctx context.Context, id int) {
+	c.mu.Lock()
+	c.gen++
+	c.wrote = c.now()
+	c.modified = c.wrote
+	c.mu.Unlock()
+	if id != 0 {
+		c.backend.Delete(ctx, quoteKey(id))
+	}
+}
+
+// loadContext returns the context to load entries with: reading from the
+// primary for repository.ReplicaLag after a write.
+func (c *QuoteRepository) loadContext(ctx context.Context) context.Context {
+	c.mu.Lock()
+	wrote := c.wrote
+	c.mu.Unlock()
+	if !wrote.IsZero() && c.now().Sub(wrote) < repository.ReplicaLag {
+		return repository.Primary(ctx)
+	}
+	return ctx
+}
+
+func (c *QuoteRepository) listKey(kind string, parts ...any) string {
+	return fmt.Sprintf("list:%d:%s:%v", c.generation(), kind, parts)
+}
+
+func (c *QuoteRepository) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func quoteKey(id int) string {
+	return fmt.Sprintf("quote:%d", id)
+}
+
+// staleFor is how long past their TTL entries may still be served while
+// the database is unavailable.
+const staleFor = 24 * time.Hour
+
+// stored is what the backend holds: a value and when it was loaded.
+type stored[T any] struct {
+	Loaded time.Time `json:"loaded"`
+	Value  T         `json:"value"`
+}
+
+// cached returns the value stored under key, or calls load and stores its
+// result. Errors are never cached, and values that don't round-trip
+// through the backend are simply reloaded. If load fails because the
+// database is unavailable, an expired value is returned instead. A value
+// loaded while a write was made may predate it and isn't stored.
+func cached[T any](ctx context.Context, c *QuoteRepository, key string, load func(context.Context) (T, error)) (T, error) {
+	var s stored[T]
+	b, ok := c.backend.Get(ctx, key)
+	ok = ok && json.Unmarshal(b, &s) == nil
+	if ok && c.now().Sub(s.Loaded) < c.ttl {
+		return s.Value, nil
+	}
+	gen := c.generation()
+	v, err := load(c.loadContext(ctx))
+	if err != nil {
+		if ok && errors.Is(err, domain.ErrUnavailable) {
+			return s.Value, nil
+		}
+		return v, err
+	}
+	if c.generation() != gen {
+		return v, nil
+	}
+	if b, err := json.Marshal(stored[T]{Loaded: c.now(), Value: v}); err == nil {
+		c.backend.Set(ctx, key, b, c.ttl+staleFor)
+	}
+	return v, nil
+}
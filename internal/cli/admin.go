@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/auth"
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/related"
+	"github.com/hionay/quotes/internal/repository"
+)
+
+var migrateCommand = &command{
+	name:    "migrate",
+	summary: "Apply pending database migrations",
+	setup: func(fs *flag.FlagSet) runFunc {
+		status := fs.Bool("status", false, "only list pending migrations")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("migrate takes no arguments")
+			}
+			db, err := e.openDB(ctx)
+			if err != nil {
+				return err
+			}
+			if *status {
+				pending, err := repository.PendingMigrations(ctx, db)
+				if err != nil {
+					return err
+				}
+				if len(pending) == 0 {
+					fmt.Fprintln(e.stdout, "database is up to date")
+				}
+				for _, v := range pending {
+					fmt.Fprintf(e.stdout, "pending %s\n", v)
+				}
+				return nil
+			}
+			applied, err := repository.Migrate(ctx, db)
+			for _, v := range applied {
+				fmt.Fprintf(e.stdout, "applied %s\n", v)
+			}
+			if err == nil && len(applied) == 0 {
+				fmt.Fprintln(e.stdout, "database is up to date")
+			}
+			return err
+		}
+	},
+}
+
+var userCommand = &command{
+	name:    "user",
+	summary: "Manage administrator accounts",
+	subs: []*command{
+		{
+			name:    "add",
+			args:    "<username>",
+			summary: "Create an administrator; the password is read from stdin",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(ctx context.Context, e *env, args []string) error {
+					username, hash, err := readCredentials(e, args)
+					if err != nil {
+						return err
+					}
+					db, err := e.openDB(ctx)
+					if err != nil {
+						return err
+					}
+					u := &domain.User{Username: username, PasswordHash: hash, CreatedAt: time.Now()}
+					if err := repository.NewUserRepository(db).Create(ctx, u); err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stdout, "created user %s\n", username)
+					return nil
+				}
+			},
+		},
+		{
+			name:    "passwd",
+			args:    "<username>",
+			summary: "Change an administrator's password; it is read from stdin",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(ctx context.Context, e *env, args []string) error {
+					username, hash, err := readCredentials(e, args)
+					if err != nil {
+						return err
+					}
+					db, err := e.openDB(ctx)
+					if err != nil {
+						return err
+					}
+					if err := repository.NewUserRepository(db).UpdatePassword(ctx, username, hash); err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stdout, "updated password of %s\n", username)
+					return nil
+				}
+			},
+		},
+	},
+}
+
+// readCredentials takes the username from args and reads the password as
+// the first line of stdin.
+func readCredentials(e *env, args []string) (string, string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", "", usageErrorf("expected exactly one username")
+	}
+	fmt.Fprint(e.stderr, "Password: ")
+	line, err := e.stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", "", fmt.Errorf("reading password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < minPasswordLength {
+		return "", "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return "", "", err
+	}
+	return args[0], hash, nil
+}
+
+var backupCommand = &command{
+	name:    "backup",
+	summary: "Write an SQL dump of the database",
+	setup: func(fs *flag.FlagSet) runFunc {
+		output := fs.String("output", "-", "file to write to, - for stdout")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("backup takes no arguments")
+			}
+			db, err := e.openDB(ctx)
+			if err != nil {
+				return err
+			}
+			return writeOutput(e, *output, func(w io.Writer) error {
+				return repository.Dump(ctx, db, w)
+			})
+		}
+	},
+}
+
+var doctorCommand = &command{
+	name:    "doctor",
+	summary: "Check configuration, database, schema and assets",
+	setup: func(fs *flag.FlagSet) runFunc {
+		return func(ctx context.Context, e *env, _ []string) error {
+			failed := 0
+			report := func(name string, err error) {
+				if err != nil {
+					failed++
+					fmt.Fprintf(e.stdout, "FAIL  %-11s %v\n", name, err)
+					return
+				}
+				fmt.Fprintf(e.stdout, "ok    %s\n", name)
+			}
+
+			report("config", nil)
+			db, err := e.openDB(ctx)
+			report("database", err)
+			if err == nil {
+				pending, err := repository.PendingMigrations(ctx, db)
+				if err == nil && len(pending) > 0 {
+					err = fmt.Errorf("pending migrations: %s (run %s migrate)", strings.Join(pending, ", "), programName)
+				}
+				report("migrations", err)
+			}
+			_, err = template.New("").ParseGlob("templates/*.html")
+			report("templates", err)
+			_, err = os.Stat("static")
+			report("static", err)
+			if path := e.cfg.SpamModelPath(); path != "" {
+				report("spam model", checkWritableDir(filepath.Dir(path)))
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d checks failed", failed)
+			}
+			return nil
+		}
+	},
+}
+
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+var configCommand = &command{
+	name:    "config",
+	summary: "Inspect the configuration",
+	subs: []*command{
+		{
+			name:    "print",
+			summary: "Print the effective configuration with secrets redacted",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(_ context.Context, e *env, _ []string) error {
+					return e.cfg.Print(e.stdout)
+				}
+			},
+		},
+	},
+}
+
+var anonymiseIPsCommand = &command{
+	name:    "anonymise-ips",
+	summary: "Anonymise IPs stored in plain text by older versions",
+	setup: func(fs *flag.FlagSet) runFunc {
+		return func(ctx context.Context, e *env, _ []string) error {
+			ips, err := privacy.NewAnonymizer(privacy.Mode(e.cfg.IPMode()), e.cfg.IPHashKey())
+			if err != nil {
+				return fmt.Errorf("privacy.NewAnonymizer(): %w", err)
+			}
+			repo, err := quoteRepo(ctx, e)
+			if err != nil {
+				return err
+			}
+			n, err := repo.RewriteIPs(ctx, func(ip string) (string, bool) {
+				if !privacy.IsRaw(ip) {
+					return "", false
+				}
+				return ips.Anonymize(ip), true
+			})
+			if err != nil {
+				return fmt.Errorf("repo.RewriteIPs(): %w", err)
+			}
+			fmt.Fprintf(e.stdout, "anonymised %d rows\n", n)
+			return nil
+		}
+	},
+}
+
+var relatedCommand = &command{
+	name:    "related",
+	summary: "Recompute the related quotes shown on quote pages",
+	setup: func(fs *flag.FlagSet) runFunc {
+		return func(ctx context.Context, e *env, _ []string) error {
+			db, err := e.openDB(ctx)
+			if err != nil {
+				return err
+			}
+			updater := related.NewUpdater(repository.NewQuoteRepository(db), repository.NewRelatedRepository(db))
+			n, err := updater.Update(ctx)
+			if err != nil {
+				return fmt.Errorf("updater.Update(): %w", err)
+			}
+			fmt.Fprintf(e.stdout, "updated related quotes of %d quotes\n", n)
+			return nil
+		}
+	},
+}
+
+const minPasswordLength = 8
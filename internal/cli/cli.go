@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/hionay/quotes/internal/cmdutil"
+	"github.com/hionay/quotes/internal/config"
+	"github.com/hionay/quotes/internal/repository"
+)
+
+const programName = "quotes"
+
+// Exit codes returned by Run.
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+	ExitConfig  = 3
+)
+
+// runFunc runs a command with the arguments left after its flags.
+type runFunc func(ctx context.Context, e *env, args []string) error
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	subs    []*command
+	// setup registers the command's flags on fs and returns the function
+	// that runs it. Commands with subcommands have no setup.
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+// env is what commands share: configuration, output and lazily opened
+// database pools.
+type env struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+	db     *repository.DB
+	// replicas are read replicas of db, opened only by the server.
+	replicas []*repository.DB
+}
+
+func (e *env) openDB(ctx context.Context) (*repository.DB, error) {
+	if e.db != nil {
+		return e.db, nil
+	}
+	pool, err := cmdutil.NewMySQLPool(ctx, e.cfg, e.logger)
+	if err != nil {
+		return nil, fmt.Errorf("cmdutil.NewMySQLPool(): %w", err)
+	}
+	e.db = repository.NewDB(pool, e.logger, e.cfg.DBQueryTimeout())
+	return e.db, nil
+}
+
+// openReplicas opens the read replicas of the configuration, if any.
+func (e *env) openReplicas(ctx context.Context) ([]repository.Connection, error) {
+	if e.replicas == nil {
+		pools, err := cmdutil.NewMySQLReplicaPools(ctx, e.cfg, e.logger)
+		if err != nil {
+			return nil, fmt.Errorf("cmdutil.NewMySQLReplicaPools(): %w", err)
+		}
+		e.replicas = make([]*repository.DB, len(pools))
+		for i, pool := range pools {
+			e.replicas[i] = repository.NewDB(pool, e.logger, e.cfg.DBQueryTimeout())
+		}
+	}
+	conns := make([]repository.Connection, len(e.replicas))
+	for i, r := range e.replicas {
+		conns[i] = r
+	}
+	return conns, nil
+}
+
+// usageError is returned by commands called with bad arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+var root = &command{
+	name:    programName,
+	summary: "A self-hosted quotes website",
+	subs: []*command{
+		serveCommand,
+		migrateCommand,
+		importCommand,
+		exportCommand,
+		userCommand,
+		quoteCommand,
+		backupCommand,
+		doctorCommand,
+		configCommand,
+		anonymiseIPsCommand,
+		relatedCommand,
+	},
+}
+
+// Run executes the command named by args and returns the process exit
+// code. Global flags (see config.Load) come before the command; running
+// without a command serves the site.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if path, ok := helpRequest(args); ok {
+		cmd, n := lookup(path)
+		printHelp(stdout, cmd, path[:n])
+		return ExitOK
+	}
+
+	cfg, rest, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitConfig
+	}
+	if len(rest) == 0 {
+		rest = []string{serveCommand.name}
+	}
+
+	cmd, n := lookup(rest)
+	path, cmdArgs := rest[:n], rest[n:]
+	if cmd.setup == nil {
+		if len(cmdArgs) > 0 {
+			fmt.Fprintf(stderr, "unknown command %q\n\n", strings.Join(rest[:n+1], " "))
+		}
+		printHelp(stderr, cmd, path)
+		return ExitUsage
+	}
+
+	fs := flag.NewFlagSet(commandLine(path), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	run := cmd.setup(fs)
+	if err := fs.Parse(cmdArgs); err != nil {
+		fmt.Fprintf(stderr, "%v\n\n", err)
+		printHelp(stderr, cmd, path)
+		return ExitUsage
+	}
+
+	e := &env{
+		cfg:    cfg,
+		logger: slog.New(slog.NewJSONHandler(stderr, nil)),
+		stdin:  bufio.NewReader(stdin),
+		stdout: stdout,
+		stderr: stderr,
+	}
+	defer func() {
+		for _, db := range append([]*repository.DB{e.db}, e.replicas...) {
+			if db == nil {
+				continue
+			}
+			if err := db.Close(); err != nil {
+				e.logger.Error("Failed to close database pool", slog.Any("err", err))
+			}
+		}
+	}()
+
+	if err := run(ctx, e, fs.Args()); err != nil {
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			fmt.Fprintf(stderr, "%v\n\n", err)
+			printHelp(stderr, cmd, path)
+			return ExitUsage
+		}
+		fmt.Fprintf(stderr, "%s: %v\n", commandLine(path), err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// lookup walks args down the command tree and returns the deepest command
+// reached and how many arguments named it.
+func lookup(args []string) (*command, int) {
+	cmd, n := root, 0
+	for n < len(args) {
+		next := cmd.sub(args[n])
+		if next == nil {
+			break
+		}
+		cmd = next
+		n++
+	}
+	return cmd, n
+}
+
+func (c *command) sub(name string) *command {
+	for _, s := range c.subs {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// helpRequest reports whether args ask for help, either as "help <command>"
+// or with -h/--help anywhere, and returns the command path. Every global
+// flag takes a value, so a flag without "=" consumes the next argument.
+func helpRequest(args []string) ([]string, bool) {
+	var words []string
+	help := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-h" || a == "-help" || a == "--help":
+			help = true
+		case len(words) == 0 && strings.HasPrefix(a, "-"):
+			if !strings.Contains(a, "=") {
+				i++
+			}
+		case !strings.HasPrefix(a, "-"):
+			words = append(words, a)
+		}
+	}
+	if len(words) > 0 && words[0] == "help" {
+		return words[1:], true
+	}
+	return words, help
+}
+
+func commandLine(path []string) string {
+	return strings.Join(append([]string{programName}, path...), " ")
+}
+
+func printHelp(w io.Writer, cmd *command, path []string) {
+	line := commandLine(path)
+	if len(path) == 0 {
+		line = programName + " [global flags]"
+	}
+	switch {
+	case cmd.setup != nil:
+		fmt.Fprintf(w, "Usage: %s [flags] %s\n\n%s\n", line, cmd.args, cmd.summary)
+		fs := flag.NewFlagSet(line, flag.ContinueOnError)
+		cmd.setup(fs)
+		if hasFlags(fs) {
+			fmt.Fprintln(w, "\nFlags:")
+			fs.SetOutput(w)
+			fs.PrintDefaults()
+		}
+	default:
+		fmt.Fprintf(w, "Usage: %s <command> [flags] [args]\n\n%s\n\nCommands:\n", line, cmd.summary)
+		for _, s := range cmd.subs {
+			fmt.Fprintf(w, "  %-14s %s\n", s.name, s.summary)
+		}
+	}
+	if len(path) == 0 {
+		fmt.Fprintf(w, "\nRun %q for a command's flags.\n\nGlobal flags:\n", programName+" help <command>")
+		config.PrintFlags(w)
+		fmt.Fprintf(w, "\n")
+		fmt.Fprintf(w, "Exit codes: %d ok, %d failure, %d usage error, %d configuration error.\n",
+			ExitOK, ExitFailure, ExitUsage, ExitConfig)
+	}
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
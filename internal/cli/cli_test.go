@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/config"
+	"github.com/hionay/quotes/internal/schedule"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv("MYSQL_DSN", "user:secret@tcp(127.0.0.1:1)/quotes")
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantOutput string
+	}{
+		{[]string{"help"}, ExitOK, "Commands:"},
+		{[]string{"--help"}, ExitOK, "Global flags:"},
+		{[]string{"help", "quote", "add"}, ExitOK, "Usage: quotes quote add [flags] [text]"},
+		{[]string{"quote", "show", "--help"}, ExitOK, "Usage: quotes quote show"},
+		{[]string{"--page-size", "5", "export", "-h"}, ExitOK, "-output"},
+		{[]string{"config", "print"}, ExitOK, "mysql_dsn: user:REDACTED@"},
+		{[]string{"bogus"}, ExitUsage, `unknown command "bogus"`},
+		{[]string{"quote"}, ExitUsage, "Commands:"},
+		{[]string{"quote", "show"}, ExitUsage, "expected exactly one quote ID"},
+		{[]string{"quote", "show", "abc"}, ExitUsage, `invalid quote ID "abc"`},
+		{[]string{"export", "--bogus"}, ExitUsage, "flag provided but not defined"},
+		{[]string{"--page-size", "0", "config", "print"}, ExitConfig, "page_size"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := Run(context.Background(), tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.wantCode {
+			t.Errorf("Run(%q) = %d; want %d\nstderr: %s", tt.args, code, tt.wantCode, stderr.String())
+		}
+		if out := stdout.String() + stderr.String(); !strings.Contains(out, tt.wantOutput) {
+			t.Errorf("Run(%q) output does not contain %q:\n%s", tt.args, tt.wantOutput, out)
+		}
+	}
+}
+
+func TestScheduleJobs(t *testing.T) {
+	noop := func(context.Context) error { return nil }
+	jobs := []schedule.Job{
+		{Name: "related", Spec: "@hourly", Run: noop},
+		{Name: "qotd", Spec: "@daily", Run: noop},
+		{Name: "stats", Spec: "@every 15m", Run: noop, Local: true},
+	}
+	s := schedule.NewScheduler(nil, slog.Default(), time.UTC)
+	err := scheduleJobs(s, jobs, map[string]string{"related": "*/10 * * * *", "qotd": config.JobOff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, j := range s.Jobs() {
+		got = append(got, j.Name+"="+j.Spec)
+	}
+	if want := "related=*/10 * * * *,stats=@every 15m"; strings.Join(got, ",") != want {
+		t.Errorf("scheduled %q; want %q", got, want)
+	}
+
+	err = scheduleJobs(schedule.NewScheduler(nil, slog.Default(), time.UTC), jobs, map[string]string{"relatd": "@daily"})
+	if err == nil || !strings.Contains(err.Error(), `unknown job "relatd"`) {
+		t.Errorf("scheduleJobs() with a misspelt job: error = %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hionay/quotes/internal/config"
+	"github.com/hionay/quotes/internal/dedup"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/related"
+	"github.com/hionay/quotes/internal/repository"
+	"github.com/hionay/quotes/internal/schedule"
+)
+
+// serverJobs returns the background jobs of the server besides those of
+// the API.
+func serverJobs(e *env, db repository.Connection, s *schedule.Scheduler) []schedule.Job {
+	quotes := repository.NewQuoteRepository(db)
+	var jobs []schedule.Job
+	if days := e.cfg.IPRetentionDays(); days > 0 {
+		retention := time.Duration(days) * 24 * time.Hour
+		comments := repository.NewCommentRepository(db)
+		jobs = append(jobs, schedule.Job{Name: "scrub-ips", Spec: "@hourly", Run: func(ctx context.Context) error {
+			var rows int64
+			for _, scrubber := range []privacy.Scrubber{quotes, comments} {
+				n, err := scrubber.ScrubIPs(ctx, time.Now().Add(-retention))
+				if err != nil {
+					return err
+				}
+				rows += n
+			}
+			if rows > 0 {
+				e.logger.Info("Scrubbed IPs", slog.Int64("rows", rows))
+			}
+			return nil
+		}})
+	}
+	if interval := e.cfg.RelatedInterval(); interval > 0 {
+		updater := related.NewUpdater(quotes, repository.NewRelatedRepository(db))
+		jobs = append(jobs, schedule.Job{Name: "related", Spec: schedule.Every(interval), Run: func(ctx context.Context) error {
+			n, err := updater.Update(ctx)
+			if n > 0 {
+				e.logger.Info("Updated related quotes", slog.Int("quotes", n))
+			}
+			return err
+		}})
+	}
+	index := dedup.NewIndex(repository.NewFingerprintRepository(db), quotes)
+	jobs = append(jobs,
+		schedule.Job{Name: "fingerprints", Spec: "@hourly", Run: func(ctx context.Context) error {
+			n, err := index.Refresh(ctx)
+			if n > 0 {
+				e.logger.Info("Indexed quote fingerprints", slog.Int("quotes", n))
+			}
+			return err
+		}},
+		schedule.Job{Name: "job-history", Spec: "@daily", Run: s.PruneHistory},
+	)
+	return jobs
+}
+
+// scheduleJobs adds jobs to s with the schedules set in the configuration,
+// leaving out the disabled ones.
+func scheduleJobs(s *schedule.Scheduler, jobs []schedule.Job, schedules map[string]string) error {
+	schedules = maps.Clone(schedules)
+	for _, job := range jobs {
+		spec, ok := schedules[job.Name]
+		if ok {
+			delete(schedules, job.Name)
+			if spec == config.JobOff {
+				continue
+			}
+			job.Spec = spec
+		}
+		if err := s.Add(job); err != nil {
+			return err
+		}
+	}
+	if unknown := slices.Sorted(maps.Keys(schedules)); len(unknown) > 0 {
+		return fmt.Errorf("job_schedules: unknown job %q", unknown[0])
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/dedup"
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/render"
+	"github.com/hionay/quotes/internal/repository"
+	"github.com/hionay/quotes/internal/service"
+)
+
+// exportedQuote is the JSON Lines format of import and export. It
+// deliberately has no IP field.
+type exportedQuote struct {
+	ID      int       `json:"id"`
+	Quote   string    `json:"quote"`
+	Comment string    `json:"comment"`
+	Date    time.Time `json:"date"`
+	Likes   int       `json:"likes"`
+	Votes   int       `json:"votes"`
+}
+
+var importCommand = &command{
+	name:    "import",
+	args:    "<file|->",
+	summary: "Import quotes from a JSON Lines export",
+	setup: func(fs *flag.FlagSet) runFunc {
+		keepIDs := fs.Bool("keep-ids", false, "keep the IDs from the file instead of assigning new ones")
+		legacy := fs.Bool("legacy", false, "convert the <br /> markup in exports of older versions to newlines")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 1 {
+				return usageErrorf("import takes exactly one file")
+			}
+			r, closeFn, err := openInput(e, args[0])
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+			repo, err := quoteRepo(ctx, e)
+			if err != nil {
+				return err
+			}
+
+			sc := bufio.NewScanner(r)
+			sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+			n := 0
+			for line := 1; sc.Scan(); line++ {
+				if strings.TrimSpace(sc.Text()) == "" {
+					continue
+				}
+				var eq exportedQuote
+				if err := json.Unmarshal(sc.Bytes(), &eq); err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+				q := &domain.Quote{
+					Quote:   eq.Quote,
+					Comment: eq.Comment,
+					Date:    eq.Date,
+					Likes:   eq.Likes,
+					Votes:   eq.Votes,
+				}
+				if *keepIDs {
+					q.ID = eq.ID
+				}
+				if *legacy {
+					q.Quote = render.FromLegacy(q.Quote)
+					q.Comment = render.FromLegacy(q.Comment)
+				}
+				if err := repo.Import(ctx, q); err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+				n++
+			}
+			if err := sc.Err(); err != nil {
+				return fmt.Errorf("reading input: %w", err)
+			}
+			fmt.Fprintf(e.stderr, "imported %d quotes\n", n)
+			return nil
+		}
+	},
+}
+
+var exportCommand = &command{
+	name:    "export",
+	summary: "Export all quotes as JSON Lines",
+	setup: func(fs *flag.FlagSet) runFunc {
+		output := fs.String("output", "-", "file to write to, - for stdout")
+		return func(ctx context.Context, e *env, args []string) error {
+			if len(args) != 0 {
+				return usageErrorf("export takes no arguments")
+			}
+			repo, err := quoteRepo(ctx, e)
+			if err != nil {
+				return err
+			}
+			return writeOutput(e, *output, func(w io.Writer) error {
+				enc := json.NewEncoder(w)
+				return repo.Each(ctx, func(q *domain.Quote) error {
+					return enc.Encode(exportedQuote{
+						ID:      q.ID,
+						Quote:   q.Quote,
+						Comment: q.Comment,
+						Date:    q.Date,
+						Likes:   q.Likes,
+						Votes:   q.Votes,
+					})
+				})
+			})
+		}
+	},
+}
+
+var quoteCommand = &command{
+	name:    "quote",
+	summary: "Add, show or delete a single quote",
+	subs: []*command{
+		{
+			name:    "add",
+			args:    "[text]",
+			summary: "Add a quote; the text is read from stdin when not given",
+			setup: func(fs *flag.FlagSet) runFunc {
+				comment := fs.String("comment", "", "optional comment")
+				return func(ctx context.Context, e *env, args []string) error {
+					text := strings.Join(args, " ")
+					if text == "" {
+						b, err := io.ReadAll(e.stdin)
+						if err != nil {
+							return fmt.Errorf("reading stdin: %w", err)
+						}
+						text = strings.TrimRight(string(b), "\n")
+					}
+					if strings.TrimSpace(text) == "" {
+						return usageErrorf("quote text is empty")
+					}
+					quotes, err := quoteService(ctx, e)
+					if err != nil {
+						return err
+					}
+					q, err := quotes.Add(ctx, service.Submission{Quote: text, Comment: *comment, AllowDuplicate: true})
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stdout, "added quote %d\n", q.ID)
+					return nil
+				}
+			},
+		},
+		{
+			name:    "show",
+			args:    "<id>",
+			summary: "Print a quote",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(ctx context.Context, e *env, args []string) error {
+					id, err := parseID(args)
+					if err != nil {
+						return err
+					}
+					quotes, err := quoteService(ctx, e)
+					if err != nil {
+						return err
+					}
+					q, err := quotes.Get(ctx, id)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stdout, "#%d  %s  likes %d  votes %d\n\n%s\n",
+						q.ID, q.Date.Format(time.DateTime), q.Likes, q.Votes, q.Quote)
+					if q.Comment != "" {
+						fmt.Fprintf(e.stdout, "\n-- %s\n", q.Comment)
+					}
+					return nil
+				}
+			},
+		},
+		{
+			name:    "delete",
+			args:    "<id>",
+			summary: "Delete a quote",
+			setup: func(fs *flag.FlagSet) runFunc {
+				return func(ctx context.Context, e *env, args []string) error {
+					id, err := parseID(args)
+					if err != nil {
+						return err
+					}
+					quotes, err := quoteService(ctx, e)
+					if err != nil {
+						return err
+					}
+					if err := quotes.Delete(ctx, id); err != nil {
+						return err
+					}
+					fmt.Fprintf(e.stdout, "deleted quote %d\n", id)
+					return nil
+				}
+			},
+		},
+	},
+}
+
+func quoteRepo(ctx context.Context, e *env) (*repository.QuoteRepository, error) {
+	db, err := e.openDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewQuoteRepository(db), nil
+}
+
+// quoteService returns the service for commands working on single quotes.
+// The command line is trusted, so submissions skip the spam filters.
+func quoteService(ctx context.Context, e *env) (*service.QuoteService, error) {
+	db, err := e.openDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	repo := repository.NewQuoteRepository(db)
+	return service.NewQuoteService(repo, service.Options{
+		Logger:     e.logger,
+		Duplicates: dedup.NewIndex(repository.NewFingerprintRepository(db), repo),
+	}), nil
+}
+
+func parseID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, usageErrorf("expected exactly one quote ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id <= 0 {
+		return 0, usageErrorf("invalid quote ID %q", args[0])
+	}
+	return id, nil
+}
+
+// openInput opens path for reading, treating "-" as stdin.
+func openInput(e *env, path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return e.stdin, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// writeOutput calls write with path opened for writing, treating "-" as
+// stdout. A file is only left behind if write succeeds.
+func writeOutput(e *env, path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(e.stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
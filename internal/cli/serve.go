@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/hionay/quotes/internal/api"
+	"github.com/hionay/quotes/internal/repository"
+)
+
+var serveCommand = &command{
+	name:    "serve",
+	summary: "Run the web server (default command)",
+	setup: func(fs *flag.FlagSet) runFunc {
+		migrate := fs.Bool("migrate", false, "apply pending database migrations before serving")
+		return func(ctx context.Context, e *env, _ []string) error {
+			return serve(ctx, e, *migrate)
+		}
+	},
+}
+
+func serve(ctx context.Context, e *env, migrate bool) error {
+	db, err := e.openDB(ctx)
+	if err != nil {
+		return err
+	}
+	if migrate {
+		applied, err := repository.Migrate(ctx, db)
+		if err != nil {
+			return fmt.Errorf("repository.Migrate(): %w", err)
+		}
+		for _, v := range applied {
+			e.logger.Info("Applied migration", slog.String("version", v))
+		}
+	}
+
+	replicas, err := e.openReplicas(ctx)
+	if err != nil {
+		return err
+	}
+	a, err := api.NewAPI(e.cfg, e.logger, db, replicas...)
+	if err != nil {
+		return fmt.Errorf("api.NewAPI(): %w", err)
+	}
+
+	scheduler := a.Scheduler()
+	jobs := append(a.Jobs(), serverJobs(e, db, scheduler)...)
+	if err := scheduleJobs(scheduler, jobs, e.cfg.JobSchedules()); err != nil {
+		return err
+	}
+	scheduled := make(chan struct{})
+	go func() {
+		defer close(scheduled)
+		scheduler.Run(ctx)
+	}()
+
+	serveErrCh := make(chan error, 1)
+	go func() {
+		defer close(serveErrCh)
+		serveErrCh <- a.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serveErrCh:
+		return err
+	}
+	e.logger.Info("Shutting down the server")
+
+	if err := a.Shutdown(); err != nil {
+		e.logger.Error("Failed to shutdown server", slog.Any("err", err))
+	}
+	<-scheduled
+	return <-serveErrCh
+}
@@ -3,15 +3,71 @@ package cmdutil
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 
 	"github.com/hionay/quotes/internal/config"
 )
 
-func NewMySQLPool(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
+// The delay between attempts to reach the database at startup doubles from
+// firstConnectDelay up to maxConnectDelay.
+const (
+	firstConnectDelay = 250 * time.Millisecond
+	maxConnectDelay   = 5 * time.Second
+)
+
+// replicaPingTimeout bounds the single check of each read replica at
+// startup.
+const replicaPingTimeout = 5 * time.Second
+
+// NewMySQLPool opens the database pool and waits for the database to answer,
+// retrying for up to cfg.DBConnectTimeout() so the server can start before
+// MySQL is ready.
+func NewMySQLPool(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*sql.DB, error) {
+	return openPool(ctx, cfg, logger, cfg.MySQLDSN())
+}
+
+// NewMySQLReplicaPools opens a pool for each read replica in the
+// configuration. Replicas are optional: one that doesn't answer is logged
+// and kept, without waiting for it, since reads skip it until it is up.
+func NewMySQLReplicaPools(ctx context.Context, cfg *config.Config, logger *slog.Logger) ([]*sql.DB, error) {
+	var pools []*sql.DB
+	for _, dsn := range cfg.MySQLReplicaDSNs() {
+		db, err := newPool(cfg, dsn)
+		if err != nil {
+			for _, p := range pools {
+				p.Close()
+			}
+			return nil, err
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+		if err := db.PingContext(pingCtx); err != nil {
+			logger.Warn("Read replica is not reachable, reading from the others until it is", slog.Any("err", err))
+		}
+		cancel()
+		pools = append(pools, db)
+	}
+	return pools, nil
+}
+
+func openPool(ctx context.Context, cfg *config.Config, logger *slog.Logger, dsn string) (*sql.DB, error) {
+	db, err := newPool(cfg, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := retry(ctx, logger, cfg.DBConnectTimeout(), db.PingContext); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db.PingContext(): %w", err)
+	}
+	return db, nil
+}
+
+// newPool opens a pool sized by the configuration, without connecting.
+func newPool(cfg *config.Config, dsn string) (*sql.DB, error) {
 	maxConns := cfg.DBMaxOpenConns()
 	if maxConns <= 0 {
 		maxConns = 1
@@ -21,18 +77,48 @@ func NewMySQLPool(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
 		idleConns = 1
 	}
 
-	db, err := sql.Open("mysql", cfg.MySQLDSN())
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, fmt.Errorf("sql.Open(%q): %w", cfg.MySQLDSN(), err)
+		return nil, fmt.Errorf("sql.Open(%q): %w", dsn, err)
 	}
 
 	db.SetMaxOpenConns(maxConns)
 	db.SetMaxIdleConns(idleConns)
 	db.SetConnMaxLifetime(1 * time.Hour)
 	db.SetConnMaxIdleTime(30 * time.Second)
+	return db, nil
+}
 
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("db.PingContext(): %w", err)
+// retry calls fn until it succeeds or timeout has passed, waiting longer
+// after each failure. A timeout of zero calls fn once. Errors returned by
+// MySQL itself, such as a wrong password, aren't retried: the database is
+// up and retrying won't change its answer.
+func retry(ctx context.Context, logger *slog.Logger, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	delay := firstConnectDelay
+	var last error
+	for {
+		err := fn(ctx)
+		var me *mysql.MySQLError
+		if err == nil || errors.As(err, &me) {
+			return err
+		}
+		if ctx.Err() == nil || last == nil {
+			last = err
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("gave up after %v: %w", timeout, last)
+		}
+		logger.Warn("Database is not ready, retrying", slog.Duration("in", delay), slog.Any("err", err))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %v: %w", timeout, last)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxConnectDelay)
 	}
-	return db, nil
 }
@@ -0,0 +1,71 @@
+package cmdutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/hionay/quotes/internal/config"
+)
+
+func TestRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	refused := errors.New("connection refused")
+	denied := &mysql.MySQLError{Number: 1045, Message: "Access denied"}
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		errs    []error
+		want    error
+		calls   int
+	}{
+		{"ready later", time.Minute, []error{refused, refused}, nil, 3},
+		{"never ready", 300 * time.Millisecond, []error{refused, refused, refused}, refused, 2},
+		{"refused by mysql", time.Minute, []error{denied}, denied, 1},
+		{"no retries", 0, []error{refused}, refused, 1},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := retry(context.Background(), logger, tt.timeout, func(ctx context.Context) error {
+			calls++
+			if calls > len(tt.errs) {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return tt.errs[calls-1]
+		})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: retry() = %v; want %v", tt.name, err, tt.want)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: calls = %d; want %d", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+func TestReplicaPoolsKeepUnreachable(t *testing.T) {
+	t.Setenv("QUOTES_CONFIG", "")
+	t.Setenv("MYSQL_DSN", "quotes:secret@tcp(127.0.0.1:1)/quotes")
+	t.Setenv("MYSQL_REPLICA_DSNS", "quotes:secret@tcp(127.0.0.1:1)/quotes?timeout=1s")
+	t.Setenv("DB_CONNECT_TIMEOUT", "1m")
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	pools, err := NewMySQLReplicaPools(context.Background(), cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil || len(pools) != 1 {
+		t.Fatalf("NewMySQLReplicaPools() = %d pools, %v; want the unreachable replica kept", len(pools), err)
+	}
+	defer pools[0].Close()
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("NewMySQLReplicaPools() took %v; want no waiting for the replica", d)
+	}
+}
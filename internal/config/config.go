@@ -1,38 +1,162 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/joho/godotenv/autoload"
+	"gopkg.in/yaml.v3"
 )
 
-const (
-	envMySQLDSN       = "MYSQL_DSN"
-	envServerPort     = "SERVER_PORT"
-	envDBMaxOpenConns = "DB_MAX_OPEN_CONNS"
-	envDBMaxIdleConns = "DB_MAX_IDLE_CONNS"
-)
+// envConfigFile names the YAML file to load when --config isn't given.
+const envConfigFile = "QUOTES_CONFIG"
 
 const (
-	defaultServerPort     = 8080
-	defaultMySQLPort      = 3306
-	defaultDBMaxOpenConns = 3
+	defaultServerPort       = 8080
+	defaultMySQLPort        = 3306
+	defaultDBMaxOpenConns   = 3
+	defaultDBConnectTimeout = time.Minute
+	defaultDBQueryTimeout   = 10 * time.Second
+	defaultQuoteMinLength   = 3
+	defaultQuoteMaxLength   = 4000
+	defaultSpamMaxLinks     = 2
+	defaultSpamRateLimit    = 10
+	defaultPowDifficulty    = 16
+	defaultIPRetention      = 90
+	defaultReadTimeout      = 10 * time.Second
+	defaultWriteTimeout     = 30 * time.Second
+	defaultIdleTimeout      = 120 * time.Second
+	defaultShutdownTimeout  = 30 * time.Second
+	defaultPageSize         = 10
+	defaultQOTDTimezone     = "UTC"
+	defaultQOTDWindowDays   = 365
+	defaultStatsCacheTTL    = 15 * time.Minute
+	defaultRelatedInterval  = time.Hour
+	defaultCacheSize        = 1000
+	defaultCacheTTL         = time.Minute
 )
 
+// defaultMarkup is every kind of lightweight markup quotes may use.
+var defaultMarkup = []string{"code", "actions", "links"}
+
+// defaultReactions are the emoji reactions offered on quotes, as name:emoji.
+var defaultReactions = []string{"funny:😂", "facepalm:🤦", "love:❤️"}
+
+// JobOff is the schedule that disables a background job.
+const JobOff = "off"
+
+const redacted = "REDACTED"
+
+// redactDSN replaces the password in a data source name. A DSN that
+// doesn't parse is redacted whole, since there's no telling where its
+// password ends.
+func redactDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redacted
+	}
+	return cfg.FormatDSN()
+}
+
 type Config struct {
 	opts Options
 }
 
-func NewConfig() *Config {
-	opts := ReadOptionsFromEnv()
-	return &Config{opts: opts}
+// Load builds the effective configuration from, in increasing order of
+// precedence: built-in defaults, the YAML file given by --config (or
+// $QUOTES_CONFIG), environment variables and command-line flags. Every
+// malformed or invalid value is reported, not just the first one. The
+// arguments left after the flags are returned.
+func Load(args []string) (*Config, []string, error) {
+	opts := DefaultOptions()
+
+	fs, configPath := newFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configPath != "" {
+		if err := opts.loadFile(*configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if v := os.Getenv(f.env); v != "" {
+			errs = append(errs, f.set(&opts, v, "$"+f.env))
+		}
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flagName() == fl.Name {
+				errs = append(errs, f.set(&opts, fl.Value.String(), "--"+fl.Name))
+			}
+		}
+	})
+	errs = append(errs, opts.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return &Config{opts: opts}, fs.Args(), nil
+}
+
+// PrintFlags writes the usage of the flags Load accepts.
+func PrintFlags(w io.Writer) {
+	fs, _ := newFlagSet()
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func newFlagSet() (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("quotes", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := fs.String("config", os.Getenv(envConfigFile), "path to a YAML config file ($"+envConfigFile+")")
+	for _, f := range fields {
+		fs.String(f.flagName(), "", f.usage+" ($"+f.env+")")
+	}
+	return fs, configPath
+}
+
+// Print writes the effective configuration as YAML with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	opts := c.opts
+	opts.IPMode = c.IPMode()
+	opts.MySQLDSN = redactDSN(opts.MySQLDSN)
+	opts.MySQLReplicaDSNs = make([]string, len(c.opts.MySQLReplicaDSNs))
+	for i, dsn := range c.opts.MySQLReplicaDSNs {
+		opts.MySQLReplicaDSNs[i] = redactDSN(dsn)
+	}
+	if opts.IPHashKey != "" {
+		opts.IPHashKey = redacted
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(printable(opts)); err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	return enc.Close()
 }
 
 func (c *Config) MySQLDSN() string {
 	return c.opts.MySQLDSN
 }
 
+// MySQLReplicaDSNs returns the data source names of read replicas of the
+// database, if any.
+func (c *Config) MySQLReplicaDSNs() []string {
+	return c.opts.MySQLReplicaDSNs
+}
+
 func (c *Config) ServerPort() int {
 	return c.opts.ServerPort
 }
@@ -45,34 +169,239 @@ func (c *Config) DBMaxIdleConns() int {
 	return c.opts.DBMaxIdleConns
 }
 
+// DBConnectTimeout returns how long to keep retrying the first connection
+// to the database at startup; zero tries once.
+func (c *Config) DBConnectTimeout() time.Duration {
+	return c.opts.DBConnectTimeout
+}
+
+// DBQueryTimeout returns how long a single query may take; zero disables
+// the limit.
+func (c *Config) DBQueryTimeout() time.Duration {
+	return c.opts.DBQueryTimeout
+}
+
+func (c *Config) QuoteMinLength() int {
+	return c.opts.QuoteMinLength
+}
+
+func (c *Config) QuoteMaxLength() int {
+	return c.opts.QuoteMaxLength
+}
+
+func (c *Config) SpamMaxLinks() int {
+	return c.opts.SpamMaxLinks
+}
+
+func (c *Config) SpamBannedWords() []string {
+	return c.opts.SpamBannedWords
+}
+
+// SpamRateLimit returns how many quotes, and how many comments, an
+// address may submit per hour; zero disables the limit.
+func (c *Config) SpamRateLimit() int {
+	return c.opts.SpamRateLimit
+}
+
+func (c *Config) SpamModelPath() string {
+	return c.opts.SpamModelPath
+}
+
+func (c *Config) PowDifficulty() int {
+	return c.opts.PowDifficulty
+}
+
+// IPMode returns how client addresses are anonymised: "hash" by default
+// when IP_HASH_KEY is set, "truncate" otherwise.
+func (c *Config) IPMode() string {
+	if c.opts.IPMode != "" {
+		return c.opts.IPMode
+	}
+	if c.opts.IPHashKey != "" {
+		return "hash"
+	}
+	return "truncate"
+}
+
+func (c *Config) IPHashKey() string {
+	return c.opts.IPHashKey
+}
+
+// IPRetentionDays returns after how many days stored identifiers are
+// scrubbed; zero disables the retention job.
+func (c *Config) IPRetentionDays() int {
+	return c.opts.IPRetentionDays
+}
+
+// TrustedProxies returns the CIDRs or addresses of reverse proxies whose
+// forwarding headers are believed.
+func (c *Config) TrustedProxies() []string {
+	return c.opts.TrustedProxies
+}
+
+func (c *Config) ReadTimeout() time.Duration {
+	return c.opts.ReadTimeout
+}
+
+func (c *Config) WriteTimeout() time.Duration {
+	return c.opts.WriteTimeout
+}
+
+func (c *Config) IdleTimeout() time.Duration {
+	return c.opts.IdleTimeout
+}
+
+func (c *Config) ShutdownTimeout() time.Duration {
+	return c.opts.ShutdownTimeout
+}
+
+func (c *Config) PageSize() int {
+	return c.opts.PageSize
+}
+
+// QOTDTimezone names the timezone whose calendar days the Quote of the Day
+// follows.
+func (c *Config) QOTDTimezone() string {
+	return c.opts.QOTDTimezone
+}
+
+// QOTDWindowDays returns for how many days a Quote of the Day isn't chosen
+// again.
+func (c *Config) QOTDWindowDays() int {
+	return c.opts.QOTDWindowDays
+}
+
+// StatsCacheTTL returns how long the statistics page is cached.
+func (c *Config) StatsCacheTTL() time.Duration {
+	return c.opts.StatsCacheTTL
+}
+
+// RelatedInterval returns how often the related quotes are recomputed;
+// zero disables the background job.
+func (c *Config) RelatedInterval() time.Duration {
+	return c.opts.RelatedInterval
+}
+
+// JobSchedules returns the schedules set for background jobs by name,
+// overriding their defaults. A schedule of JobOff disables a job.
+func (c *Config) JobSchedules() map[string]string {
+	schedules := make(map[string]string)
+	for _, entry := range splitSchedules(c.opts.JobSchedules) {
+		name, spec, _ := strings.Cut(entry, "=")
+		schedules[strings.TrimSpace(name)] = strings.TrimSpace(spec)
+	}
+	return schedules
+}
+
+// CacheSize returns how many repository reads are cached in memory; zero
+// disables the cache.
+func (c *Config) CacheSize() int {
+	return c.opts.CacheSize
+}
+
+func (c *Config) CacheTTL() time.Duration {
+	return c.opts.CacheTTL
+}
+
+// Markup returns the lightweight markup rendered in quotes: "code",
+// "actions" and "links".
+func (c *Config) Markup() []string {
+	return c.opts.Markup
+}
+
+// Reactions returns the emoji reactions offered on quotes, each as
+// "name:emoji".
+func (c *Config) Reactions() []string {
+	return c.opts.Reactions
+}
+
 type Options struct {
-	MySQLDSN       string
-	ServerPort     int
-	DBMaxOpenConns int
-	DBMaxIdleConns int
+	MySQLDSN         string        `yaml:"mysql_dsn"`
+	MySQLReplicaDSNs []string      `yaml:"mysql_replica_dsns"`
+	ServerPort       int           `yaml:"server_port"`
+	DBMaxOpenConns   int           `yaml:"db_max_open_conns"`
+	DBMaxIdleConns   int           `yaml:"db_max_idle_conns"`
+	DBConnectTimeout time.Duration `yaml:"db_connect_timeout"`
+	DBQueryTimeout   time.Duration `yaml:"db_query_timeout"`
+	QuoteMinLength   int           `yaml:"quote_min_length"`
+	QuoteMaxLength   int           `yaml:"quote_max_length"`
+	SpamMaxLinks     int           `yaml:"spam_max_links"`
+	SpamBannedWords  []string      `yaml:"spam_banned_words"`
+	SpamModelPath    string        `yaml:"spam_model_path"`
+	SpamRateLimit    int           `yaml:"spam_rate_limit"`
+	PowDifficulty    int           `yaml:"pow_difficulty"`
+	IPMode           string        `yaml:"ip_mode"`
+	IPHashKey        string        `yaml:"ip_hash_key"`
+	IPRetentionDays  int           `yaml:"ip_retention_days"`
+	TrustedProxies   []string      `yaml:"trusted_proxies"`
+	ReadTimeout      time.Duration `yaml:"read_timeout"`
+	WriteTimeout     time.Duration `yaml:"write_timeout"`
+	IdleTimeout      time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+	PageSize         int           `yaml:"page_size"`
+	QOTDTimezone     string        `yaml:"qotd_timezone"`
+	QOTDWindowDays   int           `yaml:"qotd_window_days"`
+	StatsCacheTTL    time.Duration `yaml:"stats_cache_ttl"`
+	RelatedInterval  time.Duration `yaml:"related_interval"`
+	JobSchedules     string        `yaml:"job_schedules"`
+	CacheSize        int           `yaml:"cache_size"`
+	CacheTTL         time.Duration `yaml:"cache_ttl"`
+	Markup           []string      `yaml:"markup"`
+	Reactions        []string      `yaml:"reactions"`
 }
 
-func ReadOptionsFromEnv() Options {
+func DefaultOptions() Options {
 	return Options{
-		MySQLDSN:       getEnvString(envMySQLDSN, ""),
-		ServerPort:     getEnvInt(envServerPort, defaultServerPort),
-		DBMaxOpenConns: getEnvInt(envDBMaxOpenConns, defaultDBMaxOpenConns),
-		DBMaxIdleConns: getEnvInt(envDBMaxIdleConns, defaultDBMaxOpenConns),
+		ServerPort:       defaultServerPort,
+		DBMaxOpenConns:   defaultDBMaxOpenConns,
+		DBMaxIdleConns:   defaultDBMaxOpenConns,
+		DBConnectTimeout: defaultDBConnectTimeout,
+		DBQueryTimeout:   defaultDBQueryTimeout,
+		QuoteMinLength:   defaultQuoteMinLength,
+		QuoteMaxLength:   defaultQuoteMaxLength,
+		SpamMaxLinks:     defaultSpamMaxLinks,
+		SpamRateLimit:    defaultSpamRateLimit,
+		PowDifficulty:    defaultPowDifficulty,
+		IPRetentionDays:  defaultIPRetention,
+		ReadTimeout:      defaultReadTimeout,
+		WriteTimeout:     defaultWriteTimeout,
+		IdleTimeout:      defaultIdleTimeout,
+		ShutdownTimeout:  defaultShutdownTimeout,
+		PageSize:         defaultPageSize,
+		QOTDTimezone:     defaultQOTDTimezone,
+		QOTDWindowDays:   defaultQOTDWindowDays,
+		StatsCacheTTL:    defaultStatsCacheTTL,
+		RelatedInterval:  defaultRelatedInterval,
+		CacheSize:        defaultCacheSize,
+		CacheTTL:         defaultCacheTTL,
+		Markup:           defaultMarkup,
+		Reactions:        defaultReactions,
 	}
 }
 
-func getEnvString(key string, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (o *Options) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("os.Open(%q): %w", path, err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(o); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing %s: %w", path, err)
 	}
-	return defaultValue
+	return nil
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// printable renders durations as strings; yaml.v3 would print nanoseconds.
+func printable(o Options) map[string]any {
+	out := map[string]any{}
+	b, _ := yaml.Marshal(o)
+	_ = yaml.Unmarshal(b, &out)
+	for _, f := range fields {
+		if d, ok := f.ptr(&o).(*time.Duration); ok {
+			out[f.key] = d.String()
 		}
 	}
-	return defaultValue
+	return out
 }
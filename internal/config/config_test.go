@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.yaml")
+	yml := "mysql_dsn: file:secret@tcp(db)/quotes\nserver_port: 9000\npage_size: 15\nread_timeout: 5s\n"
+	if err := os.WriteFile(path, []byte(yml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MYSQL_DSN", "")
+	t.Setenv("SERVER_PORT", "9100")
+	t.Setenv("PAGE_SIZE", "")
+	t.Setenv("MYSQL_REPLICA_DSNS", "reader:hunter2@tcp(replica1)/quotes, reader:hun@ter2@tcp(replica2)/quotes")
+
+	cfg, args, err := Load([]string{"--config", path, "--page-size", "20",
+		"--job-schedules", " related = 0 */6 * * 1,3 ; qotd=off", "config", "print"})
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if strings.Join(args, " ") != "config print" {
+		t.Errorf("args = %q; want %q", args, "config print")
+	}
+	if got := cfg.ServerPort(); got != 9100 {
+		t.Errorf("ServerPort() = %d; want env value 9100", got)
+	}
+	if got := cfg.PageSize(); got != 20 {
+		t.Errorf("PageSize() = %d; want flag value 20", got)
+	}
+	if got := cfg.ReadTimeout(); got != 5*time.Second {
+		t.Errorf("ReadTimeout() = %v; want file value 5s", got)
+	}
+	if got := cfg.JobSchedules(); got["related"] != "0 */6 * * 1,3" || got["qotd"] != JobOff || len(got) != 2 {
+		t.Errorf("JobSchedules() = %q; want related and qotd", got)
+	}
+	if got := cfg.MySQLReplicaDSNs(); len(got) != 2 || got[1] != "reader:hun@ter2@tcp(replica2)/quotes" {
+		t.Errorf("MySQLReplicaDSNs() = %q; want both replicas", got)
+	}
+	if got := cfg.WriteTimeout(); got != defaultWriteTimeout {
+		t.Errorf("WriteTimeout() = %v; want default %v", got, defaultWriteTimeout)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "hunter2") ||
+		strings.Contains(buf.String(), "ter2") || !strings.Contains(buf.String(), "file:REDACTED@tcp(db:3306)/quotes") ||
+		!strings.Contains(buf.String(), "reader:REDACTED@tcp(replica2:3306)/quotes") {
+		t.Errorf("Print() did not redact the DSN password:\n%s", buf.String())
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	t.Setenv("MYSQL_DSN", "")
+	t.Setenv("DB_MAX_OPEN_CONNS", "1O")
+	_, _, err := Load([]string{"--page-size", "0", "--ip-mode", "hash", "--reactions", "funny:😂,Funny:x,funny:🤣", "--related-interval", "-1h", "--db-query-timeout", "-1s", "--job-schedules", "related=61 * * * *;qotd"})
+	if err == nil {
+		t.Fatal("Load() = nil error; want error")
+	}
+	for _, want := range []string{"DB_MAX_OPEN_CONNS", "mysql_dsn is required", "page_size", "ip_hash_key", `"Funny:x" must be name:emoji`, `"funny" is listed twice`, "related_interval", "db_query_timeout", `"61" is outside 0-59`, `"qotd" must be job=spec`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error %q does not mention %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/schedule"
+)
+
+// reactionNameRe matches the names of emoji reactions, which appear in URLs.
+var reactionNameRe = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// field describes one option for the environment and flag layers. The YAML
+// layer decodes straight into Options using the struct tags.
+type field struct {
+	key   string
+	env   string
+	usage string
+	ptr   func(*Options) any
+}
+
+var fields = []field{
+	{"mysql_dsn", "MYSQL_DSN", "MySQL data source name", func(o *Options) any { return &o.MySQLDSN }},
+	{"mysql_replica_dsns", "MYSQL_REPLICA_DSNS", "comma separated data source names of MySQL read replicas", func(o *Options) any { return &o.MySQLReplicaDSNs }},
+	{"server_port", "SERVER_PORT", "HTTP listen port", func(o *Options) any { return &o.ServerPort }},
+	{"db_max_open_conns", "DB_MAX_OPEN_CONNS", "maximum open database connections", func(o *Options) any { return &o.DBMaxOpenConns }},
+	{"db_max_idle_conns", "DB_MAX_IDLE_CONNS", "maximum idle database connections", func(o *Options) any { return &o.DBMaxIdleConns }},
+	{"db_connect_timeout", "DB_CONNECT_TIMEOUT", "how long to retry connecting to the database at startup, 0 tries once", func(o *Options) any { return &o.DBConnectTimeout }},
+	{"db_query_timeout", "DB_QUERY_TIMEOUT", "database query timeout, 0 disables", func(o *Options) any { return &o.DBQueryTimeout }},
+	{"quote_min_length", "QUOTE_MIN_LENGTH", "minimum quote length", func(o *Options) any { return &o.QuoteMinLength }},
+	{"quote_max_length", "QUOTE_MAX_LENGTH", "maximum quote and comment length", func(o *Options) any { return &o.QuoteMaxLength }},
+	{"spam_max_links", "SPAM_MAX_LINKS", "maximum links in a submission", func(o *Options) any { return &o.SpamMaxLinks }},
+	{"spam_banned_words", "SPAM_BANNED_WORDS", "comma separated banned words", func(o *Options) any { return &o.SpamBannedWords }},
+	{"spam_model_path", "SPAM_MODEL_PATH", "file to persist the spam classifier in", func(o *Options) any { return &o.SpamModelPath }},
+	{"spam_rate_limit", "SPAM_RATE_LIMIT", "quotes and comments an address may submit per hour, 0 disables", func(o *Options) any { return &o.SpamRateLimit }},
+	{"pow_difficulty", "POW_DIFFICULTY", "proof-of-work difficulty in bits, 0 disables", func(o *Options) any { return &o.PowDifficulty }},
+	{"ip_mode", "IP_MODE", "how client IPs are stored: hash, truncate or none", func(o *Options) any { return &o.IPMode }},
+	{"ip_hash_key", "IP_HASH_KEY", "secret key for hashed IPs", func(o *Options) any { return &o.IPHashKey }},
+	{"ip_retention_days", "IP_RETENTION_DAYS", "days after which stored IPs are scrubbed, 0 disables", func(o *Options) any { return &o.IPRetentionDays }},
+	{"trusted_proxies", "TRUSTED_PROXIES", "comma separated CIDRs of trusted reverse proxies", func(o *Options) any { return &o.TrustedProxies }},
+	{"read_timeout", "READ_TIMEOUT", "HTTP read timeout", func(o *Options) any { return &o.ReadTimeout }},
+	{"write_timeout", "WRITE_TIMEOUT", "HTTP write timeout", func(o *Options) any { return &o.WriteTimeout }},
+	{"idle_timeout", "IDLE_TIMEOUT", "HTTP idle timeout", func(o *Options) any { return &o.IdleTimeout }},
+	{"shutdown_timeout", "SHUTDOWN_TIMEOUT", "graceful shutdown timeout", func(o *Options) any { return &o.ShutdownTimeout }},
+	{"page_size", "PAGE_SIZE", "quotes per page", func(o *Options) any { return &o.PageSize }},
+	{"qotd_timezone", "QOTD_TIMEZONE", "IANA timezone of the Quote of the Day calendar", func(o *Options) any { return &o.QOTDTimezone }},
+	{"qotd_window_days", "QOTD_WINDOW_DAYS", "days before a Quote of the Day may repeat", func(o *Options) any { return &o.QOTDWindowDays }},
+	{"cache_size", "CACHE_SIZE", "cached quotes and listings, 0 disables", func(o *Options) any { return &o.CacheSize }},
+	{"cache_ttl", "CACHE_TTL", "how long cached quotes and listings are kept", func(o *Options) any { return &o.CacheTTL }},
+	{"stats_cache_ttl", "STATS_CACHE_TTL", "how long statistics are cached, 0 disables", func(o *Options) any { return &o.StatsCacheTTL }},
+	{"related_interval", "RELATED_INTERVAL", "how often related quotes are recomputed, 0 disables", func(o *Options) any { return &o.RelatedInterval }},
+	{"job_schedules", "JOB_SCHEDULES", "semicolon separated job=spec overrides of background job schedules, spec off disables a job", func(o *Options) any { return &o.JobSchedules }},
+	{"markup", "MARKUP", "comma separated markup rendered in quotes: code, actions, links", func(o *Options) any { return &o.Markup }},
+	{"reactions", "REACTIONS", "comma separated emoji reactions offered on quotes, as name:emoji", func(o *Options) any { return &o.Reactions }},
+}
+
+func (f field) flagName() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func (f field) set(o *Options, value, source string) error {
+	switch p := f.ptr(o).(type) {
+	case *string:
+		*p = value
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", source, value)
+		}
+		*p = i
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", source, value)
+		}
+		*p = d
+	case *[]string:
+		*p = splitList(value)
+	}
+	return nil
+}
+
+// splitSchedules splits job schedules on semicolons, since cron specs have
+// commas of their own.
+func splitSchedules(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// Validate reports every option that is out of range.
+func (o *Options) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	check(o.MySQLDSN != "", "mysql_dsn is required")
+	check(o.ServerPort > 0 && o.ServerPort <= 65535, "server_port must be between 1 and 65535, got %d", o.ServerPort)
+	check(o.DBMaxOpenConns > 0, "db_max_open_conns must be positive, got %d", o.DBMaxOpenConns)
+	check(o.DBMaxIdleConns >= 0, "db_max_idle_conns must not be negative, got %d", o.DBMaxIdleConns)
+	check(o.DBConnectTimeout >= 0, "db_connect_timeout must not be negative")
+	check(o.DBQueryTimeout >= 0, "db_query_timeout must not be negative")
+	check(o.QuoteMinLength >= 0, "quote_min_length must not be negative, got %d", o.QuoteMinLength)
+	check(o.QuoteMaxLength >= o.QuoteMinLength && o.QuoteMaxLength > 0,
+		"quote_max_length must be positive and at least quote_min_length, got %d", o.QuoteMaxLength)
+	check(o.SpamMaxLinks >= 0, "spam_max_links must not be negative, got %d", o.SpamMaxLinks)
+	check(o.SpamRateLimit >= 0, "spam_rate_limit must not be negative, got %d", o.SpamRateLimit)
+	check(o.PowDifficulty >= 0 && o.PowDifficulty <= 32, "pow_difficulty must be between 0 and 32, got %d", o.PowDifficulty)
+	switch o.IPMode {
+	case "", "truncate", "none":
+	case "hash":
+		check(o.IPHashKey != "", "ip_mode hash requires ip_hash_key")
+	default:
+		check(false, "ip_mode must be hash, truncate or none, got %q", o.IPMode)
+	}
+	check(o.IPRetentionDays >= 0, "ip_retention_days must not be negative, got %d", o.IPRetentionDays)
+	for _, p := range o.TrustedProxies {
+		_, prefixErr := netip.ParsePrefix(p)
+		_, addrErr := netip.ParseAddr(p)
+		check(prefixErr == nil || addrErr == nil, "trusted_proxies: %q is not a CIDR or address", p)
+	}
+	check(o.ReadTimeout > 0, "read_timeout must be positive")
+	check(o.WriteTimeout > 0, "write_timeout must be positive")
+	check(o.IdleTimeout > 0, "idle_timeout must be positive")
+	check(o.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	check(o.PageSize > 0 && o.PageSize <= 100, "page_size must be between 1 and 100, got %d", o.PageSize)
+	_, tzErr := time.LoadLocation(o.QOTDTimezone)
+	check(tzErr == nil, "qotd_timezone: unknown timezone %q", o.QOTDTimezone)
+	check(o.QOTDWindowDays >= 0, "qotd_window_days must not be negative, got %d", o.QOTDWindowDays)
+	check(o.StatsCacheTTL >= 0, "stats_cache_ttl must not be negative")
+	check(o.RelatedInterval >= 0, "related_interval must not be negative")
+	for _, entry := range splitSchedules(o.JobSchedules) {
+		name, spec, _ := strings.Cut(entry, "=")
+		name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+		check(name != "" && spec != "", "job_schedules: %q must be job=spec", entry)
+		if name != "" && spec != "" && spec != JobOff {
+			_, err := schedule.Parse(spec)
+			check(err == nil, "job_schedules: %v", err)
+		}
+	}
+	check(o.CacheSize >= 0, "cache_size must not be negative, got %d", o.CacheSize)
+	check(o.CacheSize == 0 || o.CacheTTL > 0, "cache_ttl must be positive when the cache is enabled")
+	for _, m := range o.Markup {
+		check(slices.Contains(defaultMarkup, m), "markup: unknown markup %q, want code, actions or links", m)
+	}
+	names := map[string]bool{}
+	for _, r := range o.Reactions {
+		name, emoji, _ := strings.Cut(r, ":")
+		check(reactionNameRe.MatchString(name) && emoji != "",
+			"reactions: %q must be name:emoji with a lowercase name", r)
+		check(!names[name], "reactions: %q is listed twice", name)
+		names[name] = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
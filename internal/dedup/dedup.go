@@ -0,0 +1,211 @@
+// Package dedup finds quotes that were submitted more than once. Quotes are
+// compared by the simhash of their normalised text, which differs in only a
+// few bits for texts that differ in only a few characters.
+package dedup
+
+import (
+	"context"
+	"hash/fnv"
+	"math/bits"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/spam"
+)
+
+const (
+	// MaxDistance is how many bits the fingerprints of near-duplicates
+	// differ in at most: about a changed word in a quote of a few lines.
+	// Unrelated quotes differ in around 32.
+	MaxDistance = 8
+	// bands is how many parts fingerprints are split into when looking
+	// for pairs. With more parts than MaxDistance, near-duplicates always
+	// have at least one part in common.
+	bands    = MaxDistance + 1
+	bandBits = 64 / bands
+	// shingleLength is how many characters make up each feature.
+	shingleLength = 4
+)
+
+// timestampRe matches the timestamps IRC clients put before log lines,
+// which copies of the same log often have or lack.
+var timestampRe = regexp.MustCompile(`(?m)^\s*\[?\d{1,2}:\d{2}(?::\d{2})?\]?`)
+
+// Fingerprint returns the simhash of the normalised text of a quote, over
+// its overlapping runs of shingleLength letters and digits. Copies that
+// only differ in case, whitespace, punctuation or timestamps get the same
+// fingerprint.
+func Fingerprint(text string) uint64 {
+	text = timestampRe.ReplaceAllString(text, "")
+	runes := []rune(strings.ReplaceAll(spam.Normalize(text), " ", ""))
+	var weights [64]int
+	add := func(feature []rune) {
+		h := fnv.New64a()
+		h.Write([]byte(string(feature)))
+		f := mix(h.Sum64())
+		for i := range weights {
+			if f&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(runes) <= shingleLength {
+		add(runes)
+	}
+	for i := 0; i+shingleLength <= len(runes); i++ {
+		add(runes[i : i+shingleLength])
+	}
+	var fp uint64
+	for i, w := range weights {
+		if w > 0 {
+			fp |= 1 << i
+		}
+	}
+	return fp
+}
+
+// mix is the finaliser of SplitMix64. FNV spreads short inputs poorly over
+// the high bits, which simhash weighs as much as the low ones.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Distance returns how many bits two fingerprints differ in.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func band(fp uint64, i int) uint64 {
+	return fp >> (bandBits * i) & (1<<bandBits - 1)
+}
+
+// Clusters groups quotes whose fingerprints are near-duplicates, directly
+// or through other quotes of the group. Each cluster is sorted by ID and
+// the clusters by their first ID; quotes without duplicates are left out.
+func Clusters(fingerprints map[int]uint64) [][]int {
+	parent := make(map[int]int, len(fingerprints))
+	var find func(int) int
+	find = func(id int) int {
+		p, ok := parent[id]
+		if !ok || p == id {
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+
+	ids := make([]int, 0, len(fingerprints))
+	for id := range fingerprints {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for i := range bands {
+		buckets := make(map[uint64][]int)
+		for _, id := range ids {
+			b := band(fingerprints[id], i)
+			buckets[b] = append(buckets[b], id)
+		}
+		for _, bucket := range buckets {
+			for i, a := range bucket {
+				for _, b := range bucket[i+1:] {
+					if Distance(fingerprints[a], fingerprints[b]) > MaxDistance {
+						continue
+					}
+					if ra, rb := find(a), find(b); ra != rb {
+						parent[max(ra, rb)] = min(ra, rb)
+					}
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for _, id := range ids {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+	}
+	var clusters [][]int
+	for _, g := range groups {
+		if len(g) > 1 {
+			clusters = append(clusters, g)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0] < clusters[j][0] })
+	return clusters
+}
+
+// Source yields every quote of the archive.
+type Source interface {
+	Each(context.Context, func(*domain.Quote) error) error
+}
+
+// Index keeps the fingerprint of every quote in a repository, so that
+// submissions can be checked against the whole archive.
+type Index struct {
+	repo   domain.FingerprintRepository
+	quotes Source
+}
+
+func NewIndex(repo domain.FingerprintRepository, quotes Source) *Index {
+	return &Index{repo: repo, quotes: quotes}
+}
+
+// Add stores the fingerprint of a new quote.
+func (x *Index) Add(ctx context.Context, q *domain.Quote) error {
+	return x.repo.Put(ctx, q.ID, Fingerprint(q.Quote))
+}
+
+// Near returns the IDs of the quotes a text is a near-duplicate of.
+func (x *Index) Near(ctx context.Context, text string) ([]int, error) {
+	return x.repo.Near(ctx, Fingerprint(text), MaxDistance)
+}
+
+// Refresh stores the fingerprints of quotes that have none or an outdated
+// one, such as imported quotes, and returns how many it stored.
+func (x *Index) Refresh(ctx context.Context) (int, error) {
+	_, n, err := x.refresh(ctx)
+	return n, err
+}
+
+// Clusters refreshes the index and returns the groups of near-duplicate
+// quotes in the archive.
+func (x *Index) Clusters(ctx context.Context) ([][]int, error) {
+	fingerprints, _, err := x.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Clusters(fingerprints), nil
+}
+
+func (x *Index) refresh(ctx context.Context) (map[int]uint64, int, error) {
+	stored, err := x.repo.All(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	fingerprints := make(map[int]uint64)
+	n := 0
+	err = x.quotes.Each(ctx, func(q *domain.Quote) error {
+		fp := Fingerprint(q.Quote)
+		fingerprints[q.ID] = fp
+		if old, ok := stored[q.ID]; ok && old == fp {
+			return nil
+		}
+		n++
+		return x.repo.Put(ctx, q.ID, fp)
+	})
+	if err != nil {
+		return nil, n, err
+	}
+	return fingerprints, n, nil
+}
@@ -0,0 +1,53 @@
+package dedup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFingerprintIgnoresFormatting(t *testing.T) {
+	base := "<alice> did you reboot the server?\n<bob> which one, we have three"
+	variants := []string{
+		"<Alice> Did you reboot the server\n<Bob> which one... we have THREE",
+		"[12:01] <alice> did you reboot the server?\n[12:02] <bob> which one, we have three",
+		"  <alice>  did you reboot the server?\r\n<bob> which one, we have three\n",
+	}
+	want := Fingerprint(base)
+	for _, v := range variants {
+		if d := Distance(Fingerprint(v), want); d != 0 {
+			t.Errorf("Distance(%q) = %d; want 0", v, d)
+		}
+	}
+}
+
+func TestFingerprintDistance(t *testing.T) {
+	base := "<alice> did you reboot the server before lunch?\n<bob> which one, we have three of them\n" +
+		"<alice> the one that hosts the wiki\n<bob> oh. no, I thought you did"
+	edited := "<alice> did you reboot the server before lunch?\n<bob> which one, we have three of them\n" +
+		"<alice> the one that hosts the wiki\n<bob> oh. no, i thougth you did"
+	other := "<carol> lunch is in the kitchen\n<dave> is there any coffee left?"
+	if d := Distance(Fingerprint(base), Fingerprint(edited)); d > MaxDistance {
+		t.Errorf("Distance after a typo = %d; want at most %d", d, MaxDistance)
+	}
+	if d := Distance(Fingerprint(base), Fingerprint(other)); d <= MaxDistance {
+		t.Errorf("Distance to an unrelated quote = %d; want more than %d", d, MaxDistance)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	fingerprints := map[int]uint64{
+		1: 0,
+		2: 0xff_0000,             // 8 bits from 1
+		3: 0xff_ff00,             // 8 bits from 2, 16 from 1
+		4: 0xffff_ffff_0000_0000, // far from everything
+		5: 0xf0_0000,             // 4 bits from 2
+		6: 0xffff_ffff_0000_0001, // 1 bit from 4
+	}
+	want := [][]int{{1, 2, 3, 5}, {4, 6}}
+	if got := Clusters(fingerprints); !reflect.DeepEqual(got, want) {
+		t.Errorf("Clusters() = %v; want %v", got, want)
+	}
+	if got := Clusters(map[int]uint64{1: 0, 2: ^uint64(0)}); got != nil {
+		t.Errorf("Clusters() of distinct quotes = %v; want none", got)
+	}
+}
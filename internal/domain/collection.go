@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Collection is a named list of quotes kept by a visitor, in the order they
+// arrange it. Anyone with its Slug can view it; only its Owner can change
+// it. Each owner has at most one Favourites collection, which the star on
+// quote cards adds to. Size is only filled in by ListByOwner.
+type Collection struct {
+	ID         int
+	Owner      string
+	Slug       string
+	Name       string
+	Favourites bool
+	Created    time.Time
+	Size       int
+}
+
+type CollectionRepository interface {
+	Create(context.Context, *Collection) error
+	GetBySlug(context.Context, string) (*Collection, error)
+	// GetFavourites returns the favourites collection of an owner.
+	GetFavourites(context.Context, string) (*Collection, error)
+	// ListByOwner returns the collections of an owner, favourites first,
+	// then newest first.
+	ListByOwner(context.Context, string) ([]*Collection, error)
+	Rename(context.Context, int, string) error
+	Delete(context.Context, int) error
+	// Add appends a quote to a collection. Adding it twice is a conflict.
+	Add(context.Context, int, int) error
+	Remove(context.Context, int, int) error
+	// Move swaps a quote with the one before it, or after it if the last
+	// argument is positive.
+	Move(context.Context, int, int, int) error
+	// Contains returns which of the quotes are in a collection.
+	Contains(context.Context, int, []int) (map[int]bool, error)
+	// GetQuotes lists a collection in its order.
+	GetQuotes(context.Context, int, string, int) (*Page, error)
+	// AllQuotes returns the whole collection in its order.
+	AllQuotes(context.Context, int) ([]*Quote, error)
+	// AccountOf returns the ID of the user a visitor is linked to.
+	AccountOf(context.Context, string) (int, error)
+	// Link ties a visitor to a user.
+	Link(context.Context, string, int) error
+	// Transfer hands every collection of one owner to another, merging
+	// their favourites.
+	Transfer(context.Context, string, string) error
+}
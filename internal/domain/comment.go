@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Comment is a message in the discussion of a quote. ParentID is zero for
+// comments that don't reply to another one. Replies is only filled in when
+// comments are assembled into a thread.
+type Comment struct {
+	ID       int
+	QuoteID  int
+	ParentID int
+	Author   string
+	Body     string
+	Date     time.Time
+	IP       string
+	Hidden   bool
+	Replies  []*Comment
+}
+
+type CommentRepository interface {
+	Create(context.Context, *Comment) error
+	GetByID(context.Context, int) (*Comment, error)
+	// ListByQuote returns every comment on a quote, hidden ones included,
+	// oldest first.
+	ListByQuote(context.Context, int) ([]*Comment, error)
+	// Recent returns the newest comments on any quote, hidden ones included.
+	Recent(context.Context, int) ([]*Comment, error)
+	// CountVisible returns the number of comments that aren't hidden for
+	// each of the given quotes that has any.
+	CountVisible(context.Context, []int) (map[int]int, error)
+	SetHidden(context.Context, int, bool) error
+	// Delete removes a comment together with its replies.
+	Delete(context.Context, int) error
+}
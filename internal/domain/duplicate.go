@@ -0,0 +1,14 @@
+package domain
+
+import "context"
+
+// FingerprintRepository keeps the similarity hash of every quote's text.
+type FingerprintRepository interface {
+	// Put stores the fingerprint of a quote in place of its previous one.
+	Put(context.Context, int, uint64) error
+	// Near returns the IDs of the quotes whose fingerprint differs from
+	// the given one in at most the given number of bits.
+	Near(context.Context, uint64, int) ([]int, error)
+	// All returns the fingerprint of every quote that has one.
+	All(context.Context) (map[int]uint64, error)
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "errors"
+
+// Errors that repositories and services wrap so callers can tell failures
+// apart without knowing the storage behind them.
+var (
+	// ErrNotFound means the requested record doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid means the input was rejected as malformed.
+	ErrInvalid = errors.New("invalid input")
+	// ErrConflict means the change clashes with existing data, such as a
+	// duplicate key.
+	ErrConflict = errors.New("conflict")
+	// ErrForbidden means the caller may not change the record.
+	ErrForbidden = errors.New("forbidden")
+	// ErrUnavailable means the storage can't be reached for now; the same
+	// call may succeed later.
+	ErrUnavailable = errors.New("unavailable")
+)
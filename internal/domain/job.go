@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// JobStatus is how a run of a background job went.
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// JobRun is one run of a background job. Holder names the server process
+// that ran it; Error is empty unless the run failed.
+type JobRun struct {
+	ID       int64
+	Job      string
+	Holder   string
+	Started  time.Time
+	Duration time.Duration
+	Status   JobStatus
+	Error    string
+}
+
+type JobRepository interface {
+	// Acquire gives a holder the lease of a job for the run due at a time,
+	// for a duration, unless another holder has a lease that hasn't expired
+	// or that run already happened. It reports whether the lease was taken.
+	Acquire(context.Context, string, string, time.Time, time.Duration) (bool, error)
+	// Renew extends the lease of a job if the holder still has it. It
+	// reports whether it did.
+	Renew(context.Context, string, string, time.Duration) (bool, error)
+	// Release ends the lease of a job of a holder early.
+	Release(context.Context, string, string) error
+	// Start records a run that began and sets its ID.
+	Start(context.Context, *JobRun) error
+	// Finish records the status, duration and error of a run.
+	Finish(context.Context, *JobRun) error
+	// Runs returns the newest runs of every job.
+	Runs(context.Context, int) ([]*JobRun, error)
+	// Latest returns the newest run of each job.
+	Latest(context.Context) ([]*JobRun, error)
+	// Prune deletes runs started before a time.
+	Prune(context.Context, time.Time) (int64, error)
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// DailyQuote is the Quote of the Day selected for a calendar day. Day is
+// midnight UTC of that date, whatever timezone the day was chosen in.
+type DailyQuote struct {
+	Day     time.Time
+	Quote   *Quote
+	QuoteID int
+	Pinned  bool
+}
+
+type DailyQuoteRepository interface {
+	// Get returns nil without error when no quote was chosen for the day.
+	Get(context.Context, time.Time) (*DailyQuote, error)
+	// Add stores an automatic selection unless the day already has one;
+	// pinned selections replace whatever was there.
+	Add(context.Context, *DailyQuote) error
+	QuoteIDsSince(context.Context, time.Time) ([]int, error)
+	History(context.Context, time.Time, int) ([]*DailyQuote, error)
+}
@@ -2,9 +2,14 @@ package domain
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
+// ErrInvalidCursor is returned for pagination cursors that weren't issued by
+// the repository.
+var ErrInvalidCursor = fmt.Errorf("%w: cursor", ErrInvalid)
+
 type Quote struct {
 	Date    time.Time
 	Quote   string
@@ -15,12 +20,50 @@ type Quote struct {
 	Votes   int
 }
 
+// Page is one page of a listing. Next and Prev are opaque cursors for the
+// neighbouring pages and are empty when there is no such page.
+type Page struct {
+	Quotes []*Quote
+	Next   string
+	Prev   string
+}
+
+// RandomFilter narrows GetRandom. Zero values don't filter; To is
+// exclusive. A non-zero Seed makes the choice repeatable for the same data.
+type RandomFilter struct {
+	MinLikes   *int
+	From       time.Time
+	To         time.Time
+	ExcludeIDs []int
+	Seed       uint64
+}
+
+// PeriodCount is the number of quotes submitted in a year, or in a month
+// of it when Month is set.
+type PeriodCount struct {
+	Year  int
+	Month time.Month
+	Count int
+}
+
 type QuoteRepository interface {
 	Create(context.Context, *Quote) error
+	Delete(context.Context, int) error
 	GetByID(context.Context, int) (*Quote, error)
-	GetLatest(context.Context, int, int) ([]*Quote, error)
-	GetTop(context.Context, int, int) ([]*Quote, error)
-	GetRandom(context.Context) (*Quote, error)
+	// GetByIDs returns those of the quotes with the given IDs that exist,
+	// in no particular order.
+	GetByIDs(context.Context, []int) ([]*Quote, error)
+	GetLatest(context.Context, string, int) (*Page, error)
+	GetTop(context.Context, string, int) (*Page, error)
+	GetOnThisDay(context.Context, time.Time, string, int) (*Page, error)
+	GetByPeriod(context.Context, time.Time, time.Time, string, int) (*Page, error)
+	CountByYear(context.Context) ([]PeriodCount, error)
+	CountByMonth(context.Context, int) ([]PeriodCount, error)
+	GetRandom(context.Context, RandomFilter) (*Quote, error)
 	LikeQuote(context.Context, int) error
 	DislikeQuote(context.Context, int) error
+	// Merge folds the quotes in the list into the first quote.
+	Merge(context.Context, int, []int) error
+	// GetRedirect returns the quote that another was merged into.
+	GetRedirect(context.Context, int) (int, error)
 }
@@ -0,0 +1,24 @@
+package domain
+
+import "context"
+
+// Reaction is an emoji visitors can attach to a quote. Name identifies it
+// in URLs and storage.
+type Reaction struct {
+	Name  string
+	Emoji string
+}
+
+type ReactionRepository interface {
+	// Toggle adds the reaction of a visitor to a quote, or removes it if
+	// it is already there, and reports whether it is set afterwards.
+	Toggle(context.Context, int, string, string) (bool, error)
+	// Counts returns how many visitors gave each reaction to each of the
+	// given quotes that has any.
+	Counts(context.Context, []int) (map[int]map[string]int, error)
+	// ByVisitor returns the reactions a visitor gave to each of the given
+	// quotes.
+	ByVisitor(context.Context, []int, string) (map[int][]string, error)
+	// GetTop lists the quotes with a reaction, most reacted first.
+	GetTop(context.Context, string, string, int) (*Page, error)
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "context"
+
+// Suggestion is a quote suggested alongside another, with how alike the
+// two are, between 0 and 1.
+type Suggestion struct {
+	QuoteID int
+	Score   float64
+}
+
+type RelatedRepository interface {
+	// Replace stores the suggestions for a quote, best first, in place of
+	// the previous ones.
+	Replace(context.Context, int, []Suggestion) error
+	// Get returns up to limit quotes related to a quote, best first.
+	Get(context.Context, int, int) ([]*Quote, error)
+	// All returns the IDs of the related quotes stored for every quote,
+	// best first.
+	All(context.Context) (map[int][]int, error)
+}
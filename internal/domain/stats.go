@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// VoteBucket counts the quotes whose likes are between Min and Max
+// inclusive.
+type VoteBucket struct {
+	Min   int
+	Max   int
+	Count int
+}
+
+// ActivityCount is the number of quotes submitted in one hour of a weekday.
+type ActivityCount struct {
+	Weekday time.Weekday
+	Hour    int
+	Count   int
+}
+
+// SpeakerCount is how many quotes an IRC nick speaks in.
+type SpeakerCount struct {
+	Nick  string
+	Count int
+}
+
+// Stats summarises the whole archive.
+type Stats struct {
+	Total             int
+	TotalVotes        int
+	ByMonth           []PeriodCount
+	Votes             []VoteBucket
+	MostVoted         []*Quote
+	MostControversial []*Quote
+	Activity          [7][24]int
+	TopSpeakers       []SpeakerCount
+	GeneratedAt       time.Time
+}
+
+type StatsRepository interface {
+	Totals(context.Context) (quotes, votes int, err error)
+	CountPerMonth(context.Context) ([]PeriodCount, error)
+	VoteDistribution(context.Context, int) ([]VoteBucket, error)
+	MostVoted(context.Context, int) ([]*Quote, error)
+	MostControversial(context.Context, int) ([]*Quote, error)
+	Activity(context.Context) ([]ActivityCount, error)
+	EachText(context.Context, func(string) error) error
+}
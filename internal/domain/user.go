@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// User is an administrator. Visitors don't have accounts.
+type User struct {
+	CreatedAt    time.Time
+	Username     string
+	PasswordHash string
+	ID           int
+}
+
+type UserRepository interface {
+	Create(context.Context, *User) error
+	GetByUsername(context.Context, string) (*User, error)
+	UpdatePassword(context.Context, string, string) error
+}
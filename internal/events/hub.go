@@ -0,0 +1,94 @@
+// Package events fans out live updates to the connected browsers.
+package events
+
+import (
+	"sync"
+)
+
+// Event is one Server-Sent Event.
+type Event struct {
+	Name string
+	Data string
+}
+
+// Hub delivers published events to every subscriber. Publishing never
+// blocks: a subscriber whose buffer is full is dropped, and its client is
+// expected to reconnect and reload what it missed.
+type Hub struct {
+	buffer int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives events on C until it is closed, dropped or the hub
+// shuts down, after which C is closed.
+type Subscription struct {
+	C   <-chan Event
+	c   chan Event
+	hub *Hub
+}
+
+// NewHub returns a hub that buffers up to buffer events per subscriber.
+func NewHub(buffer int) *Hub {
+	return &Hub{buffer: buffer, subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscriber. It returns nil once the hub is
+// closed.
+func (h *Hub) Subscribe() *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	c := make(chan Event, h.buffer)
+	s := &Subscription{C: c, c: c, hub: h}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Close unsubscribes s. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Publish sends e to every subscriber, dropping those that can't keep up.
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		select {
+		case s.c <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Len returns the number of subscribers.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Close disconnects every subscriber and refuses new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s)
+	}
+}
+
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestHubDelivers(t *testing.T) {
+	h := NewHub(4)
+	a, b := h.Subscribe(), h.Subscribe()
+	h.Publish(Event{Name: "likes-1", Data: "Likes: 2"})
+
+	for _, s := range []*Subscription{a, b} {
+		if e := <-s.C; e.Name != "likes-1" || e.Data != "Likes: 2" {
+			t.Errorf("got %+v", e)
+		}
+	}
+	a.Close()
+	a.Close()
+	if h.Len() != 1 {
+		t.Errorf("Len() = %d; want 1 after closing a subscription", h.Len())
+	}
+	if _, ok := <-a.C; ok {
+		t.Error("closed subscription still open")
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(1)
+	slow, fast := h.Subscribe(), h.Subscribe()
+	h.Publish(Event{Name: "1"})
+	<-fast.C
+	h.Publish(Event{Name: "2"})
+
+	if e := <-slow.C; e.Name != "1" {
+		t.Errorf("slow subscriber got %q first; want buffered event 1", e.Name)
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("slow subscriber was not dropped")
+	}
+	if e := <-fast.C; e.Name != "2" {
+		t.Errorf("fast subscriber got %q; want 2", e.Name)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub(1)
+	s := h.Subscribe()
+	h.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("subscription still open after Close")
+	}
+	if h.Subscribe() != nil {
+		t.Error("Subscribe() after Close should return nil")
+	}
+	h.Publish(Event{Name: "ignored"})
+	s.Close()
+}
@@ -0,0 +1,100 @@
+package privacy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Mode selects how client addresses are reduced before they are stored.
+type Mode string
+
+const (
+	// ModeHash stores a keyed HMAC of the address, so repeat submitters
+	// can still be correlated without keeping the address itself.
+	ModeHash Mode = "hash"
+	// ModeTruncate stores the /24 (IPv4) or /48 (IPv6) network only.
+	ModeTruncate Mode = "truncate"
+	// ModeNone stores nothing.
+	ModeNone Mode = "none"
+)
+
+const hashPrefix = "h:"
+
+// Anonymizer turns raw client addresses into the identifiers that are safe
+// to persist.
+type Anonymizer struct {
+	mode Mode
+	key  []byte
+}
+
+func NewAnonymizer(mode Mode, key string) (*Anonymizer, error) {
+	switch mode {
+	case ModeHash:
+		if key == "" {
+			return nil, errors.New("hash mode requires a key")
+		}
+	case ModeTruncate, ModeNone:
+	default:
+		return nil, fmt.Errorf("unknown IP mode %q", mode)
+	}
+	return &Anonymizer{mode: mode, key: []byte(key)}, nil
+}
+
+// Anonymize returns the stored form of addr, which may carry a port.
+func (a *Anonymizer) Anonymize(addr string) string {
+	if addr == "" || a.mode == ModeNone {
+		return ""
+	}
+	ip, ok := parseAddr(addr)
+	switch a.mode {
+	case ModeHash:
+		s := addr
+		if ok {
+			s = ip.String()
+		}
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write([]byte(s))
+		return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+	case ModeTruncate:
+		if !ok {
+			return ""
+		}
+		bits := 24
+		if ip.Is6() {
+			bits = 48
+		}
+		prefix, _ := ip.Prefix(bits)
+		return prefix.String()
+	}
+	return ""
+}
+
+// IsRaw reports whether a stored value is a plain address, as written by
+// versions that did not anonymise.
+func IsRaw(stored string) bool {
+	_, ok := parseAddr(stored)
+	return ok
+}
+
+func parseAddr(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// Scrubber removes stored identifiers from rows submitted before a cutoff.
+type Scrubber interface {
+	ScrubIPs(ctx context.Context, before time.Time) (int64, error)
+}
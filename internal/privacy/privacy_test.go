@@ -0,0 +1,66 @@
+package privacy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	hash, err := NewAnonymizer(ModeHash, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trunc, err := NewAnonymizer(ModeTruncate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := NewAnonymizer(ModeNone, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h1 := hash.Anonymize("192.0.2.10:5555")
+	h2 := hash.Anonymize("192.0.2.10")
+	if !strings.HasPrefix(h1, hashPrefix) || strings.Contains(h1, "192.0.2") {
+		t.Errorf("hash.Anonymize() = %q; want keyed hash", h1)
+	}
+	if h1 != h2 {
+		t.Errorf("hash.Anonymize() differs with port: %q vs %q", h1, h2)
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"192.0.2.10:5555", "192.0.2.0/24"},
+		{"[2001:db8:1:2::1]:80", "2001:db8:1::/48"},
+		{"::ffff:192.0.2.10", "192.0.2.0/24"},
+		{"garbage", ""},
+	}
+	for _, tt := range tests {
+		if got := trunc.Anonymize(tt.in); got != tt.want {
+			t.Errorf("trunc.Anonymize(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := none.Anonymize("192.0.2.10"); got != "" {
+		t.Errorf("none.Anonymize() = %q; want empty", got)
+	}
+
+	if _, err := NewAnonymizer(ModeHash, ""); err == nil {
+		t.Error("NewAnonymizer(hash, \"\") = nil error; want error")
+	}
+}
+
+func TestIsRaw(t *testing.T) {
+	for in, want := range map[string]bool{
+		"192.0.2.10":       true,
+		"192.0.2.10:5555":  true,
+		"[2001:db8::1]:80": true,
+		"192.0.2.0/24":     false,
+		"h:abcdef":         false,
+		"":                 false,
+	} {
+		if got := IsRaw(in); got != want {
+			t.Errorf("IsRaw(%q) = %v; want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package qotd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// Selector picks the Quote of the Day. The first request for a day draws a
+// random quote seeded by the date, skipping quotes chosen within the
+// window, and stores it so every visitor and replica sees the same one.
+type Selector struct {
+	quotes domain.QuoteRepository
+	days   domain.DailyQuoteRepository
+	loc    *time.Location
+	window int
+	now    func() time.Time
+}
+
+func NewSelector(quotes domain.QuoteRepository, days domain.DailyQuoteRepository, loc *time.Location, window int) *Selector {
+	return &Selector{
+		quotes: quotes,
+		days:   days,
+		loc:    loc,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// Today returns the calendar day it currently is in the selector's
+// timezone, as midnight UTC.
+func (s *Selector) Today() time.Time {
+	y, m, d := s.now().In(s.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// For returns the quote of the given day, choosing it if necessary.
+func (s *Selector) For(ctx context.Context, day time.Time) (*domain.DailyQuote, error) {
+	dq, err := s.days.Get(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if dq == nil {
+		if dq, err = s.choose(ctx, day); err != nil {
+			return nil, err
+		}
+	}
+	if dq.Quote, err = s.quotes.GetByID(ctx, dq.QuoteID); err != nil {
+		return nil, err
+	}
+	return dq, nil
+}
+
+func (s *Selector) choose(ctx context.Context, day time.Time) (*domain.DailyQuote, error) {
+	recent, err := s.days.QuoteIDsSince(ctx, day.AddDate(0, 0, -s.window))
+	if err != nil {
+		return nil, err
+	}
+	filter := domain.RandomFilter{ExcludeIDs: recent, Seed: seed(day)}
+	q, err := s.quotes.GetRandom(ctx, filter)
+	if err != nil && len(recent) > 0 {
+		// The archive is smaller than the window.
+		filter.ExcludeIDs = nil
+		q, err = s.quotes.GetRandom(ctx, filter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("choosing quote of the day: %w", err)
+	}
+	if err := s.days.Add(ctx, &domain.DailyQuote{Day: day, QuoteID: q.ID}); err != nil {
+		return nil, err
+	}
+	// Another request may have stored its choice first; that one wins.
+	dq, err := s.days.Get(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if dq == nil {
+		return nil, fmt.Errorf("quote of the day for %s was not stored", day.Format(time.DateOnly))
+	}
+	return dq, nil
+}
+
+// Pin makes quoteID the quote of the given day, replacing any selection.
+func (s *Selector) Pin(ctx context.Context, day time.Time, quoteID int) error {
+	if _, err := s.quotes.GetByID(ctx, quoteID); err != nil {
+		return err
+	}
+	return s.days.Add(ctx, &domain.DailyQuote{Day: day, QuoteID: quoteID, Pinned: true})
+}
+
+// History returns up to limit past selections before day, newest first.
+func (s *Selector) History(ctx context.Context, before time.Time, limit int) ([]*domain.DailyQuote, error) {
+	return s.days.History(ctx, before, limit)
+}
+
+func seed(day time.Time) uint64 {
+	sum := sha256.Sum256([]byte("qotd:" + day.Format(time.DateOnly)))
+	if v := binary.BigEndian.Uint64(sum[:8]); v != 0 {
+		return v
+	}
+	return 1
+}
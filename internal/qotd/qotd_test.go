@@ -0,0 +1,122 @@
+package qotd
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+type fakeQuotes struct {
+	domain.QuoteRepository
+	ids []int
+}
+
+func (f *fakeQuotes) GetRandom(_ context.Context, filter domain.RandomFilter) (*domain.Quote, error) {
+	var candidates []int
+	for _, id := range f.ids {
+		if !slices.Contains(filter.ExcludeIDs, id) {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("quote not found")
+	}
+	return &domain.Quote{ID: candidates[filter.Seed%uint64(len(candidates))]}, nil
+}
+
+func (f *fakeQuotes) GetByID(_ context.Context, id int) (*domain.Quote, error) {
+	if !slices.Contains(f.ids, id) {
+		return nil, errors.New("quote not found")
+	}
+	return &domain.Quote{ID: id}, nil
+}
+
+type fakeDays struct {
+	days map[time.Time]*domain.DailyQuote
+}
+
+func (f *fakeDays) Get(_ context.Context, day time.Time) (*domain.DailyQuote, error) {
+	if d, ok := f.days[day]; ok {
+		c := *d
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeDays) Add(_ context.Context, d *domain.DailyQuote) error {
+	if _, ok := f.days[d.Day]; !ok || d.Pinned {
+		f.days[d.Day] = d
+	}
+	return nil
+}
+
+func (f *fakeDays) QuoteIDsSince(_ context.Context, since time.Time) ([]int, error) {
+	var ids []int
+	for day, d := range f.days {
+		if !day.Before(since) {
+			ids = append(ids, d.QuoteID)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeDays) History(context.Context, time.Time, int) ([]*domain.DailyQuote, error) {
+	return nil, nil
+}
+
+func TestSelector(t *testing.T) {
+	quotes := &fakeQuotes{ids: []int{1, 2, 3, 4, 5}}
+	days := &fakeDays{days: map[time.Time]*domain.DailyQuote{}}
+	s := NewSelector(quotes, days, time.UTC, 3)
+	ctx := context.Background()
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	first, err := s.For(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.For(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.QuoteID != first.QuoteID {
+		t.Errorf("For() changed within a day: %d then %d", first.QuoteID, again.QuoteID)
+	}
+
+	seen := []int{first.QuoteID}
+	for i := 1; i < 10; i++ {
+		dq, err := s.For(ctx, start.AddDate(0, 0, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		window := seen[max(0, len(seen)-3):]
+		if slices.Contains(window, dq.QuoteID) {
+			t.Errorf("day %d repeated quote %d within window %v", i, dq.QuoteID, window)
+		}
+		seen = append(seen, dq.QuoteID)
+	}
+
+	pinDay := start.AddDate(0, 0, 20)
+	if err := s.Pin(ctx, pinDay, 4); err != nil {
+		t.Fatal(err)
+	}
+	if dq, _ := s.For(ctx, pinDay); dq.QuoteID != 4 || !dq.Pinned {
+		t.Errorf("For(pinned day) = %+v; want pinned quote 4", dq)
+	}
+	if err := s.Pin(ctx, pinDay, 99); err == nil {
+		t.Error("Pin(missing quote) = nil; want error")
+	}
+}
+
+func TestToday(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	s := NewSelector(nil, nil, loc, 1)
+	s.now = func() time.Time { return time.Date(2026, 10, 18, 22, 30, 0, 0, time.UTC) }
+	if got := s.Today(); got != time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("Today() = %v; want 2026-10-19", got)
+	}
+}
@@ -0,0 +1,250 @@
+// Package related suggests the quotes alike to each quote: those with
+// similar words, the same speakers or nearby dates. Suggestions for the
+// whole archive are computed in the background and stored, so the quote
+// page only has to look them up.
+package related
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/stats"
+)
+
+// Count is how many related quotes are kept for each quote.
+const Count = 5
+
+const (
+	textWeight    = 0.6
+	speakerWeight = 0.3
+	dateWeight    = 0.1
+	// dateHalfLife is how far apart two quotes are when their dates count
+	// half as much as if submitted the same day.
+	dateHalfLife = 30 * 24 * time.Hour
+	// minScore is more than dates alone can give, so every suggestion
+	// shares words or speakers with the quote.
+	minScore      = 0.15
+	minTermLength = 3
+	// Terms and speakers found in more than commonShare of the quotes say
+	// little about any of them and would compare every quote with every
+	// other, so they are ignored once the archive has more than
+	// minCommon quotes.
+	commonShare = 0.1
+	minCommon   = 20
+)
+
+type weightedTerm struct {
+	term   string
+	weight float64
+}
+
+type document struct {
+	id       int
+	date     time.Time
+	terms    []weightedTerm
+	speakers []string
+}
+
+type posting struct {
+	doc    int
+	weight float64
+}
+
+// Compute returns up to n suggestions for each quote, best first. Quotes
+// without any are left out.
+//
+// Text similarity is the cosine of the TF-IDF vectors of the words of two
+// quotes; speaker similarity is the Jaccard index of their IRC nicks; and
+// dates count less the further apart they are.
+func Compute(quotes []*domain.Quote, n int) map[int][]domain.Suggestion {
+	docs, counts := make([]document, len(quotes)), make([]map[string]int, len(quotes))
+	df := make(map[string]int)
+	for i, q := range quotes {
+		docs[i] = document{id: q.ID, date: q.Date}
+		for _, nick := range stats.Speakers(q.Quote) {
+			docs[i].speakers = append(docs[i].speakers, strings.ToLower(nick))
+		}
+		counts[i] = terms(q.Quote, docs[i].speakers)
+		for t := range counts[i] {
+			df[t]++
+		}
+	}
+
+	maxDF := max(int(commonShare*float64(len(quotes))), minCommon)
+	postings := make(map[string][]posting)
+	for i := range docs {
+		docs[i].terms = weigh(counts[i], df, len(quotes), maxDF)
+		for _, wt := range docs[i].terms {
+			postings[wt.term] = append(postings[wt.term], posting{i, wt.weight})
+		}
+	}
+	bySpeaker := make(map[string][]int)
+	for i, d := range docs {
+		for _, nick := range d.speakers {
+			bySpeaker[nick] = append(bySpeaker[nick], i)
+		}
+	}
+
+	result := make(map[int][]domain.Suggestion)
+	for i, d := range docs {
+		dot := make(map[int]float64)
+		for _, wt := range d.terms {
+			for _, p := range postings[wt.term] {
+				if p.doc != i {
+					dot[p.doc] += wt.weight * p.weight
+				}
+			}
+		}
+		shared := make(map[int]int)
+		for _, nick := range d.speakers {
+			if len(bySpeaker[nick]) > maxDF {
+				continue
+			}
+			for _, j := range bySpeaker[nick] {
+				if j != i {
+					shared[j]++
+				}
+			}
+		}
+
+		var suggestions []domain.Suggestion
+		consider := func(j int) {
+			score := textWeight*dot[j] + dateWeight*proximity(d.date, docs[j].date)
+			if s := shared[j]; s > 0 {
+				score += speakerWeight * float64(s) / float64(len(d.speakers)+len(docs[j].speakers)-s)
+			}
+			if score >= minScore {
+				suggestions = append(suggestions, domain.Suggestion{QuoteID: docs[j].id, Score: score})
+			}
+		}
+		for j := range dot {
+			consider(j)
+		}
+		for j := range shared {
+			if _, ok := dot[j]; !ok {
+				consider(j)
+			}
+		}
+		if len(suggestions) == 0 {
+			continue
+		}
+		sort.Slice(suggestions, func(a, b int) bool {
+			if suggestions[a].Score != suggestions[b].Score {
+				return suggestions[a].Score > suggestions[b].Score
+			}
+			return suggestions[a].QuoteID > suggestions[b].QuoteID
+		})
+		result[d.id] = suggestions[:min(n, len(suggestions))]
+	}
+	return result
+}
+
+// terms counts the words of a quote, leaving out short ones and the nicks
+// of its speakers, which are compared separately.
+func terms(text string, speakers []string) map[string]int {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if utf8.RuneCountInString(w) >= minTermLength && !slices.Contains(speakers, w) {
+			counts[w]++
+		}
+	}
+	return counts
+}
+
+// weigh returns the unit TF-IDF vector of a quote, sorted by term so that
+// sums over it come out the same every time. Terms of a single quote match
+// nothing and are dropped along with the common ones.
+func weigh(counts map[string]int, df map[string]int, total, maxDF int) []weightedTerm {
+	var vec []weightedTerm
+	var norm float64
+	for t, c := range counts {
+		if df[t] < 2 || df[t] > maxDF {
+			continue
+		}
+		w := (1 + math.Log(float64(c))) * math.Log(float64(total)/float64(df[t]))
+		if w <= 0 {
+			continue
+		}
+		vec = append(vec, weightedTerm{t, w})
+		norm += w * w
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i].weight /= norm
+	}
+	sort.Slice(vec, func(i, j int) bool { return vec[i].term < vec[j].term })
+	return vec
+}
+
+// proximity is 1 for quotes of the same moment, halving every dateHalfLife
+// between them.
+func proximity(a, b time.Time) float64 {
+	if a.IsZero() || b.IsZero() {
+		return 0
+	}
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	return math.Exp2(-float64(d) / float64(dateHalfLife))
+}
+
+// Source yields every quote of the archive.
+type Source interface {
+	Each(context.Context, func(*domain.Quote) error) error
+}
+
+// Updater recomputes the related quotes of the archive and stores the
+// lists that changed.
+type Updater struct {
+	quotes Source
+	repo   domain.RelatedRepository
+}
+
+func NewUpdater(quotes Source, repo domain.RelatedRepository) *Updater {
+	return &Updater{quotes: quotes, repo: repo}
+}
+
+// Update recomputes every list and returns how many quotes got a new one.
+func (u *Updater) Update(ctx context.Context) (int, error) {
+	var quotes []*domain.Quote
+	err := u.quotes.Each(ctx, func(q *domain.Quote) error {
+		quotes = append(quotes, q)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	stored, err := u.repo.All(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	computed := Compute(quotes, Count)
+	changed := 0
+	for _, q := range quotes {
+		suggestions := computed[q.ID]
+		ids := make([]int, len(suggestions))
+		for i, s := range suggestions {
+			ids[i] = s.QuoteID
+		}
+		if slices.Equal(ids, stored[q.ID]) {
+			continue
+		}
+		if err := u.repo.Replace(ctx, q.ID, suggestions); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,97 @@
+package related
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+var archive = []*domain.Quote{
+	{ID: 1, Quote: "<alice> my cat knocked the coffee over the keyboard"},
+	{ID: 2, Quote: "<bob> the coffee machine broke and my keyboard is sticky"},
+	{ID: 3, Quote: "<alice> compiling the kernel again"},
+	{ID: 4, Quote: "<carol> weather is nice today"},
+	{ID: 5, Quote: "<dave> kernel panic while compiling"},
+}
+
+func ids(suggestions []domain.Suggestion) []int {
+	var list []int
+	for _, s := range suggestions {
+		list = append(list, s.QuoteID)
+	}
+	return list
+}
+
+func TestCompute(t *testing.T) {
+	got := Compute(archive, Count)
+
+	if want := []int{2, 3}; !slices.Equal(ids(got[1]), want) {
+		t.Errorf("related to 1 = %v; want %v (shared words, then shared speaker)", ids(got[1]), want)
+	}
+	if want := []int{5, 1}; !slices.Equal(ids(got[3]), want) {
+		t.Errorf("related to 3 = %v; want %v", ids(got[3]), want)
+	}
+	if s := got[4]; s != nil {
+		t.Errorf("related to 4 = %v; want none", ids(s))
+	}
+	for id, list := range got {
+		for _, s := range list {
+			if s.QuoteID == id || s.Score < minScore || s.Score > 1 {
+				t.Errorf("suggestion %+v for quote %d", s, id)
+			}
+		}
+	}
+	if got := Compute(archive, 1); len(got[1]) != 1 {
+		t.Errorf("Compute(n=1) kept %d suggestions", len(got[1]))
+	}
+}
+
+type fakeSource []*domain.Quote
+
+func (f fakeSource) Each(_ context.Context, fn func(*domain.Quote) error) error {
+	for _, q := range f {
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type fakeRelated struct {
+	domain.RelatedRepository
+	stored   map[int][]int
+	replaced int
+}
+
+func (f *fakeRelated) Replace(_ context.Context, id int, suggestions []domain.Suggestion) error {
+	f.replaced++
+	if len(suggestions) == 0 {
+		delete(f.stored, id)
+		return nil
+	}
+	f.stored[id] = ids(suggestions)
+	return nil
+}
+
+func (f *fakeRelated) All(context.Context) (map[int][]int, error) {
+	return f.stored, nil
+}
+
+func TestUpdate(t *testing.T) {
+	repo := &fakeRelated{stored: map[int][]int{4: {1}}}
+	u := NewUpdater(fakeSource(archive), repo)
+	ctx := context.Background()
+
+	n, err := u.Update(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || repo.stored[4] != nil || !slices.Equal(repo.stored[1], []int{2, 3}) {
+		t.Errorf("first Update() = %d, stored %v", n, repo.stored)
+	}
+	if n, err := u.Update(ctx); err != nil || n != 0 {
+		t.Errorf("second Update() = %d, %v; want nothing to change", n, err)
+	}
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Markup selects the lightweight markup HTML recognises in quote text.
+type Markup struct {
+	// Code renders text between backticks as code.
+	Code bool
+	// Actions renders "/me waves" and "* nick waves" lines as IRC actions.
+	Actions bool
+	// Links turns http and https URLs into nofollow links.
+	Links bool
+}
+
+// AllMarkup enables every kind of markup.
+var AllMarkup = Markup{Code: true, Actions: true, Links: true}
+
+// ParseMarkup builds a Markup from the names "code", "actions" and "links".
+func ParseMarkup(names []string) (Markup, error) {
+	var m Markup
+	for _, n := range names {
+		switch n {
+		case "code":
+			m.Code = true
+		case "actions":
+			m.Actions = true
+		case "links":
+			m.Links = true
+		default:
+			return Markup{}, fmt.Errorf("unknown markup %q", n)
+		}
+	}
+	return m, nil
+}
+
+// urlRe matches URLs to link. Trailing punctuation is trimmed separately.
+var urlRe = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// actionRe matches an IRC action line as logged, "* nick waves".
+var actionRe = regexp.MustCompile(`^\*\s+\S`)
+
+// HTML renders plain quote text as HTML: everything is escaped, line breaks
+// become <br> and the markup enabled in m is applied. The result is passed
+// through Sanitize, so nothing outside its whitelist can reach a page even
+// if the markup code has a bug.
+func HTML(s string, m Markup) template.HTML {
+	var b strings.Builder
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			b.WriteString("<br>")
+		}
+		if m.Actions {
+			if rest, ok := strings.CutPrefix(line, "/me "); ok {
+				b.WriteString(`<em class="action">* `)
+				inline(&b, rest, m)
+				b.WriteString("</em>")
+				continue
+			}
+			if actionRe.MatchString(line) {
+				b.WriteString(`<em class="action">`)
+				inline(&b, line, m)
+				b.WriteString("</em>")
+				continue
+			}
+		}
+		inline(&b, line, m)
+	}
+	return template.HTML(Sanitize(b.String()))
+}
+
+// inline writes one line with code spans and links.
+func inline(b *strings.Builder, s string, m Markup) {
+	for s != "" {
+		if !m.Code {
+			links(b, s, m)
+			return
+		}
+		start := strings.IndexByte(s, '`')
+		if start < 0 {
+			links(b, s, m)
+			return
+		}
+		end := strings.IndexByte(s[start+1:], '`')
+		if end <= 0 {
+			// No closing backtick, or an empty span: plain text.
+			links(b, s[:start+1], m)
+			s = s[start+1:]
+			continue
+		}
+		end += start + 1
+		links(b, s[:start], m)
+		b.WriteString("<code>")
+		b.WriteString(template.HTMLEscapeString(s[start+1 : end]))
+		b.WriteString("</code>")
+		s = s[end+1:]
+	}
+}
+
+// links writes s with URLs turned into links.
+func links(b *strings.Builder, s string, m Markup) {
+	if m.Links {
+		for {
+			loc := urlRe.FindStringIndex(s)
+			if loc == nil {
+				break
+			}
+			link := trimURL(s[loc[0]:loc[1]])
+			b.WriteString(template.HTMLEscapeString(s[:loc[0]]))
+			if u, err := url.Parse(link); err == nil && u.Host != "" {
+				esc := template.HTMLEscapeString(link)
+				fmt.Fprintf(b, `<a href="%s" rel="%s">%s</a>`, esc, linkRel, esc)
+			} else {
+				b.WriteString(template.HTMLEscapeString(link))
+			}
+			s = s[loc[0]+len(link):]
+		}
+	}
+	b.WriteString(template.HTMLEscapeString(s))
+}
+
+// trimURL drops punctuation that more likely ends the sentence than the
+// URL, and a closing parenthesis without an opening one.
+func trimURL(link string) string {
+	for {
+		n := len(link)
+		link = strings.TrimRight(link, ".,;:!?")
+		if strings.HasSuffix(link, ")") && strings.Count(link, "(") < strings.Count(link, ")") {
+			link = link[:len(link)-1]
+		}
+		if len(link) == n {
+			return link
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		in   string
+		m    Markup
+		want string
+	}{
+		{"<alice> a & b\n<bob> <script>", Markup{}, "&lt;alice&gt; a &amp; b<br>&lt;bob&gt; &lt;script&gt;"},
+		{"/me waves", Markup{}, "/me waves"},
+		{"/me waves", AllMarkup, `<em class="action">* waves</em>`},
+		{"* nick waves\n*bold*", AllMarkup, `<em class="action">* nick waves</em><br>*bold*`},
+		{"run `rm -rf <dir>` now", AllMarkup, "run <code>rm -rf &lt;dir&gt;</code> now"},
+		{"a ` b `` c", AllMarkup, "a <code> b </code>` c"},
+		{"see https://example.com/a_(b).", AllMarkup,
+			`see <a href="https://example.com/a_(b)" rel="nofollow noopener ugc">https://example.com/a_(b)</a>.`},
+		{"(http://x.org/?a=1&b=2)", AllMarkup,
+			`(<a href="http://x.org/?a=1&amp;b=2" rel="nofollow noopener ugc">http://x.org/?a=1&amp;b=2</a>)`},
+		{"`https://x.org`", AllMarkup, "<code>https://x.org</code>"},
+		{"http://\"onmouseover=alert(1)", AllMarkup, "http://&#34;onmouseover=alert(1)"},
+		{"javascript:alert(1)", AllMarkup, "javascript:alert(1)"},
+	}
+	for _, tt := range tests {
+		if got := string(HTML(tt.in, tt.m)); got != tt.want {
+			t.Errorf("HTML(%q, %+v) = %q; want %q", tt.in, tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a<br/>b<BR>c", "a<br>b<br>c"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{`<em class="action" onclick="x()">hi</em>`, `<em class="action">hi</em>`},
+		{`<em class='x" onclick'>hi`, `<em>hi</em>`},
+		{`<a href="javascript:alert(1)">x</a>`, `&lt;a href=&#34;javascript:alert(1)&#34;&gt;x`},
+		{`<a href="https://x.org" rel="opener" target="_blank">x</a>`, `<a href="https://x.org" rel="nofollow noopener ugc">x</a>`},
+		{`<a href=https://x.org>x</a>`, `&lt;a href=https://x.org&gt;x`},
+		{"</code>a<code>b", "a<code>b</code>"},
+		{"1 < 2 & 3 > 2 &amp; &#39; &bogus", "1 &lt; 2 &amp; 3 &gt; 2 &amp; &#39; &amp;bogus"},
+		{"<img src=x onerror=alert(1)>", "&lt;img src=x onerror=alert(1)&gt;"},
+	}
+	for _, tt := range tests {
+		if got := Sanitize(tt.in); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// safeTagRe matches exactly the tags Sanitize may emit.
+var safeTagRe = regexp.MustCompile(`<br>|</?code>|<em(?: class="[a-z][a-z0-9 -]*")*>|</em>|` +
+	`<a href="https?://[^"<>]*" rel="nofollow noopener ugc">|</a>`)
+
+// checkSafe fails when out contains markup Sanitize must never produce.
+func checkSafe(t *testing.T, in, out string) {
+	t.Helper()
+	rest := safeTagRe.ReplaceAllString(out, "")
+	if i := strings.IndexAny(rest, `<>"'`); i >= 0 {
+		t.Fatalf("input %q produced unsafe output %q (at %q)", in, out, rest[i:])
+	}
+	for i := strings.IndexByte(rest, '&'); i >= 0; i = strings.IndexByte(rest, '&') {
+		if !entityRe.MatchString(rest[i:]) {
+			t.Fatalf("input %q produced a bare & in %q", in, out)
+		}
+		rest = rest[i+1:]
+	}
+}
+
+var fuzzCorpus = []string{
+	"",
+	"plain text",
+	"<alice> hi\n<bob> hello",
+	"<script>alert(1)</script>",
+	`"><img src=x onerror=alert(1)>`,
+	"<a href=\"javascript:alert(1)\">x</a>",
+	"<a href='https://x.org' onclick='x()'>x</a>",
+	"<em class=\"a\"><em class=\"b\">x</a></em>",
+	"<<script>script>",
+	"&lt;script&gt; &amp;lt; &#x3c; &#0; &",
+	"/me waves at `<b>` https://x.org/?q=<script>",
+	"* nick https://x.org/\"onerror=alert(1)//",
+	"`` ` `code` https://a.b/(c)) http://",
+	"<a href=\"https://x.org\"><a href=\"https://y.org\">nested</a></a>",
+	"<ScRiPt SRC=//x.org/x.js></sCrIpT>",
+	"<br\x00>\x00<code\n>",
+	"<svg/onload=alert(1)>",
+}
+
+func FuzzHTML(f *testing.F) {
+	for _, s := range fuzzCorpus {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		checkSafe(t, s, string(HTML(s, AllMarkup)))
+
+		// Without markup the text must come back unchanged.
+		plain := string(HTML(s, Markup{}))
+		checkSafe(t, s, plain)
+		if utf8.ValidString(s) && !strings.ContainsRune(s, 0) {
+			if got := html.UnescapeString(strings.ReplaceAll(plain, "<br>", "\n")); got != s {
+				t.Fatalf("HTML(%q) without markup = %q; does not round-trip", s, plain)
+			}
+		}
+	})
+}
+
+func FuzzSanitize(f *testing.F) {
+	for _, s := range fuzzCorpus {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		out := Sanitize(s)
+		checkSafe(t, s, out)
+		if again := Sanitize(out); again != out {
+			t.Fatalf("Sanitize is not idempotent for %q: %q then %q", s, out, again)
+		}
+	})
+}
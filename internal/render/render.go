@@ -0,0 +1,172 @@
+// Package render turns the plain text stored for quotes into the formats
+// the site and the command line serve.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// Format is an output format for quotes.
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+)
+
+// ContentType returns the media type of f.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatText:
+		return "text/plain; charset=utf-8"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	}
+	return "text/html; charset=utf-8"
+}
+
+// markdownEscaper escapes the characters that start inline markup anywhere
+// in a line.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "&", `\&`, "|", `\|`, "~", `\~`,
+)
+
+// blockStartRe matches what would make a line a heading, list item or
+// thematic break.
+var blockStartRe = regexp.MustCompile(`^(\s*)([#+=-]|\d+[.)])`)
+
+// Markdown escapes s so it renders as written, keeping its line breaks as
+// hard breaks.
+func Markdown(s string) string {
+	lines := strings.Split(s, "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		line = markdownEscaper.Replace(line)
+		if m := blockStartRe.FindStringSubmatchIndex(line); m != nil {
+			// Escape the last character of the marker: "\#", "1\.".
+			at := m[5] - 1
+			line = line[:at] + `\` + line[at:]
+		}
+		b.WriteString(line)
+		if i < len(lines)-1 {
+			if line != "" && lines[i+1] != "" {
+				b.WriteString(`\`)
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// Document is the JSON form of a quote.
+type Document struct {
+	ID      int       `json:"id"`
+	Quote   string    `json:"quote"`
+	Comment string    `json:"comment"`
+	Date    time.Time `json:"date"`
+	Likes   int       `json:"likes"`
+	Votes   int       `json:"votes"`
+	URL     string    `json:"url"`
+}
+
+// Write writes q to w as plain text, Markdown or JSON. HTML pages are
+// rendered by the templates, using HTML for the text.
+func Write(w io.Writer, f Format, q *domain.Quote) error {
+	switch f {
+	case FormatText, FormatMarkdown:
+		return writeQuote(w, f, q)
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(document(q))
+	}
+	return fmt.Errorf("render: unsupported format %q", f)
+}
+
+// List is the JSON form of a named list of quotes.
+type List struct {
+	Name   string     `json:"name"`
+	Quotes []Document `json:"quotes"`
+}
+
+// WriteList writes a named list of quotes to w. Plain text leaves out the
+// name and separates quotes by lines holding a single %, as fortune files
+// do; Markdown puts the name in a heading and rules between the quotes.
+func WriteList(w io.Writer, f Format, name string, quotes []*domain.Quote) error {
+	var err error
+	switch f {
+	case FormatText:
+		for i := 0; i < len(quotes) && err == nil; i++ {
+			if err = writeQuote(w, f, quotes[i]); err == nil {
+				_, err = io.WriteString(w, "%\n")
+			}
+		}
+	case FormatMarkdown:
+		_, err = fmt.Fprintf(w, "# %s\n", Markdown(name))
+		for i := 0; i < len(quotes) && err == nil; i++ {
+			sep := "\n"
+			if i > 0 {
+				sep = "\n---\n\n"
+			}
+			if _, err = io.WriteString(w, sep); err == nil {
+				err = writeQuote(w, f, quotes[i])
+			}
+		}
+	case FormatJSON:
+		l := List{Name: name, Quotes: make([]Document, len(quotes))}
+		for i, q := range quotes {
+			l.Quotes[i] = document(q)
+		}
+		err = json.NewEncoder(w).Encode(l)
+	default:
+		return fmt.Errorf("render: unsupported format %q", f)
+	}
+	return err
+}
+
+// writeQuote writes q as plain text or Markdown.
+func writeQuote(w io.Writer, f Format, q *domain.Quote) error {
+	text, comment := q.Quote, q.Comment
+	if f == FormatMarkdown {
+		text, comment = Markdown(text), Markdown(comment)
+	}
+	_, err := fmt.Fprintln(w, text)
+	if err == nil && comment != "" {
+		_, err = fmt.Fprintf(w, "\n-- %s\n", comment)
+	}
+	return err
+}
+
+func document(q *domain.Quote) Document {
+	return Document{
+		ID:      q.ID,
+		Quote:   q.Quote,
+		Comment: q.Comment,
+		Date:    q.Date,
+		Likes:   q.Likes,
+		Votes:   q.Votes,
+		URL:     fmt.Sprintf("/quote/%d", q.ID),
+	}
+}
+
+// legacyBreakRe matches the line break markup older versions stored,
+// including the JSON-escaped "<br \/>", and the newline that may follow it.
+var legacyBreakRe = regexp.MustCompile(`(?i)<br\s*\\?/?>(\r?\n)?`)
+
+// FromLegacy converts the <br /> markup and CRLF line endings of text
+// stored by older versions to newlines, as the 0005 migration does. Other
+// text, HTML entities included, is kept as it is.
+func FromLegacy(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return legacyBreakRe.ReplaceAllString(s, "\n")
+}
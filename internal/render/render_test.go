@@ -0,0 +1,108 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain words", "plain words"},
+		{"<alice> *hi*\n<bob> hey", `\<alice\> \*hi\*\` + "\n" + `\<bob\> hey`},
+		{"# not a heading", `\# not a heading`},
+		{"- item\n1. item", `\- item\` + "\n" + `1\. item`},
+		{"one\n\ntwo", "one\n\ntwo"},
+		{"a_b [c](d) `e`", "a\\_b \\[c\\](d) \\`e\\`"},
+	}
+	for _, tt := range tests {
+		if got := Markdown(tt.in); got != tt.want {
+			t.Errorf("Markdown(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	q := &domain.Quote{ID: 7, Quote: "<a> hi\n<b> yo", Comment: "classic", Likes: 3}
+
+	var b bytes.Buffer
+	if err := Write(&b, FormatText, q); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<a> hi\n<b> yo\n\n-- classic\n"; b.String() != want {
+		t.Errorf("text = %q; want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := Write(&b, FormatJSON, q); err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Quote != q.Quote || doc.URL != "/quote/7" || doc.Likes != 3 {
+		t.Errorf("json = %+v", doc)
+	}
+
+	if err := Write(&b, FormatHTML, q); err == nil {
+		t.Error("Write accepted HTML")
+	}
+}
+
+func TestWriteList(t *testing.T) {
+	quotes := []*domain.Quote{
+		{ID: 1, Quote: "<a> hi", Comment: "first"},
+		{ID: 2, Quote: "* not a list"},
+	}
+
+	var b bytes.Buffer
+	if err := WriteList(&b, FormatText, "Exam week", quotes); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<a> hi\n\n-- first\n%\n* not a list\n%\n"; b.String() != want {
+		t.Errorf("text = %q; want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WriteList(&b, FormatMarkdown, "Exam *week*", quotes); err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Exam \\*week\\*\n\n\\<a\\> hi\n\n-- first\n\n---\n\n\\* not a list\n"; b.String() != want {
+		t.Errorf("markdown = %q; want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WriteList(&b, FormatJSON, "Exam week", quotes); err != nil {
+		t.Fatal(err)
+	}
+	var l List
+	if err := json.Unmarshal(b.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != "Exam week" || len(l.Quotes) != 2 || l.Quotes[1].URL != "/quote/2" {
+		t.Errorf("json = %+v", l)
+	}
+}
+
+func TestFromLegacy(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a<br />b", "a\nb"},
+		{`a<br \/>b`, "a\nb"},
+		{"a<br>b<BR/>c", "a\nb\nc"},
+		{"a<br />\r\nb", "a\nb"},
+		{"&lt;nick&gt; tom &amp; jerry", "&lt;nick&gt; tom &amp; jerry"},
+		{"plain\ntext", "plain\ntext"},
+	}
+	for _, tt := range tests {
+		if got := FromLegacy(tt.in); got != tt.want {
+			t.Errorf("FromLegacy(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
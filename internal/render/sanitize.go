@@ -0,0 +1,139 @@
+package render
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// linkRel is the rel of every link: quotes are user content, so links get no
+// ranking credit and no access to the opener.
+const linkRel = "nofollow noopener ugc"
+
+var (
+	tagRe    = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[a-zA-Z][a-zA-Z-]*(?:\s*=\s*(?:"[^"<>]*"|'[^'<>]*'))?)*)\s*/?>`)
+	attrRe   = regexp.MustCompile(`([a-zA-Z][a-zA-Z-]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'))?`)
+	entityRe = regexp.MustCompile(`^&(?:[a-zA-Z][a-zA-Z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6});`)
+	classRe  = regexp.MustCompile(`^[a-z][a-z0-9 -]*$`)
+)
+
+// allowedTags lists the tags Sanitize keeps and the attributes each may
+// carry. Anything else is escaped and shown as text.
+var allowedTags = map[string][]string{
+	"br":   nil,
+	"code": nil,
+	"em":   {"class"},
+	"a":    {"href"},
+}
+
+// Sanitize returns s with only whitelisted tags and attributes left as
+// markup. Other tags, stray "<", ">" and quotes, and "&" that do not start
+// an entity are escaped. Tags are written back in a canonical form, links
+// always get linkRel and only http and https URLs, and unclosed tags are
+// closed at the end.
+func Sanitize(s string) string {
+	var b strings.Builder
+	var open []string
+	for len(s) > 0 {
+		i := strings.IndexAny(s, "<>&\"'\x00")
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		switch s[0] {
+		case '<':
+			m := tagRe.FindStringSubmatch(s)
+			if m == nil {
+				b.WriteString("&lt;")
+				s = s[1:]
+				continue
+			}
+			if tag, ok := sanitizeTag(strings.ToLower(m[2]), m[1] == "/", m[3], &open); ok {
+				b.WriteString(tag)
+			} else {
+				b.WriteString(template.HTMLEscapeString(m[0]))
+			}
+			s = s[len(m[0]):]
+		case '&':
+			if e := entityRe.FindString(s); e != "" {
+				b.WriteString(e)
+				s = s[len(e):]
+				continue
+			}
+			b.WriteString("&amp;")
+			s = s[1:]
+		case '\x00':
+			b.WriteString("�")
+			s = s[1:]
+		default:
+			b.WriteString(template.HTMLEscapeString(s[:1]))
+			s = s[1:]
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// sanitizeTag returns the canonical form of a whitelisted tag and tracks
+// open elements. ok is false for tags that must be escaped instead.
+func sanitizeTag(name string, closing bool, attrs string, open *[]string) (tag string, ok bool) {
+	allowed, known := allowedTags[name]
+	if !known {
+		return "", false
+	}
+	if name == "br" {
+		return "<br>", !closing
+	}
+	if closing {
+		if n := len(*open); n > 0 && (*open)[n-1] == name {
+			*open = (*open)[:n-1]
+			return "</" + name + ">", true
+		}
+		// A closing tag that doesn't match is dropped.
+		return "", true
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + name)
+	href := ""
+	for _, a := range attrRe.FindAllStringSubmatch(attrs, -1) {
+		key := strings.ToLower(a[1])
+		if !slices.Contains(allowed, key) {
+			continue
+		}
+		val := html.UnescapeString(a[2] + a[3])
+		switch key {
+		case "href":
+			if !safeURL(val) {
+				return "", false
+			}
+			href = val
+		case "class":
+			if classRe.MatchString(val) {
+				b.WriteString(` class="` + val + `"`)
+			}
+		}
+	}
+	if name == "a" {
+		if href == "" || slices.Contains(*open, "a") {
+			return "", false
+		}
+		b.WriteString(` href="` + template.HTMLEscapeString(href) + `" rel="` + linkRel + `"`)
+	}
+	b.WriteString(">")
+	*open = append(*open, name)
+	return b.String(), true
+}
+
+// safeURL reports whether u is an absolute http or https URL.
+func safeURL(u string) bool {
+	lower := strings.ToLower(u)
+	return (strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")) &&
+		!strings.ContainsAny(u, "\x00\n\r\t")
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Dump writes every table of the current database to w as SQL statements
+// that recreate it: DROP TABLE, CREATE TABLE and one INSERT per row. A
+// dump may take longer than the query timeout, which doesn't apply to it.
+func Dump(ctx context.Context, db Connection, w io.Writer) error {
+	ctx = withoutTimeout(ctx)
+	tables, err := listTables(ctx, db)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "-- quotes backup %s\n", time.Now().UTC().Format(time.RFC3339))
+	for _, t := range tables {
+		if err := dumpTable(ctx, db, bw, t); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func listTables(ctx context.Context, db Connection) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SHOW TABLES")
+	if err != nil {
+		return nil, fmt.Errorf("show tables: %w", err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("scan table: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return tables, nil
+}
+
+func dumpTable(ctx context.Context, db Connection, w io.Writer, table string) error {
+	var name, create string
+	if err := db.QueryRowContext(ctx, "SHOW CREATE TABLE "+quoteIdent(table)).Scan(&name, &create); err != nil {
+		return fmt.Errorf("show create table %s: %w", table, err)
+	}
+	fmt.Fprintf(w, "\nDROP TABLE IF EXISTS %s;\n%s;\n", quoteIdent(table), create)
+
+	rows, err := db.QueryContext(ctx, "SELECT * FROM "+quoteIdent(table))
+	if err != nil {
+		return fmt.Errorf("select %s: %w", table, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("columns %s: %w", table, err)
+	}
+	idents := make([]string, len(cols))
+	for i, c := range cols {
+		idents[i] = quoteIdent(c)
+	}
+	prefix := "INSERT INTO " + quoteIdent(table) + " (" + strings.Join(idents, ", ") + ") VALUES ("
+
+	vals := make([]sql.RawBytes, len(cols))
+	dest := make([]any, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scan %s: %w", table, err)
+		}
+		lits := make([]string, len(vals))
+		for i, v := range vals {
+			lits[i] = quoteLiteral(v)
+		}
+		if _, err := fmt.Fprintf(w, "%s%s);\n", prefix, strings.Join(lits, ", ")); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	return nil
+}
+
+func quoteIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+func quoteLiteral(v sql.RawBytes) string {
+	if v == nil {
+		return "NULL"
+	}
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		`'`, `\'`,
+		"\x00", `\0`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\x1a", `\Z`,
+	)
+	return "'" + r.Replace(string(v)) + "'"
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+const collectionSelect = "SELECT id, owner, slug, name, favourites, created FROM collections"
+
+type CollectionRepository struct {
+	db     Connection
+	quotes *QuoteRepository
+}
+
+func NewCollectionRepository(db Connection) *CollectionRepository {
+	return &CollectionRepository{db: db, quotes: NewQuoteRepository(db)}
+}
+
+func (cr *CollectionRepository) Create(ctx context.Context, c *domain.Collection) error {
+	const insertQuery = `
+		INSERT INTO collections (owner, slug, name, favourites, created)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	res, err := cr.db.ExecContext(ctx, insertQuery, c.Owner, c.Slug, c.Name, c.Favourites, c.Created)
+	if isDuplicateKey(err) {
+		return fmt.Errorf("collection %q: %w", c.Slug, domain.ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("insert collection: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("last insert id: %w", err)
+	}
+	c.ID = int(id)
+	return nil
+}
+
+func (cr *CollectionRepository) GetBySlug(ctx context.Context, slug string) (*domain.Collection, error) {
+	return scanCollection(cr.db.QueryRowContext(ctx, collectionSelect+" WHERE slug = ?", slug))
+}
+
+func (cr *CollectionRepository) GetFavourites(ctx context.Context, owner string) (*domain.Collection, error) {
+	return scanCollection(cr.db.QueryRowContext(ctx,
+		collectionSelect+" WHERE owner = ? AND favourites = 1 ORDER BY id LIMIT 1", owner))
+}
+
+func (cr *CollectionRepository) ListByOwner(ctx context.Context, owner string) ([]*domain.Collection, error) {
+	const query = `
+		SELECT c.id, c.owner, c.slug, c.name, c.favourites, c.created, COUNT(e.quote_id)
+		FROM collections c
+		LEFT JOIN collection_quotes e ON e.collection_id = c.id
+		WHERE c.owner = ?
+		GROUP BY c.id
+		ORDER BY c.favourites DESC, c.id DESC
+	`
+	rows, err := cr.db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, fmt.Errorf("query collections: %w", err)
+	}
+	defer rows.Close()
+	var list []*domain.Collection
+	for rows.Next() {
+		var size int
+		c, err := scanCollection(trailing{rows, &size})
+		if err != nil {
+			return nil, err
+		}
+		c.Size = size
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return list, nil
+}
+
+func (cr *CollectionRepository) Rename(ctx context.Context, id int, name string) error {
+	if _, err := cr.db.ExecContext(ctx, "UPDATE collections SET name = ? WHERE id = ?", name, id); err != nil {
+		return fmt.Errorf("rename collection: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a collection; its entries go with it through the foreign
+// key.
+func (cr *CollectionRepository) Delete(ctx context.Context, id int) error {
+	res, err := cr.db.ExecContext(ctx, "DELETE FROM collections WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("collection %d: %w", id, domain.ErrNotFound)
+	}
+	return nil
+}
+
+func (cr *CollectionRepository) Add(ctx context.Context, collectionID, quoteID int) error {
+	const insertQuery = `
+		INSERT INTO collection_quotes (collection_id, quote_id, position, added)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1, ?
+		FROM collection_quotes WHERE collection_id = ?
+	`
+	_, err := cr.db.ExecContext(ctx, insertQuery, collectionID, quoteID, time.Now().UTC(), collectionID)
+	if isDuplicateKey(err) {
+		return fmt.Errorf("quote %d is already in the collection: %w", quoteID, domain.ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("add to collection: %w", err)
+	}
+	return nil
+}
+
+func (cr *CollectionRepository) Remove(ctx context.Context, collectionID, quoteID int) error {
+	res, err := cr.db.ExecContext(ctx,
+		"DELETE FROM collection_quotes WHERE collection_id = ? AND quote_id = ?", collectionID, quoteID)
+	if err != nil {
+		return fmt.Errorf("remove from collection: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("quote %d in collection: %w", quoteID, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// Move swaps a quote with its neighbour in a transaction, locking both
+// rows so that concurrent moves can't leave two quotes in one position.
+func (cr *CollectionRepository) Move(ctx context.Context, collectionID, quoteID, direction int) error {
+	return inTx(ctx, cr.db, func(tx Connection) error {
+		return move(ctx, tx, collectionID, quoteID, direction)
+	})
+}
+
+func move(ctx context.Context, tx Connection, collectionID, quoteID, direction int) error {
+	var position int
+	err := tx.QueryRowContext(ctx,
+		"SELECT position FROM collection_quotes WHERE collection_id = ? AND quote_id = ? FOR UPDATE",
+		collectionID, quoteID,
+	).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("quote %d in collection: %w", quoteID, domain.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("query position: %w", err)
+	}
+
+	neighbourQuery := "SELECT quote_id, position FROM collection_quotes WHERE collection_id = ? AND position < ? ORDER BY position DESC LIMIT 1 FOR UPDATE"
+	if direction > 0 {
+		neighbourQuery = "SELECT quote_id, position FROM collection_quotes WHERE collection_id = ? AND position > ? ORDER BY position LIMIT 1 FOR UPDATE"
+	}
+	var otherID, otherPosition int
+	err = tx.QueryRowContext(ctx, neighbourQuery, collectionID, position).Scan(&otherID, &otherPosition)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already first or last.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("query neighbour: %w", err)
+	}
+
+	const updateQuery = "UPDATE collection_quotes SET position = ? WHERE collection_id = ? AND quote_id = ?"
+	if _, err := tx.ExecContext(ctx, updateQuery, otherPosition, collectionID, quoteID); err != nil {
+		return fmt.Errorf("move quote: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, updateQuery, position, collectionID, otherID); err != nil {
+		return fmt.Errorf("move quote: %w", err)
+	}
+	return nil
+}
+
+func (cr *CollectionRepository) Contains(ctx context.Context, collectionID int, quoteIDs []int) (map[int]bool, error) {
+	found := make(map[int]bool)
+	if len(quoteIDs) == 0 {
+		return found, nil
+	}
+	query := "SELECT quote_id FROM collection_quotes WHERE collection_id = ? AND quote_id IN (" + placeholders(len(quoteIDs)) + ")"
+	rows, err := cr.db.QueryContext(ctx, query, append([]any{collectionID}, intArgs(quoteIDs)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("query collection: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan quote id: %w", err)
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return found, nil
+}
+
+func (cr *CollectionRepository) GetQuotes(ctx context.Context, collectionID int, cursor string, limit int) (*domain.Page, error) {
+	return cr.quotes.listPage(ctx, byPosition(collectionID), "", nil, cursor, limit)
+}
+
+func (cr *CollectionRepository) AllQuotes(ctx context.Context, collectionID int) ([]*domain.Quote, error) {
+	const query = baseSelect + `
+		JOIN collection_quotes entries ON entries.quote_id = quotes.id
+		WHERE entries.collection_id = ?
+		ORDER BY entries.position
+	`
+	return cr.quotes.queryQuotes(ctx, query, collectionID)
+}
+
+func (cr *CollectionRepository) AccountOf(ctx context.Context, visitor string) (int, error) {
+	var userID int
+	err := cr.db.QueryRowContext(ctx, "SELECT user_id FROM visitor_accounts WHERE visitor = ?", visitor).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("visitor account: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query visitor account: %w", err)
+	}
+	return userID, nil
+}
+
+func (cr *CollectionRepository) Link(ctx context.Context, visitor string, userID int) error {
+	const upsert = `
+		INSERT INTO visitor_accounts (visitor, user_id, linked) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), linked = VALUES(linked)
+	`
+	if _, err := cr.db.ExecContext(ctx, upsert, visitor, userID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("link visitor: %w", err)
+	}
+	return nil
+}
+
+// Transfer moves the favourites of from behind those of to, if both have
+// any, and then hands the remaining collections over.
+func (cr *CollectionRepository) Transfer(ctx context.Context, from, to string) error {
+	source, err := cr.GetFavourites(ctx, from)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	target, err := cr.GetFavourites(ctx, to)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+	if source != nil && target != nil {
+		var offset int
+		if err := cr.db.QueryRowContext(ctx,
+			"SELECT COALESCE(MAX(position), 0) FROM collection_quotes WHERE collection_id = ?", target.ID,
+		).Scan(&offset); err != nil {
+			return fmt.Errorf("query position: %w", err)
+		}
+		const mergeQuery = `
+			INSERT IGNORE INTO collection_quotes (collection_id, quote_id, position, added)
+			SELECT ?, quote_id, position + ?, added FROM collection_quotes WHERE collection_id = ?
+		`
+		if _, err := cr.db.ExecContext(ctx, mergeQuery, target.ID, offset, source.ID); err != nil {
+			return fmt.Errorf("merge favourites: %w", err)
+		}
+		if err := cr.Delete(ctx, source.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := cr.db.ExecContext(ctx, "UPDATE collections SET owner = ? WHERE owner = ?", to, from); err != nil {
+		return fmt.Errorf("transfer collections: %w", err)
+	}
+	return nil
+}
+
+func scanCollection(s scanner) (*domain.Collection, error) {
+	var c domain.Collection
+	var rawDate string
+	if err := s.Scan(&c.ID, &c.Owner, &c.Slug, &c.Name, &c.Favourites, &rawDate); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("collection: %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("scan collection: %w", err)
+	}
+	c.Created = parseMySQLDate(rawDate)
+	return &c, nil
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+const commentSelect = "SELECT id, quote_id, parent_id, author, body, date, ip, hidden FROM comments"
+
+type CommentRepository struct {
+	db Connection
+}
+
+func NewCommentRepository(db Connection) *CommentRepository {
+	return &CommentRepository{db: db}
+}
+
+func (cr *CommentRepository) Create(ctx context.Context, c *domain.Comment) error {
+	const insertQuery = `
+		INSERT INTO comments (quote_id, parent_id, author, body, date, ip, hidden)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	var parent sql.NullInt64
+	if c.ParentID != 0 {
+		parent = sql.NullInt64{Int64: int64(c.ParentID), Valid: true}
+	}
+	res, err := cr.db.ExecContext(ctx, insertQuery,
+		c.QuoteID, parent, c.Author, c.Body, c.Date, c.IP, c.Hidden,
+	)
+	if err != nil {
+		return fmt.Errorf("insert comment: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("last insert id: %w", err)
+	}
+	c.ID = int(id)
+	return nil
+}
+
+func (cr *CommentRepository) GetByID(ctx context.Context, id int) (*domain.Comment, error) {
+	row := cr.db.QueryRowContext(ctx, commentSelect+" WHERE id = ?", id)
+	return scanComment(row)
+}
+
+func (cr *CommentRepository) ListByQuote(ctx context.Context, quoteID int) ([]*domain.Comment, error) {
+	return cr.list(ctx, commentSelect+" WHERE quote_id = ? ORDER BY id", quoteID)
+}
+
+func (cr *CommentRepository) Recent(ctx context.Context, limit int) ([]*domain.Comment, error) {
+	return cr.list(ctx, commentSelect+" ORDER BY id DESC LIMIT ?", limit)
+}
+
+func (cr *CommentRepository) list(ctx context.Context, query string, args ...any) ([]*domain.Comment, error) {
+	rows, err := cr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+	defer rows.Close()
+	var comments []*domain.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return comments, nil
+}
+
+func (cr *CommentRepository) CountVisible(ctx context.Context, quoteIDs []int) (map[int]int, error) {
+	counts := make(map[int]int)
+	if len(quoteIDs) == 0 {
+		return counts, nil
+	}
+	query := `
+		SELECT quote_id, COUNT(*) FROM comments
+		WHERE hidden = 0 AND quote_id IN (` + placeholders(len(quoteIDs)) + `)
+		GROUP BY quote_id
+	`
+	rows, err := cr.db.QueryContext(ctx, query, intArgs(quoteIDs)...)
+	if err != nil {
+		return nil, fmt.Errorf("count comments: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("scan comment count: %w", err)
+		}
+		counts[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return counts, nil
+}
+
+func (cr *CommentRepository) SetHidden(ctx context.Context, id int, hidden bool) error {
+	res, err := cr.db.ExecContext(ctx, "UPDATE comments SET hidden = ? WHERE id = ?", hidden, id)
+	if err != nil {
+		return fmt.Errorf("update comment: %w", err)
+	}
+	// MySQL reports unchanged rows as unaffected, so look the comment up
+	// before calling it missing.
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := cr.GetByID(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a comment; its replies go with it through the foreign key.
+func (cr *CommentRepository) Delete(ctx context.Context, id int) error {
+	res, err := cr.db.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete comment: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("comment %d: %w", id, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// ScrubIPs clears the stored identifier of every comment posted before the
+// given time.
+func (cr *CommentRepository) ScrubIPs(ctx context.Context, before time.Time) (int64, error) {
+	res, err := cr.db.ExecContext(ctx,
+		"UPDATE comments SET ip = '' WHERE date < ? AND ip <> ''", before)
+	if err != nil {
+		return 0, fmt.Errorf("scrub comment ips: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func scanComment(s scanner) (*domain.Comment, error) {
+	var c domain.Comment
+	var parent sql.NullInt64
+	var rawDate string
+	if err := s.Scan(
+		&c.ID, &c.QuoteID, &parent, &c.Author, &c.Body, &rawDate, &c.IP, &c.Hidden,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("comment: %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("scan comment: %w", err)
+	}
+	c.ParentID = int(parent.Int64)
+	c.Date = parseMySQLDate(rawDate)
+	return &c, nil
+}
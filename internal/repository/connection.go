@@ -6,8 +6,37 @@ import (
 )
 
 type Connection interface {
-	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
-	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
-	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) Row
+}
+
+// transactor is a Connection that can run statements in a transaction.
+type transactor interface {
+	InTx(ctx context.Context, fn func(Connection) error) error
+}
+
+// inTx runs fn in a transaction of db, committed if fn succeeds, on the
+// InnoDB tables. A Connection without transactions, as the fakes of the
+// tests, runs fn on itself.
+func inTx(ctx context.Context, db Connection, fn func(Connection) error) error {
+	if t, ok := db.(transactor); ok {
+		return t.InTx(ctx, fn)
+	}
+	return fn(db)
+}
+
+// Rows is the result of a query, as *sql.Rows.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Columns() ([]string, error)
+	Err() error
+	Close() error
+}
+
+// Row is the result of a query for a single row, as *sql.Row.
+type Row interface {
+	Scan(dest ...any) error
+	Err() error
 }
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// cursor marks a position in a listing by the sort key and ID of the quote
+// next to it. Before cursors point at the page preceding that quote.
+type cursor struct {
+	Before bool   `json:"b,omitempty"`
+	Key    string `json:"k"`
+	ID     int    `json:"i"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, domain.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return c, domain.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ordering is a keyset sort order: column descending, then id descending,
+// or both ascending. The column may come from a join, whose placeholders
+// take joinArgs.
+type ordering struct {
+	column    string
+	join      string
+	joinArgs  []any
+	param     func(string) (any, error)
+	ascending bool
+}
+
+var (
+	byDate = ordering{
+		column: "date",
+		param:  func(s string) (any, error) { return s, nil },
+	}
+	byLikes = ordering{
+		column: "likes",
+		param:  func(s string) (any, error) { return strconv.Atoi(s) },
+	}
+)
+
+// byReaction orders quotes by how many visitors gave them a reaction,
+// leaving out quotes nobody did.
+func byReaction(name string) ordering {
+	return ordering{
+		column: "reacted.n",
+		join: ` JOIN (
+			SELECT quote_id, COUNT(*) AS n FROM reactions WHERE reaction = ? GROUP BY quote_id
+		) reacted ON reacted.quote_id = quotes.id`,
+		joinArgs: []any{name},
+		param:    func(s string) (any, error) { return strconv.Atoi(s) },
+	}
+}
+
+// byPosition orders the quotes of a collection as its owner arranged them.
+func byPosition(collectionID int) ordering {
+	return ordering{
+		column:    "entries.position",
+		join:      " JOIN collection_quotes entries ON entries.quote_id = quotes.id AND entries.collection_id = ?",
+		joinArgs:  []any{collectionID},
+		param:     func(s string) (any, error) { return strconv.Atoi(s) },
+		ascending: true,
+	}
+}
+
+// listPage returns the page of quotes matching where (which may be empty)
+// at the position given by the cursor. It fetches one extra row to know
+// whether another page follows.
+func (qr *QuoteRepository) listPage(
+	ctx context.Context, o ordering, where string, whereArgs []any, cursorStr string, limit int,
+) (*domain.Page, error) {
+	var c cursor
+	var conds []string
+	args := slices.Clone(o.joinArgs)
+	if where != "" {
+		conds = append(conds, where)
+		args = append(args, whereArgs...)
+	}
+	forward, backward := [2]string{"<", "DESC"}, [2]string{">", "ASC"}
+	if o.ascending {
+		forward, backward = backward, forward
+	}
+	cmp, dir := forward[0], forward[1]
+	if cursorStr != "" {
+		var err error
+		if c, err = decodeCursor(cursorStr); err != nil {
+			return nil, err
+		}
+		key, err := o.param(c.Key)
+		if err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+		if c.Before {
+			cmp, dir = backward[0], backward[1]
+		}
+		conds = append(conds, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", o.column, cmp))
+		args = append(args, key, key, c.ID)
+	}
+
+	query := "SELECT " + quoteFields + ", " + o.column + " FROM quotes" + o.join
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s LIMIT ?", o.column, dir)
+	args = append(args, limit+1)
+
+	quotes, keys, err := qr.queryKeyed(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	more := len(quotes) > limit
+	if more {
+		quotes, keys = quotes[:limit], keys[:limit]
+	}
+	if c.Before {
+		slices.Reverse(quotes)
+		slices.Reverse(keys)
+	}
+
+	page := &domain.Page{Quotes: quotes}
+	if len(quotes) == 0 {
+		return page, nil
+	}
+	hasNext, hasPrev := more, cursorStr != ""
+	if c.Before {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		last := len(quotes) - 1
+		page.Next = encodeCursor(cursor{Key: keys[last], ID: quotes[last].ID})
+	}
+	if hasPrev {
+		page.Prev = encodeCursor(cursor{Before: true, Key: keys[0], ID: quotes[0].ID})
+	}
+	return page, nil
+}
+
+// queryKeyed runs a listPage query, whose rows end with the sort key.
+func (qr *QuoteRepository) queryKeyed(ctx context.Context, query string, args ...any) ([]*domain.Quote, []string, error) {
+	rows, err := qr.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query quotes: %w", err)
+	}
+	defer rows.Close()
+
+	var quotes []*domain.Quote
+	var keys []string
+	for rows.Next() {
+		var key string
+		q, err := scanQuote(trailing{rows, &key})
+		if err != nil {
+			return nil, nil, err
+		}
+		quotes = append(quotes, q)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows error: %w", err)
+	}
+	return quotes, keys, nil
+}
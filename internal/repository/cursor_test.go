@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := cursor{Before: true, Key: "2007-05-01 12:00:00", ID: 42}
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatalf("decodeCursor() error: %v", err)
+	}
+	if got != want {
+		t.Errorf("decodeCursor() = %+v; want %+v", got, want)
+	}
+	for _, bad := range []string{"!!", "bm90IGpzb24", encodeCursor(cursor{Key: "x"})} {
+		if _, err := decodeCursor(bad); !errors.Is(err, domain.ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v; want ErrInvalidCursor", bad, err)
+		}
+	}
+}
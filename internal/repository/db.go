@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+const (
+	// breakerThreshold is how many queries in a row must fail to reach the
+	// database before the breaker opens.
+	breakerThreshold = 5
+	// breakerCooldown is how long an open breaker fails queries before
+	// letting them through again.
+	breakerCooldown = 10 * time.Second
+	// readRetries is how many more times a read that failed to reach the
+	// database is sent, waiting readRetryDelay, then twice as long.
+	readRetries    = 2
+	readRetryDelay = 50 * time.Millisecond
+)
+
+// MySQL errors that mean the server can't take queries right now.
+const (
+	mysqlTooManyConnections = 1040
+	mysqlServerShutdown     = 1053
+)
+
+// errBreakerOpen is returned without sending the query while the breaker
+// is open.
+var errBreakerOpen = fmt.Errorf("%w: database is down", domain.ErrUnavailable)
+
+// DB is the Connection the application uses. It bounds each query by a
+// timeout, sends reads that failed to reach the database again, and stops
+// sending queries for a while once the database looks down. Queries that
+// fail to reach the database return errors wrapping domain.ErrUnavailable.
+type DB struct {
+	pool    *sql.DB
+	timeout time.Duration
+	breaker *breaker
+}
+
+// NewDB wraps a pool. A timeout of zero leaves queries unbounded.
+func NewDB(pool *sql.DB, logger *slog.Logger, timeout time.Duration) *DB {
+	return &DB{
+		pool:    pool,
+		timeout: timeout,
+		breaker: &breaker{logger: logger, threshold: breakerThreshold, cooldown: breakerCooldown, now: time.Now},
+	}
+}
+
+func (db *DB) Close() error {
+	return db.pool.Close()
+}
+
+// Available reports whether the database is taken to be up: false from
+// when the breaker opens until a query succeeds again.
+func (db *DB) Available() bool {
+	return !db.breaker.isOpen()
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if err := db.breaker.allow(); err != nil {
+		return nil, err
+	}
+	qctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	res, err := db.pool.ExecContext(qctx, query, args...)
+	return res, db.done(ctx, err)
+}
+
+// QueryContext runs a read, sending it again if it failed to reach the
+// database. The timeout covers reading the rows, until they are closed.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	delay := readRetryDelay
+	for attempt := 0; ; attempt++ {
+		if err := db.breaker.allow(); err != nil {
+			return nil, err
+		}
+		qctx, cancel := db.withTimeout(ctx)
+		rows, err := db.pool.QueryContext(qctx, query, args...)
+		if err == nil {
+			db.breaker.success()
+			return &timedRows{Rows: rows, cancel: cancel}, nil
+		}
+		cancel()
+		retry := unreachable(err) && attempt < readRetries
+		if err := db.done(ctx, err); !retry {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	rows, err := db.QueryContext(ctx, query, args...)
+	return &row{rows: rows, err: err}
+}
+
+// InTx runs fn in a transaction, committing it if fn succeeds and rolling
+// it back otherwise. Each statement has the timeout, and reads aren't sent
+// again, since the transaction is tied to its connection.
+func (db *DB) InTx(ctx context.Context, fn func(Connection) error) error {
+	if err := db.breaker.allow(); err != nil {
+		return err
+	}
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", db.done(ctx, err))
+	}
+	if err := fn(&txConn{tx: tx, db: db}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", db.done(ctx, err))
+	}
+	return nil
+}
+
+// txConn is the Connection of a transaction of a DB.
+type txConn struct {
+	tx *sql.Tx
+	db *DB
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	qctx, cancel := c.db.withTimeout(ctx)
+	defer cancel()
+	res, err := c.tx.ExecContext(qctx, query, args...)
+	return res, c.db.done(ctx, err)
+}
+
+func (c *txConn) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	qctx, cancel := c.db.withTimeout(ctx)
+	rows, err := c.tx.QueryContext(qctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, c.db.done(ctx, err)
+	}
+	c.db.breaker.success()
+	return &timedRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (c *txConn) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	rows, err := c.QueryContext(ctx, query, args...)
+	return &row{rows: rows, err: err}
+}
+
+// noTimeoutKey marks contexts whose queries the timeout doesn't apply to.
+type noTimeoutKey struct{}
+
+// withoutTimeout exempts the queries made with ctx from the timeout, for
+// reads that stream a whole table.
+func withoutTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.timeout <= 0 || ctx.Value(noTimeoutKey{}) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.timeout)
+}
+
+// done tells the breaker how a query made with ctx went. Failing to reach
+// the database counts against it and is reported as domain.ErrUnavailable;
+// any answer from the database, even an error, counts for it. A query
+// that ran out of time counts neither way and is reported as it is: the
+// database was reached, and a write may well have been applied.
+func (db *DB) done(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		db.breaker.success()
+		return nil
+	case ctx.Err() != nil, errors.Is(err, context.DeadlineExceeded):
+		return err
+	case unreachable(err):
+		db.breaker.failure(err)
+		return fmt.Errorf("%w: %w", domain.ErrUnavailable, err)
+	}
+	db.breaker.success()
+	return err
+}
+
+// unreachable reports whether err means the query didn't reach a database
+// able to run it. Timeouts don't: the query may well have been running.
+func unreachable(err error) bool {
+	// context.DeadlineExceeded is a net.Error too.
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && (me.Number == mysqlTooManyConnections || me.Number == mysqlServerShutdown)
+}
+
+// timedRows ends the timeout of its query when closed.
+type timedRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timedRows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// row reads the first of rows, as *sql.Row does.
+type row struct {
+	rows Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	return r.rows.Close()
+}
+
+func (r *row) Err() error {
+	return r.err
+}
+
+// breaker opens after threshold failures in a row and then fails queries
+// for cooldown. After that it lets them through: the first to succeed
+// closes it, the first to fail opens it again.
+type breaker struct {
+	logger    *slog.Logger
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	// openUntil is zero while the breaker is closed.
+	openUntil time.Time
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.openUntil.IsZero() && b.now().Before(b.openUntil) {
+		return errBreakerOpen
+	}
+	return nil
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.openUntil.IsZero() {
+		b.logger.Info("Database is available again")
+	}
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *breaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures < b.threshold && b.openUntil.IsZero() {
+		return
+	}
+	if b.now().Before(b.openUntil) {
+		return
+	}
+	b.openUntil = b.now().Add(b.cooldown)
+	b.logger.Warn("Database is unavailable, failing queries",
+		slog.Duration("for", b.cooldown), slog.Any("err", err))
+}
+
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openUntil.IsZero()
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// fakeServer answers each query with the next of its errors, then with a
+// single row holding 1. A slow server answers only when the query is
+// cancelled. It counts the transactions committed and rolled back.
+type fakeServer struct {
+	errs    []error
+	slow    bool
+	queries int
+
+	commits, rollbacks int
+}
+
+func (s *fakeServer) Connect(context.Context) (driver.Conn, error) { return fakeConn{s}, nil }
+func (s *fakeServer) Driver() driver.Driver                        { return nil }
+
+func (s *fakeServer) answer(ctx context.Context) error {
+	s.queries++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	if s.slow {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+type fakeConn struct {
+	s *fakeServer
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx{c.s}, nil }
+
+type fakeTx struct {
+	s *fakeServer
+}
+
+func (tx fakeTx) Commit() error   { tx.s.commits++; return nil }
+func (tx fakeTx) Rollback() error { tx.s.rollbacks++; return nil }
+
+func (c fakeConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.s.answer(ctx); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.s.answer(ctx); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func newTestDB(t *testing.T, s *fakeServer, timeout time.Duration) *DB {
+	pool := sql.OpenDB(s)
+	pool.SetMaxOpenConns(1)
+	t.Cleanup(func() { pool.Close() })
+	return NewDB(pool, slog.New(slog.NewTextHandler(io.Discard, nil)), timeout)
+}
+
+func TestDBRetriesReads(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeServer{errs: []error{mysql.ErrInvalidConn}}
+	db := newTestDB(t, s, time.Second)
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("Scan() = %d, %v; want 1 after a retry", n, err)
+	}
+	if s.queries != 2 {
+		t.Errorf("queries = %d; want 2", s.queries)
+	}
+
+	s.errs, s.queries = []error{mysql.ErrInvalidConn}, 0
+	if _, err := db.ExecContext(ctx, "UPDATE quotes SET likes = likes + 1"); !errors.Is(err, domain.ErrUnavailable) {
+		t.Errorf("ExecContext() = %v; want ErrUnavailable", err)
+	}
+	if s.queries != 1 {
+		t.Errorf("queries = %d; want writes sent once", s.queries)
+	}
+}
+
+func TestDBQueryTimeout(t *testing.T) {
+	s := &fakeServer{slow: true}
+	db := newTestDB(t, s, 10*time.Millisecond)
+	var n int
+	err := db.QueryRowContext(context.Background(), "SELECT SLEEP(60)").Scan(&n)
+	if errors.Is(err, domain.ErrUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Scan() = %v; want a timeout not reported as ErrUnavailable", err)
+	}
+	if s.queries != 1 {
+		t.Errorf("queries = %d; want a timed out read not retried", s.queries)
+	}
+
+	for range breakerThreshold {
+		_, err = db.ExecContext(context.Background(), "UPDATE quotes SET likes = SLEEP(60)")
+	}
+	if errors.Is(err, domain.ErrUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecContext() = %v; want a timeout not reported as ErrUnavailable", err)
+	}
+	if !db.Available() {
+		t.Error("Available() = false after timeouts; want them not counted against the database")
+	}
+}
+
+func TestDBBreaker(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeServer{}
+	db := newTestDB(t, s, time.Second)
+	now := time.Now()
+	db.breaker.now = func() time.Time { return now }
+
+	// Errors from the database itself don't count.
+	for range breakerThreshold {
+		s.errs = append(s.errs, &mysql.MySQLError{Number: mysqlDuplicateEntry})
+	}
+	for range breakerThreshold {
+		db.ExecContext(ctx, "INSERT INTO quotes (id) VALUES (1)")
+	}
+	if !db.Available() {
+		t.Fatal("Available() = false after errors from the database")
+	}
+
+	for range breakerThreshold {
+		s.errs = append(s.errs, mysql.ErrInvalidConn)
+	}
+	for range breakerThreshold {
+		db.ExecContext(ctx, "DELETE FROM quotes")
+	}
+	if db.Available() {
+		t.Fatal("Available() = true after failing to reach the database")
+	}
+	queries := s.queries
+	if _, err := db.QueryContext(ctx, "SELECT 1"); !errors.Is(err, domain.ErrUnavailable) || s.queries != queries {
+		t.Errorf("QueryContext() = %v after %d queries; want ErrUnavailable without querying", err, s.queries-queries)
+	}
+
+	now = now.Add(breakerCooldown)
+	s.errs = []error{mysql.ErrInvalidConn}
+	if _, err := db.ExecContext(ctx, "DELETE FROM quotes"); !errors.Is(err, domain.ErrUnavailable) {
+		t.Fatalf("ExecContext() = %v; want ErrUnavailable", err)
+	}
+	if err := db.breaker.allow(); err == nil {
+		t.Error("breaker let queries through after a failed probe")
+	}
+	now = now.Add(breakerCooldown)
+	if _, err := db.ExecContext(ctx, "DELETE FROM quotes"); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Available() {
+		t.Error("Available() = false after a query succeeded")
+	}
+}
+
+func TestDBInTx(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeServer{}
+	db := newTestDB(t, s, time.Second)
+	err := db.InTx(ctx, func(tx Connection) error {
+		var n int
+		if err := tx.QueryRowContext(ctx, "SELECT 1 FOR UPDATE").Scan(&n); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE collection_quotes SET position = ?", n)
+		return err
+	})
+	if err != nil || s.queries != 2 || s.commits != 1 || s.rollbacks != 0 {
+		t.Errorf("InTx() = %v after %d queries, %d commits, %d rollbacks; want both queries committed",
+			err, s.queries, s.commits, s.rollbacks)
+	}
+
+	failed := errors.New("no neighbour")
+	err = db.InTx(ctx, func(tx Connection) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE collection_quotes SET position = 1"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) || s.commits != 1 || s.rollbacks != 1 {
+		t.Errorf("InTx() = %v with %d commits, %d rollbacks; want the error and a rollback", err, s.commits, s.rollbacks)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+type FingerprintRepository struct {
+	db Connection
+}
+
+func NewFingerprintRepository(db Connection) *FingerprintRepository {
+	return &FingerprintRepository{db: db}
+}
+
+func (fr *FingerprintRepository) Put(ctx context.Context, quoteID int, fingerprint uint64) error {
+	const upsert = `
+		INSERT INTO quote_fingerprints (quote_id, fingerprint) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE fingerprint = VALUES(fingerprint)
+	`
+	if _, err := fr.db.ExecContext(ctx, upsert, quoteID, fingerprint); err != nil {
+		return fmt.Errorf("store fingerprint: %w", err)
+	}
+	return nil
+}
+
+// Near compares the fingerprint with every stored one; the table is narrow
+// enough to scan.
+func (fr *FingerprintRepository) Near(ctx context.Context, fingerprint uint64, maxDistance int) ([]int, error) {
+	const query = `
+		SELECT quote_id FROM quote_fingerprints
+		WHERE BIT_COUNT(fingerprint ^ ?) <= ?
+		ORDER BY BIT_COUNT(fingerprint ^ ?), quote_id
+	`
+	rows, err := fr.db.QueryContext(ctx, query, fingerprint, maxDistance, fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("query fingerprints: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan quote id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return ids, nil
+}
+
+func (fr *FingerprintRepository) All(ctx context.Context) (map[int]uint64, error) {
+	rows, err := fr.db.QueryContext(ctx, "SELECT quote_id, fingerprint FROM quote_fingerprints")
+	if err != nil {
+		return nil, fmt.Errorf("query fingerprints: %w", err)
+	}
+	defer rows.Close()
+	all := make(map[int]uint64)
+	for rows.Next() {
+		var id int
+		var fingerprint uint64
+		if err := rows.Scan(&id, &fingerprint); err != nil {
+			return nil, fmt.Errorf("scan fingerprint: %w", err)
+		}
+		all[id] = fingerprint
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return all, nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+const jobRunSelect = "SELECT id, job, holder, started, duration_ms, status, error FROM job_runs"
+
+// JobRepository keeps job leases and run history. Lease expiry is measured
+// on the database clock, which every replica shares.
+type JobRepository struct {
+	db Connection
+}
+
+func NewJobRepository(db Connection) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+func (jr *JobRepository) Acquire(ctx context.Context, job, holder string, due time.Time, ttl time.Duration) (bool, error) {
+	res, err := jr.db.ExecContext(ctx, `
+		INSERT IGNORE INTO job_leases (job, holder, due, expires)
+		VALUES (?, ?, ?, NOW() + INTERVAL ? SECOND)
+	`, job, holder, due, leaseSeconds(ttl))
+	if err != nil {
+		return false, fmt.Errorf("insert job lease: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	} else if n == 1 {
+		return true, nil
+	}
+
+	res, err = jr.db.ExecContext(ctx, `
+		UPDATE job_leases SET holder = ?, due = ?, expires = NOW() + INTERVAL ? SECOND
+		WHERE job = ? AND due < ? AND expires <= NOW()
+	`, holder, due, leaseSeconds(ttl), job, due)
+	if err != nil {
+		return false, fmt.Errorf("update job lease: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (jr *JobRepository) Renew(ctx context.Context, job, holder string, ttl time.Duration) (bool, error) {
+	res, err := jr.db.ExecContext(ctx,
+		"UPDATE job_leases SET expires = NOW() + INTERVAL ? SECOND WHERE job = ? AND holder = ?",
+		leaseSeconds(ttl), job, holder)
+	if err != nil {
+		return false, fmt.Errorf("renew job lease: %w", err)
+	}
+	// Renewals are a third of the TTL apart, so expires always changes
+	// and a row left alone is one another holder took.
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (jr *JobRepository) Release(ctx context.Context, job, holder string) error {
+	_, err := jr.db.ExecContext(ctx,
+		"UPDATE job_leases SET expires = NOW() WHERE job = ? AND holder = ?", job, holder)
+	if err != nil {
+		return fmt.Errorf("release job lease: %w", err)
+	}
+	return nil
+}
+
+func (jr *JobRepository) Start(ctx context.Context, run *domain.JobRun) error {
+	res, err := jr.db.ExecContext(ctx, `
+		INSERT INTO job_runs (job, holder, started, status, error)
+		VALUES (?, ?, ?, ?, ?)
+	`, run.Job, run.Holder, run.Started, run.Status, run.Error)
+	if err != nil {
+		return fmt.Errorf("insert job run: %w", err)
+	}
+	if run.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("last insert id: %w", err)
+	}
+	return nil
+}
+
+func (jr *JobRepository) Finish(ctx context.Context, run *domain.JobRun) error {
+	_, err := jr.db.ExecContext(ctx,
+		"UPDATE job_runs SET duration_ms = ?, status = ?, error = ? WHERE id = ?",
+		run.Duration.Milliseconds(), run.Status, run.Error, run.ID)
+	if err != nil {
+		return fmt.Errorf("update job run: %w", err)
+	}
+	return nil
+}
+
+func (jr *JobRepository) Runs(ctx context.Context, limit int) ([]*domain.JobRun, error) {
+	return jr.queryRuns(ctx, jobRunSelect+" ORDER BY id DESC LIMIT ?", limit)
+}
+
+func (jr *JobRepository) Latest(ctx context.Context) ([]*domain.JobRun, error) {
+	return jr.queryRuns(ctx, jobRunSelect+`
+		WHERE id IN (SELECT MAX(id) FROM job_runs GROUP BY job)
+		ORDER BY job
+	`)
+}
+
+func (jr *JobRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := jr.db.ExecContext(ctx, "DELETE FROM job_runs WHERE started < ?", before)
+	if err != nil {
+		return 0, fmt.Errorf("delete job runs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (jr *JobRepository) queryRuns(ctx context.Context, query string, args ...any) ([]*domain.JobRun, error) {
+	rows, err := jr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query job runs: %w", err)
+	}
+	defer rows.Close()
+	var runs []*domain.JobRun
+	for rows.Next() {
+		var (
+			run        domain.JobRun
+			rawStarted string
+			durationMS int64
+		)
+		if err := rows.Scan(&run.ID, &run.Job, &run.Holder, &rawStarted, &durationMS, &run.Status, &run.Error); err != nil {
+			return nil, fmt.Errorf("scan job run: %w", err)
+		}
+		run.Started = parseMySQLDate(rawStarted)
+		run.Duration = time.Duration(durationMS) * time.Millisecond
+		runs = append(runs, &run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return runs, nil
+}
+
+// leaseSeconds rounds a lease up to whole seconds, the precision of the
+// expires column.
+func leaseSeconds(ttl time.Duration) int64 {
+	return int64(math.Ceil(ttl.Seconds()))
+}
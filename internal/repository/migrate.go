@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+const createMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version varchar(255) NOT NULL,
+		applied_at datetime NOT NULL,
+		PRIMARY KEY (version)
+	)
+`
+
+// Migration is one embedded schema change, named after its file without
+// the .sql extension.
+type Migration struct {
+	Version    string
+	statements []string
+}
+
+func loadMigrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFS, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("listing migrations: %w", err)
+	}
+	sort.Strings(names)
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		b, err := migrationFS.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		m := Migration{Version: strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")}
+		for _, stmt := range strings.Split(string(b), ";\n") {
+			if stmt = strings.TrimSpace(stmt); stmt != "" {
+				m.statements = append(m.statements, strings.TrimSuffix(stmt, ";"))
+			}
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// PendingMigrations returns the versions that Migrate would apply.
+func PendingMigrations(ctx context.Context, db Connection) ([]string, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m.Version)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every embedded migration that hasn't been applied yet, in
+// order, and returns the versions it applied.
+func Migrate(ctx context.Context, db Connection) ([]string, error) {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		for _, stmt := range m.statements {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return done, fmt.Errorf("migration %s: %w", m.Version, err)
+			}
+		}
+		if _, err := db.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			m.Version, time.Now(),
+		); err != nil {
+			return done, fmt.Errorf("record migration %s: %w", m.Version, err)
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+func appliedMigrations(ctx context.Context, db Connection) (map[string]bool, error) {
+	applied := map[string]bool{}
+	var exists int
+	if err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'
+	`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	if exists == 0 {
+		return applied, nil
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan migration: %w", err)
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return applied, nil
+}
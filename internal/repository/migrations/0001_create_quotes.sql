@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `quotes` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `quote` text CHARACTER SET utf8mb3 COLLATE utf8mb3_turkish_ci NOT NULL,
+  `comment` text CHARACTER SET utf8mb3 COLLATE utf8mb3_turkish_ci NOT NULL,
+  `date` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `ip` varchar(100) CHARACTER SET utf8mb3 COLLATE utf8mb3_turkish_ci NOT NULL DEFAULT '',
+  `likes` int NOT NULL DEFAULT '0',
+  `votes` int NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id`)
+) ENGINE=MyISAM DEFAULT CHARSET=utf8mb3 COLLATE=utf8mb3_turkish_ci;
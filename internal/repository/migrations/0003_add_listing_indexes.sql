@@ -0,0 +1,2 @@
+CREATE INDEX `quotes_date_id` ON `quotes` (`date`, `id`);
+CREATE INDEX `quotes_likes_id` ON `quotes` (`likes`, `id`);
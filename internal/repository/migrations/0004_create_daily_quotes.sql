@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `daily_quotes` (
+  `day` date NOT NULL,
+  `quote_id` int NOT NULL,
+  `pinned` tinyint(1) NOT NULL DEFAULT '0',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`day`),
+  KEY `daily_quotes_quote_id` (`quote_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,7 @@
+UPDATE `quotes` SET
+  `quote` = REPLACE(`quote`, '\r\n', '\n'),
+  `comment` = REPLACE(`comment`, '\r\n', '\n');
+
+UPDATE `quotes` SET
+  `quote` = REGEXP_REPLACE(`quote`, '<br[[:space:]]*\\\\?/?>\n?', '\n', 1, 0, 'i'),
+  `comment` = REGEXP_REPLACE(`comment`, '<br[[:space:]]*\\\\?/?>\n?', '\n', 1, 0, 'i');
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `comments` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `quote_id` int NOT NULL,
+  `parent_id` int DEFAULT NULL,
+  `author` varchar(64) NOT NULL DEFAULT '',
+  `body` text NOT NULL,
+  `date` datetime NOT NULL,
+  `ip` varchar(100) NOT NULL DEFAULT '',
+  `hidden` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id`),
+  KEY `comments_quote_id` (`quote_id`, `id`),
+  KEY `comments_date` (`date`),
+  CONSTRAINT `comments_parent_id` FOREIGN KEY (`parent_id`) REFERENCES `comments` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
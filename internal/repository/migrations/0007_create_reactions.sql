@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `reactions` (
+  `quote_id` int NOT NULL,
+  `reaction` varchar(32) NOT NULL,
+  `visitor` varchar(64) NOT NULL,
+  `date` datetime NOT NULL,
+  PRIMARY KEY (`quote_id`, `reaction`, `visitor`),
+  KEY `reactions_reaction` (`reaction`, `quote_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS `collections` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `owner` varchar(64) NOT NULL,
+  `slug` varchar(80) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `favourites` tinyint(1) NOT NULL DEFAULT '0',
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `collections_slug` (`slug`),
+  KEY `collections_owner` (`owner`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `collection_quotes` (
+  `collection_id` int NOT NULL,
+  `quote_id` int NOT NULL,
+  `position` int NOT NULL,
+  `added` datetime NOT NULL,
+  PRIMARY KEY (`collection_id`, `quote_id`),
+  KEY `collection_quotes_position` (`collection_id`, `position`),
+  KEY `collection_quotes_quote_id` (`quote_id`),
+  CONSTRAINT `collection_quotes_collection_id` FOREIGN KEY (`collection_id`) REFERENCES `collections` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `visitor_accounts` (
+  `visitor` varchar(64) NOT NULL,
+  `user_id` int NOT NULL,
+  `linked` datetime NOT NULL,
+  PRIMARY KEY (`visitor`),
+  KEY `visitor_accounts_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
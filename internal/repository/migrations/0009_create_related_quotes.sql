@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `related_quotes` (
+  `quote_id` int NOT NULL,
+  `position` tinyint NOT NULL,
+  `related_id` int NOT NULL,
+  `score` double NOT NULL,
+  PRIMARY KEY (`quote_id`, `position`),
+  KEY `related_quotes_related` (`related_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `quote_fingerprints` (
+  `quote_id` int NOT NULL,
+  `fingerprint` bigint unsigned NOT NULL,
+  PRIMARY KEY (`quote_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `quote_redirects` (
+  `old_id` int NOT NULL,
+  `quote_id` int NOT NULL,
+  `merged` datetime NOT NULL,
+  PRIMARY KEY (`old_id`),
+  KEY `quote_redirects_quote_id` (`quote_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
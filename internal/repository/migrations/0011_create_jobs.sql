@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS `job_leases` (
+  `job` varchar(64) NOT NULL,
+  `holder` varchar(128) NOT NULL,
+  `due` datetime NOT NULL,
+  `expires` datetime NOT NULL,
+  PRIMARY KEY (`job`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `job_runs` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `job` varchar(64) NOT NULL,
+  `holder` varchar(128) NOT NULL,
+  `started` datetime NOT NULL,
+  `duration_ms` bigint NOT NULL DEFAULT '0',
+  `status` varchar(16) NOT NULL,
+  `error` text NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `job_runs_job` (`job`, `id`),
+  KEY `job_runs_started` (`started`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
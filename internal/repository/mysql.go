@@ -1,16 +1,42 @@
 package repository
 
 import (
+	"errors"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// mysqlDuplicateEntry is ER_DUP_ENTRY.
+const mysqlDuplicateEntry = 1062
+
+const (
+	mysqlDateLayout = "2006-01-02 15:04:05"
+	mysqlZeroDate   = "0000-00-00 00:00:00"
+)
+
+// formatMySQLDate formats t for comparing with stored dates, which are in
+// UTC since the driver converts times to it.
+func formatMySQLDate(t time.Time) string {
+	if t.IsZero() {
+		return mysqlZeroDate
+	}
+	return t.UTC().Format(mysqlDateLayout)
+}
+
 func parseMySQLDate(dateStr string) time.Time {
-	if dateStr == "0000-00-00 00:00:00" {
+	if dateStr == mysqlZeroDate {
 		return time.Time{}
 	}
-	t, err := time.Parse("2006-01-02 15:04:05", dateStr)
+	t, err := time.Parse(mysqlDateLayout, dateStr)
 	if err != nil {
 		return time.Time{}
 	}
 	return t
 }
+
+// isDuplicateKey reports whether err is a unique key violation.
+func isDuplicateKey(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == mysqlDuplicateEntry
+}
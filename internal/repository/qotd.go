@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+type DailyQuoteRepository struct {
+	db Connection
+}
+
+func NewDailyQuoteRepository(db Connection) *DailyQuoteRepository {
+	return &DailyQuoteRepository{db: db}
+}
+
+func (dr *DailyQuoteRepository) Get(ctx context.Context, day time.Time) (*domain.DailyQuote, error) {
+	const query = "SELECT day, quote_id, pinned FROM daily_quotes WHERE day = ?"
+	var d domain.DailyQuote
+	var rawDay string
+	err := dr.db.QueryRowContext(ctx, query, day.Format(time.DateOnly)).Scan(&rawDay, &d.QuoteID, &d.Pinned)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan daily quote: %w", err)
+	}
+	d.Day, _ = time.Parse(time.DateOnly, rawDay)
+	return &d, nil
+}
+
+func (dr *DailyQuoteRepository) Add(ctx context.Context, d *domain.DailyQuote) error {
+	query := `
+		INSERT IGNORE INTO daily_quotes (day, quote_id, pinned, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	if d.Pinned {
+		query = `
+			INSERT INTO daily_quotes (day, quote_id, pinned, created_at)
+			VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE quote_id = VALUES(quote_id), pinned = VALUES(pinned)
+		`
+	}
+	if _, err := dr.db.ExecContext(ctx, query,
+		d.Day.Format(time.DateOnly), d.QuoteID, d.Pinned, time.Now(),
+	); err != nil {
+		return fmt.Errorf("insert daily quote: %w", err)
+	}
+	return nil
+}
+
+func (dr *DailyQuoteRepository) QuoteIDsSince(ctx context.Context, day time.Time) ([]int, error) {
+	rows, err := dr.db.QueryContext(ctx,
+		"SELECT quote_id FROM daily_quotes WHERE day >= ?", day.Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("query daily quotes: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan daily quote: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return ids, nil
+}
+
+// History returns up to limit selections made before day, newest first,
+// with their quotes. Selections of deleted quotes are skipped.
+func (dr *DailyQuoteRepository) History(ctx context.Context, before time.Time, limit int) ([]*domain.DailyQuote, error) {
+	const query = `
+		SELECT d.day, d.pinned,
+			q.id, q.quote, q.comment, q.date, q.ip, q.likes, q.votes
+		FROM daily_quotes d
+		JOIN quotes q ON q.id = d.quote_id
+		WHERE d.day < ?
+		ORDER BY d.day DESC
+		LIMIT ?
+	`
+	rows, err := dr.db.QueryContext(ctx, query, before.Format(time.DateOnly), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query daily quotes: %w", err)
+	}
+	defer rows.Close()
+	var list []*domain.DailyQuote
+	for rows.Next() {
+		var d domain.DailyQuote
+		var q domain.Quote
+		var rawDay, rawDate string
+		if err := rows.Scan(
+			&rawDay, &d.Pinned,
+			&q.ID, &q.Quote, &q.Comment, &rawDate, &q.IP, &q.Likes, &q.Votes,
+		); err != nil {
+			return nil, fmt.Errorf("scan daily quote: %w", err)
+		}
+		d.Day, _ = time.Parse(time.DateOnly, rawDay)
+		q.Date = parseMySQLDate(rawDate)
+		d.QuoteID, d.Quote = q.ID, &q
+		list = append(list, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return list, nil
+}
@@ -3,7 +3,13 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/hionay/quotes/internal/domain"
 )
@@ -13,76 +19,514 @@ const (
 	baseSelect  = "SELECT " + quoteFields + " FROM quotes"
 )
 
+// GetRandom draws IDs in batches of enough to expect randomBatchHits
+// matching quotes each, up to randomBatchMax IDs, and gives up on exact
+// draws after randomBatches of them.
+const (
+	randomBatches   = 3
+	randomBatchHits = 3
+	randomBatchMax  = 500
+)
+
 type QuoteRepository struct {
 	db Connection
+	// replicas serve listings, single quotes and statistics, in turn.
+	replicas []Connection
+	turn     atomic.Uint64
 }
 
-func NewQuoteRepository(db Connection) *QuoteRepository {
-	return &QuoteRepository{db: db}
+// NewQuoteRepository returns a repository on the primary db. Reads that
+// can lag behind writes go to the replicas if there are any; writes, and
+// the reads of a session after it wrote, go to db.
+func NewQuoteRepository(db Connection, replicas ...Connection) *QuoteRepository {
+	return &QuoteRepository{db: db, replicas: replicas}
 }
 
 func (qr *QuoteRepository) Create(ctx context.Context, q *domain.Quote) error {
+	markWritten(ctx)
 	const insertQuery = `
         INSERT INTO quotes (quote, comment, date, ip)
         VALUES (?, ?, ?, ?)
     `
-	if _, err := qr.db.ExecContext(ctx,
+	res, err := qr.db.ExecContext(ctx,
 		insertQuery,
 		q.Quote, q.Comment, q.Date, q.IP,
-	); err != nil {
+	)
+	if err != nil {
 		return fmt.Errorf("insert quote: %w", err)
 	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("last insert id: %w", err)
+	}
+	q.ID = int(id)
+	return nil
+}
+
+// Import inserts q with its likes, votes and, when set, its ID, as read from
+// an export.
+func (qr *QuoteRepository) Import(ctx context.Context, q *domain.Quote) error {
+	markWritten(ctx)
+	const insertQuery = `
+		INSERT INTO quotes (id, quote, comment, date, ip, likes, votes)
+		VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?)
+	`
+	res, err := qr.db.ExecContext(ctx,
+		insertQuery,
+		q.ID, q.Quote, q.Comment, q.Date, q.IP, q.Likes, q.Votes,
+	)
+	if isDuplicateKey(err) {
+		return fmt.Errorf("quote %d: %w", q.ID, domain.ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("import quote: %w", err)
+	}
+	if q.ID == 0 {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("last insert id: %w", err)
+		}
+		q.ID = int(id)
+	}
+	return nil
+}
+
+// Delete removes a quote with its discussion, reactions, fingerprint and
+// the IDs merged into it, and takes it out of every collection and every
+// list of related quotes. Its days as Quote of the Day are forgotten, so
+// that a new quote is chosen if it is today's.
+func (qr *QuoteRepository) Delete(ctx context.Context, id int) error {
+	markWritten(ctx)
+	res, err := qr.db.ExecContext(ctx, "DELETE FROM quotes WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete quote: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("quote %d: %w", id, domain.ErrNotFound)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM comments WHERE quote_id = ?", id); err != nil {
+		return fmt.Errorf("delete comments: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM reactions WHERE quote_id = ?", id); err != nil {
+		return fmt.Errorf("delete reactions: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM collection_quotes WHERE quote_id = ?", id); err != nil {
+		return fmt.Errorf("delete collection entries: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM related_quotes WHERE quote_id = ? OR related_id = ?", id, id); err != nil {
+		return fmt.Errorf("delete related quotes: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM daily_quotes WHERE quote_id = ?", id); err != nil {
+		return fmt.Errorf("delete daily quotes: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM quote_fingerprints WHERE quote_id = ?", id); err != nil {
+		return fmt.Errorf("delete fingerprint: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM quote_redirects WHERE quote_id = ?", id); err != nil {
+		return fmt.Errorf("delete redirects: %w", err)
+	}
+	return nil
+}
+
+// Merge folds the quotes dups into keep. Their likes and votes are added
+// to keep's; their comments, reactions, collection entries and days as
+// Quote of the Day move to it; and their IDs, and any merged into them
+// before, redirect to it. Those moves run in one transaction. The quotes
+// table is MyISAM, outside it, so it is changed last, once they are
+// committed: one statement moves the likes and votes, then the duplicates
+// are deleted. A merge that fails at either can be run again.
+func (qr *QuoteRepository) Merge(ctx context.Context, keep int, dups []int) error {
+	markWritten(ctx)
+	if len(dups) == 0 {
+		return nil
+	}
+	in := "(" + placeholders(len(dups)) + ")"
+	ids := intArgs(dups)
+	with := func(first ...any) []any {
+		return append(first, ids...)
+	}
+
+	values := make([]string, len(dups))
+	redirects := make([]any, 0, 3*len(dups))
+	now := time.Now().UTC()
+	for i, id := range dups {
+		values[i] = "(?, ?, ?)"
+		redirects = append(redirects, id, keep, now)
+	}
+	steps := []struct {
+		query string
+		args  []any
+		what  string
+	}{
+		{"UPDATE quote_redirects SET quote_id = ? WHERE quote_id IN " + in, with(keep), "update redirects"},
+		{"INSERT INTO quote_redirects (old_id, quote_id, merged) VALUES " + strings.Join(values, ", ") +
+			" ON DUPLICATE KEY UPDATE quote_id = VALUES(quote_id), merged = VALUES(merged)", redirects, "insert redirects"},
+		{"UPDATE comments SET quote_id = ? WHERE quote_id IN " + in, with(keep), "move comments"},
+		{"UPDATE IGNORE reactions SET quote_id = ? WHERE quote_id IN " + in, with(keep), "move reactions"},
+		{"DELETE FROM reactions WHERE quote_id IN " + in, with(), "delete repeated reactions"},
+		{"UPDATE IGNORE collection_quotes SET quote_id = ? WHERE quote_id IN " + in, with(keep), "move collection entries"},
+		{"DELETE FROM collection_quotes WHERE quote_id IN " + in, with(), "delete repeated collection entries"},
+		{"UPDATE daily_quotes SET quote_id = ? WHERE quote_id IN " + in, with(keep), "move daily quotes"},
+		{"DELETE FROM related_quotes WHERE quote_id IN " + in + " OR related_id IN " + in, append(with(), ids...), "delete related quotes"},
+		{"DELETE FROM quote_fingerprints WHERE quote_id IN " + in, with(), "delete fingerprints"},
+	}
+	err := inTx(ctx, qr.db, func(tx Connection) error {
+		for _, step := range steps {
+			if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+				return fmt.Errorf("%s: %w", step.what, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Zeroing the duplicates' likes and votes as they move makes running
+	// this again add nothing.
+	if _, err := qr.db.ExecContext(ctx,
+		"UPDATE quotes q JOIN (SELECT COALESCE(SUM(likes), 0) AS likes, COALESCE(SUM(votes), 0) AS votes FROM quotes WHERE id IN "+in+") s"+
+			" SET q.likes = IF(q.id = ?, q.likes + s.likes, 0), q.votes = IF(q.id = ?, q.votes + s.votes, 0)"+
+			" WHERE q.id = ? OR q.id IN "+in,
+		append(append(with(), keep, keep, keep), ids...)...,
+	); err != nil {
+		return fmt.Errorf("move votes: %w", err)
+	}
+	if _, err := qr.db.ExecContext(ctx, "DELETE FROM quotes WHERE id IN "+in, ids...); err != nil {
+		return fmt.Errorf("delete duplicates: %w", err)
+	}
+	return nil
+}
+
+// GetRedirect returns the quote that the quote with an ID was merged into.
+func (qr *QuoteRepository) GetRedirect(ctx context.Context, id int) (int, error) {
+	var to int
+	err := qr.reader(ctx).QueryRowContext(ctx, "SELECT quote_id FROM quote_redirects WHERE old_id = ?", id).Scan(&to)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("redirect of quote %d: %w", id, domain.ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query redirect: %w", err)
+	}
+	return to, nil
+}
+
+// Each calls fn for every quote in ID order, stopping at the first error.
+// It isn't bound by the query timeout, since fn runs while rows are read.
+func (qr *QuoteRepository) Each(ctx context.Context, fn func(*domain.Quote) error) error {
+	rows, err := qr.reader(ctx).QueryContext(withoutTimeout(ctx), baseSelect+" ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("query quotes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		q, err := scanQuote(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
 	return nil
 }
 
 func (qr *QuoteRepository) GetByID(ctx context.Context, id int) (*domain.Quote, error) {
 	query := baseSelect + " WHERE id = ?"
-	row := qr.db.QueryRowContext(ctx, query, id)
+	row := qr.reader(ctx).QueryRowContext(ctx, query, id)
 	return scanQuote(row)
 }
 
-func (qr *QuoteRepository) GetLatest(ctx context.Context, page, limit int) ([]*domain.Quote, error) {
-	query := baseSelect + " ORDER BY date DESC LIMIT ? OFFSET ?"
-	return qr.queryQuotes(ctx, query, limit, (page-1)*limit)
+func (qr *QuoteRepository) GetByIDs(ctx context.Context, ids []int) ([]*domain.Quote, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return qr.queryQuotes(ctx, baseSelect+" WHERE id IN ("+placeholders(len(ids))+")", intArgs(ids)...)
 }
 
-func (qr *QuoteRepository) GetTop(ctx context.Context, page, limit int) ([]*domain.Quote, error) {
-	query := baseSelect + " ORDER BY likes DESC LIMIT ? OFFSET ?"
-	return qr.queryQuotes(ctx, query, limit, (page-1)*limit)
+func (qr *QuoteRepository) GetLatest(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return qr.listPage(ctx, byDate, "", nil, cursor, limit)
 }
 
-func (qr *QuoteRepository) GetRandom(ctx context.Context) (*domain.Quote, error) {
-	query := baseSelect + " ORDER BY RAND() LIMIT 1"
-	row := qr.db.QueryRowContext(ctx, query)
-	return scanQuote(row)
+func (qr *QuoteRepository) GetTop(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return qr.listPage(ctx, byLikes, "", nil, cursor, limit)
+}
+
+// GetOnThisDay lists quotes submitted on day's month and day in earlier
+// years, newest first.
+func (qr *QuoteRepository) GetOnThisDay(ctx context.Context, day time.Time, cursor string, limit int) (*domain.Page, error) {
+	var first sql.NullInt64
+	err := qr.reader(ctx).QueryRowContext(ctx, "SELECT YEAR(MIN(date)) FROM quotes WHERE "+validDate).Scan(&first)
+	if err != nil {
+		return nil, fmt.Errorf("first year: %w", err)
+	}
+	// One range a year, rather than MONTH and DAYOFMONTH, so the date
+	// index is used. Years without the day, as 29 February, are skipped.
+	var ranges []string
+	var args []any
+	for year := int(first.Int64); first.Valid && year < day.Year(); year++ {
+		from := time.Date(year, day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+		if from.Month() != day.Month() {
+			continue
+		}
+		ranges = append(ranges, "(date >= ? AND date < ?)")
+		args = append(args, formatMySQLDate(from), formatMySQLDate(from.AddDate(0, 0, 1)))
+	}
+	if len(ranges) == 0 {
+		return &domain.Page{}, nil
+	}
+	return qr.listPage(ctx, byDate, "("+strings.Join(ranges, " OR ")+")", args, cursor, limit)
+}
+
+// GetByPeriod lists quotes submitted in [from, to), newest first.
+func (qr *QuoteRepository) GetByPeriod(ctx context.Context, from, to time.Time, cursor string, limit int) (*domain.Page, error) {
+	return qr.listPage(ctx, byDate,
+		"date >= ? AND date < ?",
+		[]any{formatMySQLDate(from), formatMySQLDate(to)},
+		cursor, limit)
+}
+
+// CountByYear returns the number of quotes per year, newest year first.
+func (qr *QuoteRepository) CountByYear(ctx context.Context) ([]domain.PeriodCount, error) {
+	const query = `
+		SELECT YEAR(date) AS y, COUNT(*)
+		FROM quotes
+		WHERE ` + validDate + `
+		GROUP BY y
+		ORDER BY y DESC
+	`
+	return qr.queryCounts(ctx, query, func(c *domain.PeriodCount) []any {
+		return []any{&c.Year, &c.Count}
+	})
+}
+
+// CountByMonth returns the number of quotes per month of year, in calendar
+// order. Months without quotes are left out.
+func (qr *QuoteRepository) CountByMonth(ctx context.Context, year int) ([]domain.PeriodCount, error) {
+	const query = `
+		SELECT MONTH(date) AS m, COUNT(*)
+		FROM quotes
+		WHERE date >= ? AND date < ?
+		GROUP BY m
+		ORDER BY m
+	`
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	counts, err := qr.queryCounts(ctx, query, func(c *domain.PeriodCount) []any {
+		return []any{&c.Month, &c.Count}
+	}, formatMySQLDate(from), formatMySQLDate(from.AddDate(1, 0, 0)))
+	for i := range counts {
+		counts[i].Year = year
+	}
+	return counts, err
+}
+
+func (qr *QuoteRepository) queryCounts(
+	ctx context.Context, query string, dest func(*domain.PeriodCount) []any, args ...any,
+) ([]domain.PeriodCount, error) {
+	rows, err := qr.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query counts: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.PeriodCount
+	for rows.Next() {
+		var c domain.PeriodCount
+		if err := rows.Scan(dest(&c)...); err != nil {
+			return nil, fmt.Errorf("scan count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return counts, nil
+}
+
+// GetRandom picks a quote without sorting the table: it draws IDs between
+// the smallest and largest matching ID and looks a batch of them up by
+// primary key at once. The first ID drawn that matches a quote is as
+// likely to be any of them, however the IDs are spread. Only if every
+// batch lands in gaps, which takes a filter matching very few quotes over
+// a wide range, is the next matching ID after a final draw used instead.
+func (qr *QuoteRepository) GetRandom(ctx context.Context, f domain.RandomFilter) (*domain.Quote, error) {
+	db := qr.reader(ctx)
+	where, args := randomFilterSQL(f)
+	var minID, maxID sql.NullInt64
+	var count int64
+	if err := db.QueryRowContext(ctx,
+		"SELECT MIN(id), MAX(id), COUNT(*) FROM quotes WHERE 1=1"+where, args...,
+	).Scan(&minID, &maxID, &count); err != nil {
+		return nil, fmt.Errorf("query id range: %w", err)
+	}
+	if !minID.Valid {
+		return nil, fmt.Errorf("random quote: %w", domain.ErrNotFound)
+	}
+	int64N := rand.Int64N
+	if f.Seed != 0 {
+		int64N = rand.New(rand.NewPCG(f.Seed, f.Seed)).Int64N
+	}
+	span := maxID.Int64 - minID.Int64 + 1
+	draw := func() int64 {
+		return minID.Int64 + int64N(span)
+	}
+
+	size := int(min(randomBatchMax, (randomBatchHits*span+count-1)/count))
+	for range randomBatches {
+		ids := make([]any, size)
+		for i := range ids {
+			ids[i] = draw()
+		}
+		q, err := firstDrawn(ctx, db, ids, where, args)
+		if !errors.Is(err, domain.ErrNotFound) {
+			return q, err
+		}
+	}
+	query := baseSelect + " WHERE id >= ?" + where + " ORDER BY id LIMIT 1"
+	return scanQuote(db.QueryRowContext(ctx, query, append([]any{draw()}, args...)...))
+}
+
+// firstDrawn returns the quote matching where whose ID comes first in ids.
+func firstDrawn(ctx context.Context, db Connection, ids []any, where string, args []any) (*domain.Quote, error) {
+	rows, err := db.QueryContext(ctx,
+		baseSelect+" WHERE id IN ("+placeholders(len(ids))+")"+where, append(slices.Clone(ids), args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("query quotes: %w", err)
+	}
+	defer rows.Close()
+	found := make(map[int64]*domain.Quote)
+	for rows.Next() {
+		q, err := scanQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		found[int64(q.ID)] = q
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	for _, id := range ids {
+		if q, ok := found[id.(int64)]; ok {
+			return q, nil
+		}
+	}
+	return nil, fmt.Errorf("random quote: %w", domain.ErrNotFound)
+}
+
+func randomFilterSQL(f domain.RandomFilter) (string, []any) {
+	var b strings.Builder
+	var args []any
+	if f.MinLikes != nil {
+		b.WriteString(" AND likes >= ?")
+		args = append(args, *f.MinLikes)
+	}
+	if !f.From.IsZero() {
+		b.WriteString(" AND date >= ?")
+		args = append(args, formatMySQLDate(f.From))
+	}
+	if !f.To.IsZero() {
+		b.WriteString(" AND date < ?")
+		args = append(args, formatMySQLDate(f.To))
+	}
+	if len(f.ExcludeIDs) > 0 {
+		b.WriteString(" AND id NOT IN (?" + strings.Repeat(", ?", len(f.ExcludeIDs)-1) + ")")
+		for _, id := range f.ExcludeIDs {
+			args = append(args, id)
+		}
+	}
+	return b.String(), args
 }
 
 func (qr *QuoteRepository) LikeQuote(ctx context.Context, id int) error {
+	markWritten(ctx)
 	const updateQuery = `
 		UPDATE quotes
 		SET likes = likes + 1, votes = votes + 1
 		WHERE id = ?
 	`
-	if _, err := qr.db.ExecContext(ctx, updateQuery, id); err != nil {
+	res, err := qr.db.ExecContext(ctx, updateQuery, id)
+	if err != nil {
 		return fmt.Errorf("update quote: %w", err)
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("quote %d: %w", id, domain.ErrNotFound)
+	}
 	return nil
 }
 
 func (qr *QuoteRepository) DislikeQuote(ctx context.Context, id int) error {
+	markWritten(ctx)
 	const updateQuery = `
 		UPDATE quotes
 		SET likes = likes - 1, votes = votes + 1
 		WHERE id = ?
 	`
-	if _, err := qr.db.ExecContext(ctx, updateQuery, id); err != nil {
+	res, err := qr.db.ExecContext(ctx, updateQuery, id)
+	if err != nil {
 		return fmt.Errorf("update quote: %w", err)
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("quote %d: %w", id, domain.ErrNotFound)
+	}
 	return nil
 }
 
+// ScrubIPs clears the stored identifier of every quote submitted before
+// the given time.
+func (qr *QuoteRepository) ScrubIPs(ctx context.Context, before time.Time) (int64, error) {
+	const updateQuery = `
+		UPDATE quotes
+		SET ip = ''
+		WHERE date < ? AND ip <> ''
+	`
+	res, err := qr.db.ExecContext(ctx, updateQuery, before)
+	if err != nil {
+		return 0, fmt.Errorf("scrub ips: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RewriteIPs passes every stored identifier to rewrite and updates the rows
+// for which it reports a change. It returns the number of rows updated.
+func (qr *QuoteRepository) RewriteIPs(ctx context.Context, rewrite func(string) (string, bool)) (int64, error) {
+	rows, err := qr.db.QueryContext(ctx, "SELECT id, ip FROM quotes WHERE ip <> ''")
+	if err != nil {
+		return 0, fmt.Errorf("query ips: %w", err)
+	}
+	updates := map[int]string{}
+	for rows.Next() {
+		var id int
+		var ip string
+		if err := rows.Scan(&id, &ip); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan ip: %w", err)
+		}
+		if newIP, ok := rewrite(ip); ok {
+			updates[id] = newIP
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, fmt.Errorf("rows close: %w", err)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows error: %w", err)
+	}
+
+	var n int64
+	for id, ip := range updates {
+		if _, err := qr.db.ExecContext(ctx, "UPDATE quotes SET ip = ? WHERE id = ?", ip, id); err != nil {
+			return n, fmt.Errorf("update ip: %w", err)
+		}
+		n++
+	}
+	return n, nil
+}
+
 func (qr *QuoteRepository) queryQuotes(ctx context.Context, query string, args ...any) ([]*domain.Quote, error) {
-	rows, err := qr.db.QueryContext(ctx, query, args...)
+	rows, err := qr.reader(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query quotes: %w", err)
 	}
@@ -106,6 +550,17 @@ type scanner interface {
 	Scan(dest ...any) error
 }
 
+// trailing scans rows that have one more column than the scan function it
+// is passed to reads, storing that column in extra.
+type trailing struct {
+	scanner
+	extra any
+}
+
+func (t trailing) Scan(dest ...any) error {
+	return t.scanner.Scan(append(dest, t.extra)...)
+}
+
 func scanQuote(s scanner) (*domain.Quote, error) {
 	var q domain.Quote
 	var rawDate string
@@ -114,7 +569,7 @@ func scanQuote(s scanner) (*domain.Quote, error) {
 		&q.IP, &q.Likes, &q.Votes,
 	); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("quote not found: %w", err)
+			return nil, fmt.Errorf("quote: %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("scan quote: %w", err)
 	}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// TestQuoteRepositoryCreateSetsID checks that new quotes come back with
+// their ID, which the live updates of the page link to.
+func TestQuoteRepositoryCreateSetsID(t *testing.T) {
+	db := &recordingConn{queries: 41}
+	q := &domain.Quote{Quote: "<nick> hello"}
+	if err := NewQuoteRepository(db).Create(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if q.ID != 42 {
+		t.Errorf("ID after Create() = %d; want the inserted ID 42", q.ID)
+	}
+}
+
+// TestQuoteRepositoryDeleteForgetsDays checks that a deleted quote stops
+// being the Quote of the Day, so that another is chosen.
+func TestQuoteRepositoryDeleteForgetsDays(t *testing.T) {
+	db := &recordingConn{}
+	if err := NewQuoteRepository(db).Delete(context.Background(), 7); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(db.execs, func(q string) bool { return strings.Contains(q, "DELETE FROM daily_quotes") }) {
+		t.Errorf("Delete() ran %q; want its daily quotes deleted", db.execs)
+	}
+}
+
+// valuesRow is a row holding values of the types they are scanned into,
+// or no row if nil.
+type valuesRow []any
+
+func (r valuesRow) Scan(dest ...any) error {
+	if r == nil {
+		return sql.ErrNoRows
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r[i]))
+	}
+	return nil
+}
+
+func (r valuesRow) Err() error { return nil }
+
+// sparseConn answers GetRandom's queries for a table holding the quotes
+// with the given IDs, in order.
+type sparseConn struct {
+	recordingConn
+	ids []int
+	// fallbacks counts the lookups of the next ID after a draw.
+	fallbacks int
+}
+
+func quoteRow(id int) valuesRow {
+	return valuesRow{id, "", "", mysqlZeroDate, "", 0, 0}
+}
+
+func (c *sparseConn) QueryContext(_ context.Context, query string, args ...any) (Rows, error) {
+	var rows quoteRows
+	for _, id := range c.ids {
+		if slices.Contains(args, any(int64(id))) {
+			rows = append(rows, quoteRow(id))
+		}
+	}
+	return &rows, nil
+}
+
+func (c *sparseConn) QueryRowContext(_ context.Context, query string, args ...any) Row {
+	if strings.Contains(query, "COUNT(*)") {
+		return valuesRow{
+			sql.NullInt64{Int64: int64(c.ids[0]), Valid: true},
+			sql.NullInt64{Int64: int64(c.ids[len(c.ids)-1]), Valid: true},
+			int64(len(c.ids)),
+		}
+	}
+	c.fallbacks++
+	for _, id := range c.ids {
+		if int64(id) >= args[0].(int64) {
+			return quoteRow(id)
+		}
+	}
+	return valuesRow(nil)
+}
+
+// quoteRows are the rows left to read, the current one first.
+type quoteRows []valuesRow
+
+func (r *quoteRows) Next() bool {
+	return len(*r) > 0
+}
+
+func (r *quoteRows) Scan(dest ...any) error {
+	row := (*r)[0]
+	*r = (*r)[1:]
+	return row.Scan(dest...)
+}
+
+func (r *quoteRows) Columns() ([]string, error) { return nil, nil }
+func (r *quoteRows) Err() error                 { return nil }
+func (r *quoteRows) Close() error               { return nil }
+
+// TestGetRandomUniformOverGaps checks that a quote after a long run of
+// deleted IDs is drawn no more often than the others.
+func TestGetRandomUniformOverGaps(t *testing.T) {
+	db := &sparseConn{ids: []int{1, 2, 1000}}
+	repo := NewQuoteRepository(db)
+	counts := map[int]int{}
+	const draws = 3000
+	for range draws {
+		q, err := repo.GetRandom(context.Background(), domain.RandomFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[q.ID]++
+	}
+	for _, id := range []int{1, 2, 1000} {
+		if n := counts[id]; n < draws/4 || n > draws/2 {
+			t.Errorf("quote %d drawn %d times in %d; want about a third", id, n, draws)
+		}
+	}
+	if db.fallbacks > draws/20 {
+		t.Errorf("fell back to the next ID %d times in %d; want the draws to find quotes", db.fallbacks, draws)
+	}
+}
+
+// txRecordingConn records which statements ran in a transaction.
+type txRecordingConn struct {
+	recordingConn
+	inTx    bool
+	txExecs []string
+}
+
+func (c *txRecordingConn) InTx(_ context.Context, fn func(Connection) error) error {
+	c.inTx = true
+	defer func() { c.inTx = false }()
+	return fn(c)
+}
+
+func (c *txRecordingConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if c.inTx {
+		c.txExecs = append(c.txExecs, query)
+	}
+	return c.recordingConn.ExecContext(ctx, query, args...)
+}
+
+// TestMergeInTx checks that a merge moves everything tied to the
+// duplicates in a transaction and changes the MyISAM quotes table after.
+func TestMergeInTx(t *testing.T) {
+	db := &txRecordingConn{}
+	if err := NewQuoteRepository(db).Merge(context.Background(), 1, []int{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	outside := db.execs[len(db.txExecs):]
+	if len(db.txExecs) == 0 || !slices.Equal(db.execs[:len(db.txExecs)], db.txExecs) || len(outside) != 2 {
+		t.Fatalf("Merge() ran %q in the transaction, then %q; want all but the quotes changes in it", db.txExecs, outside)
+	}
+	for _, q := range db.txExecs {
+		if strings.Contains(q, " quotes ") {
+			t.Errorf("Merge() ran %q in the transaction; want the quotes table changed after", q)
+		}
+	}
+	for _, q := range outside {
+		if !strings.Contains(q, " quotes ") {
+			t.Errorf("Merge() ran %q after the transaction; want it in", q)
+		}
+	}
+}
+
+// queryArgsConn records the arguments of the queries it is sent, and
+// answers single rows with row.
+type queryArgsConn struct {
+	recordingConn
+	row  valuesRow
+	args [][]any
+}
+
+func (c *queryArgsConn) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	c.args = append(c.args, args)
+	return c.recordingConn.QueryContext(ctx, query, args...)
+}
+
+func (c *queryArgsConn) QueryRowContext(context.Context, string, ...any) Row {
+	return c.row
+}
+
+// TestGetOnThisDayInUTC checks that the day, taken in a time zone, is
+// looked up between its bounds in UTC, as dates are stored.
+func TestGetOnThisDayInUTC(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	db := &queryArgsConn{row: valuesRow{sql.NullInt64{Int64: 2024, Valid: true}}}
+	day := time.Date(2026, time.March, 6, 9, 0, 0, 0, loc)
+	if _, err := NewQuoteRepository(db).GetOnThisDay(context.Background(), day, "", 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.args) != 1 {
+		t.Fatalf("GetOnThisDay() sent %d listing queries; want 1", len(db.args))
+	}
+	want := []any{"2024-03-05 21:00:00", "2024-03-06 21:00:00", "2025-03-05 21:00:00", "2025-03-06 21:00:00"}
+	if got := db.args[0][:len(want)]; !slices.Equal(got, want) {
+		t.Errorf("GetOnThisDay() bounds = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+type ReactionRepository struct {
+	db     Connection
+	quotes *QuoteRepository
+}
+
+func NewReactionRepository(db Connection) *ReactionRepository {
+	return &ReactionRepository{db: db, quotes: NewQuoteRepository(db)}
+}
+
+func (rr *ReactionRepository) Toggle(ctx context.Context, quoteID int, visitor, reaction string) (bool, error) {
+	res, err := rr.db.ExecContext(ctx,
+		"DELETE FROM reactions WHERE quote_id = ? AND reaction = ? AND visitor = ?",
+		quoteID, reaction, visitor)
+	if err != nil {
+		return false, fmt.Errorf("delete reaction: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return false, nil
+	}
+	// IGNORE keeps a concurrent toggle of the same reaction from failing.
+	if _, err := rr.db.ExecContext(ctx,
+		"INSERT IGNORE INTO reactions (quote_id, reaction, visitor, date) VALUES (?, ?, ?, ?)",
+		quoteID, reaction, visitor, time.Now().UTC(),
+	); err != nil {
+		return false, fmt.Errorf("insert reaction: %w", err)
+	}
+	return true, nil
+}
+
+func (rr *ReactionRepository) Counts(ctx context.Context, quoteIDs []int) (map[int]map[string]int, error) {
+	counts := make(map[int]map[string]int)
+	if len(quoteIDs) == 0 {
+		return counts, nil
+	}
+	query := `
+		SELECT quote_id, reaction, COUNT(*) FROM reactions
+		WHERE quote_id IN (` + placeholders(len(quoteIDs)) + `)
+		GROUP BY quote_id, reaction
+	`
+	err := rr.each(ctx, query, intArgs(quoteIDs), func(id int, reaction string, n int) {
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][reaction] = n
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (rr *ReactionRepository) ByVisitor(ctx context.Context, quoteIDs []int, visitor string) (map[int][]string, error) {
+	chosen := make(map[int][]string)
+	if len(quoteIDs) == 0 || visitor == "" {
+		return chosen, nil
+	}
+	query := `
+		SELECT quote_id, reaction, 1 FROM reactions
+		WHERE visitor = ? AND quote_id IN (` + placeholders(len(quoteIDs)) + `)
+	`
+	args := append([]any{visitor}, intArgs(quoteIDs)...)
+	err := rr.each(ctx, query, args, func(id int, reaction string, _ int) {
+		chosen[id] = append(chosen[id], reaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chosen, nil
+}
+
+func (rr *ReactionRepository) GetTop(ctx context.Context, reaction, cursor string, limit int) (*domain.Page, error) {
+	return rr.quotes.listPage(ctx, byReaction(reaction), "", nil, cursor, limit)
+}
+
+// each calls fn with every (quote_id, reaction, number) row of query.
+func (rr *ReactionRepository) each(ctx context.Context, query string, args []any, fn func(int, string, int)) error {
+	rows, err := rr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query reactions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, n int
+		var reaction string
+		if err := rows.Scan(&id, &reaction, &n); err != nil {
+			return fmt.Errorf("scan reaction: %w", err)
+		}
+		fn(id, reaction, n)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	return nil
+}
+
+// placeholders returns n comma separated placeholders for an IN list.
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+func intArgs(ids []int) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
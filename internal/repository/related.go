@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+type RelatedRepository struct {
+	db     Connection
+	quotes *QuoteRepository
+}
+
+func NewRelatedRepository(db Connection) *RelatedRepository {
+	return &RelatedRepository{db: db, quotes: NewQuoteRepository(db)}
+}
+
+// Replace swaps the related quotes of a quote in a transaction, so that
+// readers never see it without any.
+func (rr *RelatedRepository) Replace(ctx context.Context, quoteID int, suggestions []domain.Suggestion) error {
+	return inTx(ctx, rr.db, func(tx Connection) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM related_quotes WHERE quote_id = ?", quoteID); err != nil {
+			return fmt.Errorf("delete related quotes: %w", err)
+		}
+		if len(suggestions) == 0 {
+			return nil
+		}
+		values := make([]string, len(suggestions))
+		args := make([]any, 0, 4*len(suggestions))
+		for i, s := range suggestions {
+			values[i] = "(?, ?, ?, ?)"
+			args = append(args, quoteID, i, s.QuoteID, s.Score)
+		}
+		query := "INSERT INTO related_quotes (quote_id, position, related_id, score) VALUES " + strings.Join(values, ", ")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("insert related quotes: %w", err)
+		}
+		return nil
+	})
+}
+
+func (rr *RelatedRepository) Get(ctx context.Context, quoteID, limit int) ([]*domain.Quote, error) {
+	const query = baseSelect + `
+		JOIN related_quotes related ON related.related_id = quotes.id
+		WHERE related.quote_id = ?
+		ORDER BY related.position
+		LIMIT ?
+	`
+	return rr.quotes.queryQuotes(ctx, query, quoteID, limit)
+}
+
+func (rr *RelatedRepository) All(ctx context.Context) (map[int][]int, error) {
+	rows, err := rr.db.QueryContext(ctx, "SELECT quote_id, related_id FROM related_quotes ORDER BY quote_id, position")
+	if err != nil {
+		return nil, fmt.Errorf("query related quotes: %w", err)
+	}
+	defer rows.Close()
+	all := make(map[int][]int)
+	for rows.Next() {
+		var quoteID, relatedID int
+		if err := rows.Scan(&quoteID, &relatedID); err != nil {
+			return nil, fmt.Errorf("scan related quote: %w", err)
+		}
+		all[quoteID] = append(all[quoteID], relatedID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return all, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaLag is how long after a write reads are still sent to the
+// primary, on the assumption that the replicas have caught up by then.
+const ReplicaLag = 10 * time.Second
+
+// sessionKey holds the session of a context, see WithSession.
+type sessionKey struct{}
+
+// session records whether a quote has been written in it.
+type session struct {
+	wrote atomic.Bool
+	// primary sends reads to the primary even before anything is written.
+	primary bool
+}
+
+// WithSession starts a session in ctx. Once a quote is written with it,
+// reads made with it go to the primary instead of a replica, so that they
+// see the write however far the replicas lag behind.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// Primary starts a session in ctx whose reads go to the primary from the
+// start, for reads that must see a recent write: the page a form redirects
+// to, or a value about to be cached.
+func Primary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{primary: true})
+}
+
+// markWritten records a write in the session of ctx, if it has one.
+func markWritten(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// HasWritten reports whether a quote has been written in the session of
+// ctx.
+func HasWritten(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
+
+func readsPrimary(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && (s.primary || s.wrote.Load())
+}
+
+// reader returns the connection for a read made with ctx: the replicas in
+// turn, skipping any that is down, or the primary if there is none left,
+// or the session of ctx reads from the primary.
+func (qr *QuoteRepository) reader(ctx context.Context) Connection {
+	if len(qr.replicas) == 0 || readsPrimary(ctx) {
+		return qr.db
+	}
+	start := qr.turn.Add(1)
+	for i := range uint64(len(qr.replicas)) {
+		r := qr.replicas[(start+i)%uint64(len(qr.replicas))]
+		if a, ok := r.(interface{ Available() bool }); !ok || a.Available() {
+			return r
+		}
+	}
+	return qr.db
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// recordingConn counts the queries sent to it and finds no rows. Inserts
+// get the number of queries so far as their ID.
+type recordingConn struct {
+	queries int
+	down    bool
+	// execs are the statements run by ExecContext.
+	execs []string
+}
+
+type insertResult int64
+
+func (r insertResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r insertResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ ...any) (sql.Result, error) {
+	c.queries++
+	c.execs = append(c.execs, query)
+	return insertResult(c.queries), nil
+}
+
+func (c *recordingConn) QueryContext(context.Context, string, ...any) (Rows, error) {
+	c.queries++
+	return noRows{}, nil
+}
+
+func (c *recordingConn) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	rows, err := c.QueryContext(ctx, query, args...)
+	return &row{rows: rows, err: err}
+}
+
+func (c *recordingConn) Available() bool { return !c.down }
+
+type noRows struct{}
+
+func (noRows) Next() bool                 { return false }
+func (noRows) Scan(...any) error          { return errors.New("no row to scan") }
+func (noRows) Columns() ([]string, error) { return nil, nil }
+func (noRows) Err() error                 { return nil }
+func (noRows) Close() error               { return nil }
+
+func TestQuoteRepositoryRoutesReads(t *testing.T) {
+	primary, a, b := &recordingConn{}, &recordingConn{}, &recordingConn{}
+	qr := NewQuoteRepository(primary, a, b)
+	counts := func() [3]int { return [3]int{primary.queries, a.queries, b.queries} }
+	ctx := WithSession(context.Background())
+
+	if _, err := qr.GetByID(ctx, 1); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("GetByID() = %v; want ErrNotFound", err)
+	}
+	if _, err := qr.GetLatest(ctx, "", 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := counts(); got != [3]int{0, 1, 1} {
+		t.Errorf("queries after two reads = %v; want one on each replica", got)
+	}
+
+	b.down = true
+	qr.GetTop(ctx, "", 10)
+	qr.GetTop(ctx, "", 10)
+	if got := counts(); got != [3]int{0, 3, 1} {
+		t.Errorf("queries with a replica down = %v; want the other replica used", got)
+	}
+
+	// Another request reads from the replicas after this one writes.
+	other := WithSession(context.Background())
+	if err := qr.LikeQuote(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	qr.GetByID(other, 1)
+	if got := counts(); got != [3]int{1, 4, 1} {
+		t.Errorf("queries after a vote = %v; want the vote on the primary, the other read on a replica", got)
+	}
+	qr.GetByID(ctx, 1)
+	if got := counts(); got != [3]int{2, 4, 1} {
+		t.Errorf("queries after reading a vote = %v; want the read on the primary", got)
+	}
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// validDate excludes the zero dates of quotes imported without one.
+const validDate = "date > '1000-01-01'"
+
+func (qr *QuoteRepository) Totals(ctx context.Context) (quotes, votes int, err error) {
+	const query = "SELECT COUNT(*), COALESCE(SUM(votes), 0) FROM quotes"
+	if err := qr.reader(ctx).QueryRowContext(ctx, query).Scan(&quotes, &votes); err != nil {
+		return 0, 0, fmt.Errorf("count quotes: %w", err)
+	}
+	return quotes, votes, nil
+}
+
+// CountPerMonth returns the number of quotes in every month that has any,
+// oldest first.
+func (qr *QuoteRepository) CountPerMonth(ctx context.Context) ([]domain.PeriodCount, error) {
+	const query = `
+		SELECT YEAR(date) AS y, MONTH(date) AS m, COUNT(*)
+		FROM quotes
+		WHERE ` + validDate + `
+		GROUP BY y, m
+		ORDER BY y, m
+	`
+	return qr.queryCounts(ctx, query, func(c *domain.PeriodCount) []any {
+		return []any{&c.Year, &c.Month, &c.Count}
+	})
+}
+
+// VoteDistribution groups quotes by likes into buckets of the given width,
+// lowest first.
+func (qr *QuoteRepository) VoteDistribution(ctx context.Context, width int) ([]domain.VoteBucket, error) {
+	const query = `
+		SELECT FLOOR(likes / ?) AS b, COUNT(*)
+		FROM quotes
+		GROUP BY b
+		ORDER BY b
+	`
+	rows, err := qr.reader(ctx).QueryContext(ctx, query, width)
+	if err != nil {
+		return nil, fmt.Errorf("query vote distribution: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []domain.VoteBucket
+	for rows.Next() {
+		var b, n int
+		if err := rows.Scan(&b, &n); err != nil {
+			return nil, fmt.Errorf("scan vote bucket: %w", err)
+		}
+		buckets = append(buckets, domain.VoteBucket{Min: b * width, Max: b*width + width - 1, Count: n})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return buckets, nil
+}
+
+func (qr *QuoteRepository) MostVoted(ctx context.Context, limit int) ([]*domain.Quote, error) {
+	return qr.queryQuotes(ctx, baseSelect+" WHERE votes > 0 ORDER BY votes DESC, id DESC LIMIT ?", limit)
+}
+
+// MostControversial returns the quotes with the most votes cancelling each
+// other out: with likes = up - down and votes = up + down, votes - |likes|
+// is twice the smaller side.
+func (qr *QuoteRepository) MostControversial(ctx context.Context, limit int) ([]*domain.Quote, error) {
+	const where = " WHERE votes > ABS(likes) ORDER BY votes - ABS(likes) DESC, votes DESC, id DESC LIMIT ?"
+	return qr.queryQuotes(ctx, baseSelect+where, limit)
+}
+
+// Activity counts submissions by weekday and hour.
+func (qr *QuoteRepository) Activity(ctx context.Context) ([]domain.ActivityCount, error) {
+	const query = `
+		SELECT DAYOFWEEK(date) - 1 AS d, HOUR(date) AS h, COUNT(*)
+		FROM quotes
+		WHERE ` + validDate + `
+		GROUP BY d, h
+	`
+	rows, err := qr.reader(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query activity: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.ActivityCount
+	for rows.Next() {
+		var c domain.ActivityCount
+		if err := rows.Scan(&c.Weekday, &c.Hour, &c.Count); err != nil {
+			return nil, fmt.Errorf("scan activity: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return counts, nil
+}
+
+// EachText calls fn with the text of every quote. Like Each, it isn't
+// bound by the query timeout.
+func (qr *QuoteRepository) EachText(ctx context.Context, fn func(string) error) error {
+	rows, err := qr.reader(ctx).QueryContext(withoutTimeout(ctx), "SELECT quote FROM quotes")
+	if err != nil {
+		return fmt.Errorf("query quotes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return fmt.Errorf("scan quote: %w", err)
+		}
+		if err := fn(text); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	return nil
+}
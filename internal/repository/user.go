@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+type UserRepository struct {
+	db Connection
+}
+
+func NewUserRepository(db Connection) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+func (ur *UserRepository) Create(ctx context.Context, u *domain.User) error {
+	const insertQuery = `
+		INSERT INTO users (username, password_hash, created_at)
+		VALUES (?, ?, ?)
+	`
+	res, err := ur.db.ExecContext(ctx, insertQuery, u.Username, u.PasswordHash, u.CreatedAt)
+	if isDuplicateKey(err) {
+		return fmt.Errorf("user %q: %w", u.Username, domain.ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("last insert id: %w", err)
+	}
+	u.ID = int(id)
+	return nil
+}
+
+func (ur *UserRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	const query = "SELECT id, username, password_hash, created_at FROM users WHERE username = ?"
+	var u domain.User
+	var rawDate string
+	if err := ur.db.QueryRowContext(ctx, query, username).Scan(
+		&u.ID, &u.Username, &u.PasswordHash, &rawDate,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user %q: %w", username, domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("scan user: %w", err)
+	}
+	u.CreatedAt = parseMySQLDate(rawDate)
+	return &u, nil
+}
+
+func (ur *UserRepository) UpdatePassword(ctx context.Context, username, hash string) error {
+	res, err := ur.db.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE username = ?", hash, username)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user %q: %w", username, domain.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+// Package schedule runs background jobs inside the server at the times
+// given by cron-style specs. A shared job takes a lease in the database
+// before each run, so that one replica runs it however many are up, and
+// every run is recorded for the admin pages.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+const (
+	// leaseTTL is how long a lease lasts without being renewed, which a
+	// running job does every third of it. A replica that dies mid-run
+	// keeps the others from the job for at most this long.
+	leaseTTL = time.Minute
+	// finishTimeout bounds recording the end of a run once the server is
+	// shutting down.
+	finishTimeout = 5 * time.Second
+	// HistoryRetention is how long runs are kept by PruneHistory.
+	HistoryRetention = 30 * 24 * time.Hour
+)
+
+// Job is work done on a schedule.
+type Job struct {
+	Name string
+	// Spec is a cron spec, as read by Parse.
+	Spec string
+	Run  func(context.Context) error
+	// Local jobs run on every replica without a lease, for work on the
+	// process itself such as warming its caches.
+	Local bool
+}
+
+// Status describes a job of a scheduler.
+type Status struct {
+	Name    string
+	Spec    string
+	Local   bool
+	Next    time.Time
+	Running bool
+}
+
+type entry struct {
+	Job
+	spec    Spec
+	next    time.Time
+	running bool
+}
+
+// Scheduler runs jobs until its context is cancelled. Specs are read in
+// its location.
+type Scheduler struct {
+	repo   domain.JobRepository
+	logger *slog.Logger
+	loc    *time.Location
+	holder string
+	now    func() time.Time
+	// renewEvery is how often a running job renews its lease.
+	renewEvery time.Duration
+
+	mu   sync.Mutex
+	jobs []*entry
+}
+
+func NewScheduler(repo domain.JobRepository, logger *slog.Logger, loc *time.Location) *Scheduler {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &Scheduler{
+		repo:       repo,
+		logger:     logger,
+		loc:        loc,
+		holder:     fmt.Sprintf("%s:%d", host, os.Getpid()),
+		now:        time.Now,
+		renewEvery: leaseTTL / 3,
+	}
+}
+
+// Add schedules a job. Names must be unique, since they identify leases
+// and runs.
+func (s *Scheduler) Add(job Job) error {
+	spec, err := Parse(job.Spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.jobs {
+		if e.Name == job.Name {
+			return fmt.Errorf("job %s is scheduled twice", job.Name)
+		}
+	}
+	s.jobs = append(s.jobs, &entry{Job: job, spec: spec, next: spec.Next(s.now().In(s.loc))})
+	return nil
+}
+
+// Jobs returns the jobs of the scheduler by name.
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Status, len(s.jobs))
+	for i, e := range s.jobs {
+		list[i] = Status{Name: e.Name, Spec: e.Job.Spec, Local: e.Local, Next: e.next, Running: e.running}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Run starts the jobs as they fall due until ctx is cancelled, then
+// cancels the running ones and waits for them to return. A run that is
+// still going when its job falls due again is skipped.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		timer.Reset(s.wait())
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		for _, due := range s.due() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.run(ctx, due.entry, due.at)
+				s.mu.Lock()
+				due.entry.running = false
+				s.mu.Unlock()
+			}()
+		}
+	}
+}
+
+// wait returns how long until the next job falls due.
+func (s *Scheduler) wait() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, e := range s.jobs {
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+	if next.IsZero() {
+		return time.Hour
+	}
+	return max(next.Sub(s.now()), 0)
+}
+
+type dueRun struct {
+	entry *entry
+	at    time.Time
+}
+
+// due returns the jobs to start now, marked as running, and moves every
+// job that fell due to its next time.
+func (s *Scheduler) due() []dueRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().In(s.loc)
+	var runs []dueRun
+	for _, e := range s.jobs {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+		at := e.next
+		e.next = e.spec.Next(now)
+		if e.running {
+			s.logger.Warn("Skipped job still running", slog.String("job", e.Name))
+			continue
+		}
+		e.running = true
+		runs = append(runs, dueRun{e, at})
+	}
+	return runs
+}
+
+// run runs a job for the time it fell due at, once across replicas unless
+// it is local, and records the run.
+func (s *Scheduler) run(ctx context.Context, e *entry, at time.Time) {
+	logger := s.logger.With(slog.String("job", e.Name))
+	if !e.Local {
+		ok, err := s.repo.Acquire(ctx, e.Name, s.holder, at, leaseTTL)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to take job lease", slog.Any("err", err))
+			}
+			return
+		}
+		if !ok {
+			return
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+			defer cancel()
+			if err := s.repo.Release(ctx, e.Name, s.holder); err != nil {
+				logger.Error("Failed to release job lease", slog.Any("err", err))
+			}
+		}()
+	}
+
+	run := &domain.JobRun{Job: e.Name, Holder: s.holder, Started: s.now(), Status: domain.JobRunning}
+	if err := s.repo.Start(ctx, run); err != nil {
+		logger.Error("Failed to record job run", slog.Any("err", err))
+	}
+	err := s.exec(ctx, logger, e)
+	run.Duration = s.now().Sub(run.Started)
+	switch {
+	case err == nil:
+		run.Status = domain.JobSucceeded
+	case ctx.Err() != nil:
+		run.Status = domain.JobCancelled
+	default:
+		run.Status = domain.JobFailed
+		logger.Error("Job failed", slog.Any("err", err))
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if run.ID == 0 {
+		return
+	}
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancel()
+	if err := s.repo.Finish(finishCtx, run); err != nil {
+		logger.Error("Failed to record job run", slog.Any("err", err))
+	}
+}
+
+// exec calls the job, renewing its lease meanwhile unless it is local.
+func (s *Scheduler) exec(ctx context.Context, logger *slog.Logger, e *entry) error {
+	if e.Local {
+		return e.Run(ctx)
+	}
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.renew(jobCtx, cancel, logger, e.Name)
+	}()
+	err := e.Run(jobCtx)
+	if err != nil && errors.Is(context.Cause(jobCtx), errLeaseLost) {
+		err = fmt.Errorf("%w: %w", errLeaseLost, err)
+	}
+	cancel(nil)
+	<-renewed
+	return err
+}
+
+// errLeaseLost cancels a job whose lease expired and was taken by another
+// holder, which may be running it already.
+var errLeaseLost = errors.New("job lease lost")
+
+// renew keeps the lease of a job until ctx is done, and cancels the job if
+// the lease is lost.
+func (s *Scheduler) renew(ctx context.Context, cancel context.CancelCauseFunc, logger *slog.Logger, job string) {
+	ticker := time.NewTicker(s.renewEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		held, err := s.repo.Renew(ctx, job, s.holder, leaseTTL)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				logger.Error("Failed to renew job lease", slog.Any("err", err))
+			}
+		case !held:
+			cancel(errLeaseLost)
+			return
+		}
+	}
+}
+
+// PruneHistory deletes the runs older than HistoryRetention. It is a job
+// itself.
+func (s *Scheduler) PruneHistory(ctx context.Context) error {
+	_, err := s.repo.Prune(ctx, s.now().Add(-HistoryRetention))
+	return err
+}
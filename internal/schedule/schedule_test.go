@@ -0,0 +1,264 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+func TestParse(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2026, time.March, 6, 10, 7, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", from, time.Date(2026, time.March, 6, 10, 15, 0, 0, time.UTC)},
+		{"7 10 * * *", from, time.Date(2026, time.March, 7, 10, 7, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", from, time.Date(2026, time.March, 9, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", from, time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches.
+		{"0 12 20 * 0", from, time.Date(2026, time.March, 8, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", from, time.Date(2026, time.March, 8, 12, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@daily", from.In(ny), time.Date(2026, time.March, 7, 0, 0, 0, 0, ny)},
+		// 2:30 doesn't exist in New York on 8 March 2026.
+		{"30 2 * * *", time.Date(2026, time.March, 7, 12, 0, 0, 0, ny), time.Date(2026, time.March, 9, 2, 30, 0, 0, ny)},
+		{"@every 1h30m", from, time.Date(2026, time.March, 6, 10, 30, 0, 0, time.UTC)},
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+	for _, tt := range tests {
+		spec, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := spec.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next(%v) = %v; want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@every 0s", "@every soon", "@sometimes"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) = nil error; want error", spec)
+		}
+	}
+}
+
+// fakeJobs keeps leases and runs in memory, with the same rules as the
+// database.
+type fakeJobs struct {
+	mu     sync.Mutex
+	now    time.Time
+	leases map[string]*fakeLease
+	runs   []domain.JobRun
+}
+
+type fakeLease struct {
+	holder       string
+	due, expires time.Time
+}
+
+func newFakeJobs() *fakeJobs {
+	return &fakeJobs{now: time.Now(), leases: map[string]*fakeLease{}}
+}
+
+func (f *fakeJobs) Acquire(_ context.Context, job, holder string, due time.Time, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, ok := f.leases[job]
+	if ok && (!l.due.Before(due) || l.expires.After(f.now)) {
+		return false, nil
+	}
+	f.leases[job] = &fakeLease{holder, due, f.now.Add(ttl)}
+	return true, nil
+}
+
+func (f *fakeJobs) Renew(_ context.Context, job, holder string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, ok := f.leases[job]
+	if !ok || l.holder != holder {
+		return false, nil
+	}
+	l.expires = f.now.Add(ttl)
+	return true, nil
+}
+
+func (f *fakeJobs) Release(_ context.Context, job, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if l, ok := f.leases[job]; ok && l.holder == holder {
+		l.expires = f.now
+	}
+	return nil
+}
+
+func (f *fakeJobs) Start(_ context.Context, run *domain.JobRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs = append(f.runs, *run)
+	run.ID = int64(len(f.runs))
+	return nil
+}
+
+func (f *fakeJobs) Finish(_ context.Context, run *domain.JobRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs[run.ID-1] = *run
+	return nil
+}
+
+func (f *fakeJobs) Runs(context.Context, int) ([]*domain.JobRun, error) { return nil, nil }
+func (f *fakeJobs) Latest(context.Context) ([]*domain.JobRun, error)    { return nil, nil }
+func (f *fakeJobs) Prune(context.Context, time.Time) (int64, error)     { return 0, nil }
+
+func (f *fakeJobs) statuses() (statuses []domain.JobStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, run := range f.runs {
+		statuses = append(statuses, run.Status)
+	}
+	return statuses
+}
+
+func newTestScheduler(repo domain.JobRepository, holder string) *Scheduler {
+	s := NewScheduler(repo, slog.New(slog.NewTextHandler(io.Discard, nil)), time.UTC)
+	s.holder = holder
+	return s
+}
+
+func TestRunOncePerReplicas(t *testing.T) {
+	repo := newFakeJobs()
+	a, b := newTestScheduler(repo, "a"), newTestScheduler(repo, "b")
+	calls := map[string]int{}
+	job := func(name string, local bool, err error) *entry {
+		return &entry{Job: Job{Name: name, Local: local, Run: func(context.Context) error {
+			calls[name]++
+			return err
+		}}}
+	}
+	shared, local, failing := job("shared", false, nil), job("local", true, nil), job("failing", false, errors.New("boom"))
+	ctx := context.Background()
+	due := time.Date(2026, time.March, 6, 0, 0, 0, 0, time.UTC)
+
+	for _, s := range []*Scheduler{a, b} {
+		s.run(ctx, shared, due)
+		s.run(ctx, local, due)
+		s.run(ctx, failing, due)
+	}
+	if calls["shared"] != 1 || calls["local"] != 2 || calls["failing"] != 1 {
+		t.Errorf("calls = %v; want shared once, local on both replicas", calls)
+	}
+
+	// The lease of a failed run is released, but its due time is done.
+	b.run(ctx, failing, due)
+	b.run(ctx, failing, due.Add(time.Minute))
+	if calls["failing"] != 2 {
+		t.Errorf("failing job ran %d times; want again only when due again", calls["failing"])
+	}
+
+	want := []domain.JobStatus{domain.JobSucceeded, domain.JobSucceeded, domain.JobFailed, domain.JobSucceeded, domain.JobFailed}
+	if got := repo.statuses(); !slices.Equal(got, want) {
+		t.Errorf("recorded %v; want %v", got, want)
+	}
+	if repo.runs[2].Error != "boom" || repo.runs[0].Holder != "a" {
+		t.Errorf("failed run = %+v; want its error and holder", repo.runs[2])
+	}
+}
+
+func TestRunCancels(t *testing.T) {
+	repo := newFakeJobs()
+	s := newTestScheduler(repo, "a")
+	started := make(chan struct{})
+	err := s.Add(Job{Name: "slow", Spec: "@every 1s", Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Job{Name: "slow", Spec: "@hourly"}); err == nil {
+		t.Error("Add() of a second job with the same name = nil error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+	if jobs := s.Jobs(); len(jobs) != 1 || !jobs[0].Running {
+		t.Errorf("Jobs() = %+v; want slow running", jobs)
+	}
+	cancel()
+	<-done
+	if got := repo.statuses(); !slices.Equal(got, []domain.JobStatus{domain.JobCancelled}) {
+		t.Errorf("recorded %v; want the run cancelled", got)
+	}
+}
+
+func TestRunLosesLease(t *testing.T) {
+	repo := newFakeJobs()
+	s := newTestScheduler(repo, "a")
+	s.renewEvery = 10 * time.Millisecond
+	started := make(chan struct{})
+	err := s.Add(Job{Name: "slow", Spec: "@every 1s", Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+	repo.mu.Lock()
+	repo.leases["slow"].holder = "b"
+	repo.mu.Unlock()
+
+	deadline := time.After(5 * time.Second)
+	for !slices.Equal(repo.statuses(), []domain.JobStatus{domain.JobFailed}) {
+		select {
+		case <-deadline:
+			t.Fatalf("recorded %v; want the run failed once its lease was lost", repo.statuses())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if got := repo.runs[0].Error; !strings.Contains(got, errLeaseLost.Error()) {
+		t.Errorf("run error = %q; want the lost lease", got)
+	}
+}
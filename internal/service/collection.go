@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// FavouritesName is the name of every favourites collection.
+const FavouritesName = "Favourites"
+
+const (
+	maxCollectionName = 100
+	maxSlugPrefix     = 40
+	slugSuffixLength  = 6
+	// slugAlphabet leaves out look-alike characters; its 32 letters divide
+	// a byte evenly.
+	slugAlphabet       = "abcdefghijkmnpqrstuvwxyz23456789"
+	slugRetries        = 3
+	visitorOwnerPrefix = "visitor:"
+	accountOwnerPrefix = "user:"
+)
+
+// CollectionService keeps the favourites and named collections of
+// visitors. Collections belong to an owner: a visitor's cookie, or the
+// account it was linked to.
+type CollectionService struct {
+	repo   domain.CollectionRepository
+	quotes domain.QuoteRepository
+	now    func() time.Time
+}
+
+func NewCollectionService(repo domain.CollectionRepository, quotes domain.QuoteRepository) *CollectionService {
+	return &CollectionService{repo: repo, quotes: quotes, now: time.Now}
+}
+
+// Owner returns the owner of the collections of a visitor, or "" when
+// there is no visitor.
+func (s *CollectionService) Owner(ctx context.Context, visitor string) (string, error) {
+	if visitor == "" {
+		return "", nil
+	}
+	userID, err := s.repo.AccountOf(ctx, visitor)
+	switch {
+	case err == nil:
+		return accountOwnerPrefix + strconv.Itoa(userID), nil
+	case errors.Is(err, domain.ErrNotFound):
+		return visitorOwnerPrefix + visitor, nil
+	}
+	return "", err
+}
+
+// Link ties a visitor to an account, so that every browser linked to it
+// shares its collections, and hands the visitor's collections to it.
+func (s *CollectionService) Link(ctx context.Context, visitor string, userID int) error {
+	if visitor == "" {
+		return fmt.Errorf("linking needs a visitor: %w", domain.ErrInvalid)
+	}
+	from, err := s.Owner(ctx, visitor)
+	if err != nil {
+		return err
+	}
+	to := accountOwnerPrefix + strconv.Itoa(userID)
+	if err := s.repo.Link(ctx, visitor, userID); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	return s.repo.Transfer(ctx, from, to)
+}
+
+// Create starts a named collection of an owner.
+func (s *CollectionService) Create(ctx context.Context, owner, name string) (*domain.Collection, error) {
+	name, err := collectionName(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.create(ctx, &domain.Collection{Owner: owner, Name: name})
+}
+
+// create stores c under a new slug made from its name, retrying on the
+// unlikely clash of the random part.
+func (s *CollectionService) create(ctx context.Context, c *domain.Collection) (*domain.Collection, error) {
+	if c.Owner == "" {
+		return nil, fmt.Errorf("collections need a visitor: %w", domain.ErrInvalid)
+	}
+	c.Created = s.now()
+	var err error
+	for range slugRetries {
+		c.Slug = Slug(c.Name)
+		if err = s.repo.Create(ctx, c); !errors.Is(err, domain.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the collection with a slug.
+func (s *CollectionService) Get(ctx context.Context, slug string) (*domain.Collection, error) {
+	return s.repo.GetBySlug(ctx, slug)
+}
+
+// Mine returns the collections of an owner, favourites first.
+func (s *CollectionService) Mine(ctx context.Context, owner string) ([]*domain.Collection, error) {
+	if owner == "" {
+		return nil, nil
+	}
+	return s.repo.ListByOwner(ctx, owner)
+}
+
+// Favourites returns the favourites collection of an owner.
+func (s *CollectionService) Favourites(ctx context.Context, owner string) (*domain.Collection, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("favourites: %w", domain.ErrNotFound)
+	}
+	return s.repo.GetFavourites(ctx, owner)
+}
+
+// Rename renames a collection of owner. Favourites keep their name.
+func (s *CollectionService) Rename(ctx context.Context, owner, slug, name string) error {
+	c, err := s.owned(ctx, owner, slug)
+	if err != nil {
+		return err
+	}
+	if c.Favourites {
+		return fmt.Errorf("favourites cannot be renamed: %w", domain.ErrInvalid)
+	}
+	if name, err = collectionName(name); err != nil {
+		return err
+	}
+	return s.repo.Rename(ctx, c.ID, name)
+}
+
+// Delete removes a collection of owner.
+func (s *CollectionService) Delete(ctx context.Context, owner, slug string) error {
+	c, err := s.owned(ctx, owner, slug)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, c.ID)
+}
+
+// Add appends a quote to a collection of owner.
+func (s *CollectionService) Add(ctx context.Context, owner, slug string, quoteID int) error {
+	c, err := s.owned(ctx, owner, slug)
+	if err != nil {
+		return err
+	}
+	if _, err := s.quotes.GetByID(ctx, quoteID); err != nil {
+		return err
+	}
+	return s.repo.Add(ctx, c.ID, quoteID)
+}
+
+// Remove takes a quote out of a collection of owner.
+func (s *CollectionService) Remove(ctx context.Context, owner, slug string, quoteID int) error {
+	c, err := s.owned(ctx, owner, slug)
+	if err != nil {
+		return err
+	}
+	return s.repo.Remove(ctx, c.ID, quoteID)
+}
+
+// Move moves a quote of a collection of owner one place towards its start,
+// or towards its end if direction is positive.
+func (s *CollectionService) Move(ctx context.Context, owner, slug string, quoteID, direction int) error {
+	c, err := s.owned(ctx, owner, slug)
+	if err != nil {
+		return err
+	}
+	return s.repo.Move(ctx, c.ID, quoteID, direction)
+}
+
+// ToggleFavourite adds a quote to the favourites of owner, or takes it out
+// if it is already there. The favourites collection is created with the
+// first favourite. It returns the quote.
+func (s *CollectionService) ToggleFavourite(ctx context.Context, owner string, quoteID int) (*domain.Quote, error) {
+	q, err := s.quotes.GetByID(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.Favourites(ctx, owner)
+	if errors.Is(err, domain.ErrNotFound) {
+		c, err = s.create(ctx, &domain.Collection{Owner: owner, Name: FavouritesName, Favourites: true})
+	}
+	if err != nil {
+		return nil, err
+	}
+	in, err := s.repo.Contains(ctx, c.ID, []int{quoteID})
+	if err != nil {
+		return nil, err
+	}
+	if in[quoteID] {
+		err = s.repo.Remove(ctx, c.ID, quoteID)
+	} else {
+		err = s.repo.Add(ctx, c.ID, quoteID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Favourited returns which of the quotes owner keeps as favourites.
+func (s *CollectionService) Favourited(ctx context.Context, owner string, quotes []*domain.Quote) (map[int]bool, error) {
+	c, err := s.Favourites(ctx, owner)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(quotes))
+	for i, q := range quotes {
+		ids[i] = q.ID
+	}
+	return s.repo.Contains(ctx, c.ID, ids)
+}
+
+// Quotes returns a page of a collection, in its order.
+func (s *CollectionService) Quotes(ctx context.Context, c *domain.Collection, cursor string, limit int) (*domain.Page, error) {
+	return s.repo.GetQuotes(ctx, c.ID, cursor, limit)
+}
+
+// All returns every quote of a collection, in its order, for export.
+func (s *CollectionService) All(ctx context.Context, c *domain.Collection) ([]*domain.Quote, error) {
+	return s.repo.AllQuotes(ctx, c.ID)
+}
+
+// owned returns the collection with a slug if owner may change it.
+func (s *CollectionService) owned(ctx context.Context, owner, slug string) (*domain.Collection, error) {
+	c, err := s.repo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if owner == "" || c.Owner != owner {
+		return nil, fmt.Errorf("collection %q belongs to someone else: %w", slug, domain.ErrForbidden)
+	}
+	return c, nil
+}
+
+func collectionName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("collection name is empty: %w", domain.ErrInvalid)
+	}
+	if utf8.RuneCountInString(name) > maxCollectionName {
+		return "", fmt.Errorf("collection name must be at most %d characters: %w", maxCollectionName, domain.ErrInvalid)
+	}
+	return name, nil
+}
+
+// Slug returns a URL path segment for a collection: the ASCII letters and
+// digits of its name joined by dashes, and a random suffix that keeps the
+// URL from being guessed.
+func Slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if b.Len() >= maxSlugPrefix {
+			break
+		}
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteByte('-')
+	}
+	suffix := make([]byte, slugSuffixLength)
+	rand.Read(suffix)
+	for _, c := range suffix {
+		b.WriteByte(slugAlphabet[int(c)%len(slugAlphabet)])
+	}
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// fakeCollections keeps collections in memory; entries are quote IDs in
+// their order.
+type fakeCollections struct {
+	domain.CollectionRepository
+	collections []*domain.Collection
+	entries     map[int][]int
+	accounts    map[string]int
+	transfers   [][2]string
+}
+
+func newFakeCollections() *fakeCollections {
+	return &fakeCollections{entries: map[int][]int{}, accounts: map[string]int{}}
+}
+
+func (f *fakeCollections) Create(_ context.Context, c *domain.Collection) error {
+	c.ID = len(f.collections) + 1
+	f.collections = append(f.collections, c)
+	return nil
+}
+
+func (f *fakeCollections) GetBySlug(_ context.Context, slug string) (*domain.Collection, error) {
+	for _, c := range f.collections {
+		if c.Slug == slug {
+			return c, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (f *fakeCollections) GetFavourites(_ context.Context, owner string) (*domain.Collection, error) {
+	for _, c := range f.collections {
+		if c.Owner == owner && c.Favourites {
+			return c, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (f *fakeCollections) Add(_ context.Context, id, quoteID int) error {
+	f.entries[id] = append(f.entries[id], quoteID)
+	return nil
+}
+
+func (f *fakeCollections) Remove(_ context.Context, id, quoteID int) error {
+	f.entries[id] = slices.DeleteFunc(f.entries[id], func(q int) bool { return q == quoteID })
+	return nil
+}
+
+func (f *fakeCollections) Contains(_ context.Context, id int, quoteIDs []int) (map[int]bool, error) {
+	found := map[int]bool{}
+	for _, q := range quoteIDs {
+		found[q] = slices.Contains(f.entries[id], q)
+	}
+	return found, nil
+}
+
+func (f *fakeCollections) AccountOf(_ context.Context, visitor string) (int, error) {
+	if id, ok := f.accounts[visitor]; ok {
+		return id, nil
+	}
+	return 0, domain.ErrNotFound
+}
+
+func (f *fakeCollections) Link(_ context.Context, visitor string, userID int) error {
+	f.accounts[visitor] = userID
+	return nil
+}
+
+func (f *fakeCollections) Transfer(_ context.Context, from, to string) error {
+	f.transfers = append(f.transfers, [2]string{from, to})
+	return nil
+}
+
+func newCollectionService(t *testing.T) (*CollectionService, *fakeCollections) {
+	t.Helper()
+	quotes := newFakeRepo()
+	quotes.quotes[1] = &domain.Quote{ID: 1}
+	quotes.quotes[2] = &domain.Quote{ID: 2}
+	repo := newFakeCollections()
+	return NewCollectionService(repo, quotes), repo
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Best of 2007 exam week!": `^best-of-2007-exam-week-[a-z2-9]{6}$`,
+		"  Ümlaut  & co ":         `^mlaut-co-[a-z2-9]{6}$`,
+		"😂":                       `^[a-z2-9]{6}$`,
+	}
+	for name, pattern := range tests {
+		if got := Slug(name); !regexp.MustCompile(pattern).MatchString(got) {
+			t.Errorf("Slug(%q) = %q; want match for %s", name, got, pattern)
+		}
+	}
+	if Slug("x") == Slug("x") {
+		t.Error("Slug returned the same suffix twice")
+	}
+}
+
+func TestToggleFavourite(t *testing.T) {
+	s, repo := newCollectionService(t)
+	ctx := context.Background()
+	owner, err := s.Owner(ctx, "v1")
+	if err != nil || owner != "visitor:v1" {
+		t.Fatalf("Owner() = %q, %v", owner, err)
+	}
+
+	for _, id := range []int{1, 2, 1} {
+		if _, err := s.ToggleFavourite(ctx, owner, id); err != nil {
+			t.Fatalf("ToggleFavourite(%d): %v", id, err)
+		}
+	}
+	if len(repo.collections) != 1 || !repo.collections[0].Favourites || repo.collections[0].Name != FavouritesName {
+		t.Fatalf("collections = %+v; want one favourites collection", repo.collections)
+	}
+	fav, err := s.Favourited(ctx, owner, []*domain.Quote{{ID: 1}, {ID: 2}})
+	if err != nil || fav[1] || !fav[2] {
+		t.Errorf("Favourited() = %v, %v; want only quote 2", fav, err)
+	}
+	if _, err := s.ToggleFavourite(ctx, owner, 9); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("ToggleFavourite(missing) error = %v; want ErrNotFound", err)
+	}
+	if _, err := s.ToggleFavourite(ctx, "", 1); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("ToggleFavourite without owner: error = %v; want ErrInvalid", err)
+	}
+}
+
+func TestCollectionOwnership(t *testing.T) {
+	s, _ := newCollectionService(t)
+	ctx := context.Background()
+
+	c, err := s.Create(ctx, "visitor:a", "  Exam   week ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "Exam week" {
+		t.Errorf("Name = %q; want spaces collapsed", c.Name)
+	}
+	if err := s.Add(ctx, "visitor:a", c.Slug, 1); err != nil {
+		t.Errorf("owner Add: %v", err)
+	}
+	for _, owner := range []string{"visitor:b", ""} {
+		if err := s.Add(ctx, owner, c.Slug, 2); !errors.Is(err, domain.ErrForbidden) {
+			t.Errorf("Add by %q: error = %v; want ErrForbidden", owner, err)
+		}
+	}
+	if err := s.Rename(ctx, "visitor:a", c.Slug, " "); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("Rename to blank: error = %v; want ErrInvalid", err)
+	}
+}
+
+func TestLinkAccount(t *testing.T) {
+	s, repo := newCollectionService(t)
+	ctx := context.Background()
+
+	if err := s.Link(ctx, "v1", 7); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := s.Owner(ctx, "v1"); owner != "user:7" {
+		t.Errorf("Owner() after linking = %q; want user:7", owner)
+	}
+	if err := s.Link(ctx, "v1", 7); err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"visitor:v1", "user:7"}}
+	if !slices.Equal(repo.transfers, want) {
+		t.Errorf("transfers = %v; want %v", repo.transfers, want)
+	}
+}
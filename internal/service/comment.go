@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/spam"
+)
+
+const (
+	// AnonymousAuthor is shown for comments posted without a name.
+	AnonymousAuthor = "anonymous"
+	maxAuthorLength = 32
+)
+
+// CommentSubmission is a comment as entered by someone. ParentID is the
+// comment it replies to, or zero.
+type CommentSubmission struct {
+	QuoteID   int
+	ParentID  int
+	Author    string
+	Body      string
+	IP        string
+	Challenge string
+	Nonce     string
+}
+
+// CommentService runs the discussion threads of quotes. Comments go through
+// the same kind of filter as quote submissions.
+type CommentService struct {
+	comments domain.CommentRepository
+	quotes   domain.QuoteRepository
+	filter   spam.Filter
+	ips      *privacy.Anonymizer
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+// NewCommentService returns a CommentService. The Listener in opts is not
+// used.
+func NewCommentService(comments domain.CommentRepository, quotes domain.QuoteRepository, opts Options) *CommentService {
+	s := &CommentService{
+		comments: comments,
+		quotes:   quotes,
+		filter:   opts.Filter,
+		ips:      opts.IPs,
+		logger:   opts.Logger,
+		now:      time.Now,
+	}
+	if s.logger == nil {
+		s.logger = slog.New(slog.DiscardHandler)
+	}
+	return s
+}
+
+// Post checks a comment and adds it to the discussion of its quote.
+// Rejections by the filter are returned as *spam.Rejection.
+func (s *CommentService) Post(ctx context.Context, sub CommentSubmission) (*domain.Comment, error) {
+	c := &domain.Comment{
+		QuoteID:  sub.QuoteID,
+		ParentID: sub.ParentID,
+		Author:   strings.TrimSpace(sub.Author),
+		Body:     normalise(sub.Body),
+		Date:     s.now(),
+	}
+	if c.Author == "" {
+		c.Author = AnonymousAuthor
+	}
+	if utf8.RuneCountInString(c.Author) > maxAuthorLength {
+		return nil, fmt.Errorf("name must be at most %d characters: %w", maxAuthorLength, domain.ErrInvalid)
+	}
+	if c.Body == "" {
+		return nil, fmt.Errorf("comment is empty: %w", domain.ErrInvalid)
+	}
+	if _, err := s.quotes.GetByID(ctx, c.QuoteID); err != nil {
+		return nil, err
+	}
+	if c.ParentID != 0 {
+		parent, err := s.comments.GetByID(ctx, c.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.QuoteID != c.QuoteID || parent.Hidden {
+			return nil, fmt.Errorf("cannot reply to comment %d: %w", c.ParentID, domain.ErrInvalid)
+		}
+	}
+
+	if s.ips != nil {
+		c.IP = s.ips.Anonymize(sub.IP)
+	}
+	check := &spam.Submission{
+		Quote:     c.Body,
+		IP:        c.IP,
+		Challenge: sub.Challenge,
+		Nonce:     sub.Nonce,
+	}
+	if s.filter != nil {
+		if err := screen(ctx, s.filter, check); err != nil {
+			if rej, ok := spam.AsRejection(err); ok {
+				s.logger.Warn("Comment rejected",
+					slog.Int("quote_id", c.QuoteID),
+					slog.String("code", string(rej.Code)),
+					slog.String("reason", rej.Reason),
+					slog.String("ip", c.IP),
+				)
+			}
+			return nil, err
+		}
+	}
+	if err := s.comments.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	stored(s.filter, check)
+	return c, nil
+}
+
+// Thread returns the discussion of a quote as a tree, oldest first on
+// every level. Unless moderator is set, hidden comments without replies are
+// left out and hidden comments with replies keep their place but lose
+// their author and text.
+func (s *CommentService) Thread(ctx context.Context, quoteID int, moderator bool) ([]*domain.Comment, error) {
+	comments, err := s.comments.ListByQuote(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*domain.Comment, len(comments))
+	for _, c := range comments {
+		byID[c.ID] = c
+	}
+	var roots []*domain.Comment
+	for _, c := range comments {
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	if moderator {
+		return roots, nil
+	}
+	return prune(roots), nil
+}
+
+// prune removes hidden comments that have no visible replies and blanks
+// the rest.
+func prune(comments []*domain.Comment) []*domain.Comment {
+	kept := comments[:0]
+	for _, c := range comments {
+		c.Replies = prune(c.Replies)
+		if c.Hidden {
+			if len(c.Replies) == 0 {
+				continue
+			}
+			c.Author, c.Body = "", ""
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// Counts returns the number of visible comments on each of the quotes.
+func (s *CommentService) Counts(ctx context.Context, quotes []*domain.Quote) (map[int]int, error) {
+	ids := make([]int, len(quotes))
+	for i, q := range quotes {
+		ids[i] = q.ID
+	}
+	return s.comments.CountVisible(ctx, ids)
+}
+
+// Recent returns the newest comments for moderation.
+func (s *CommentService) Recent(ctx context.Context, limit int) ([]*domain.Comment, error) {
+	return s.comments.Recent(ctx, limit)
+}
+
+// SetHidden hides a comment from visitors, or shows it again.
+func (s *CommentService) SetHidden(ctx context.Context, id int, hidden bool) error {
+	return s.comments.SetHidden(ctx, id, hidden)
+}
+
+// Delete removes a comment and all replies to it.
+func (s *CommentService) Delete(ctx context.Context, id int) error {
+	return s.comments.Delete(ctx, id)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/spam"
+)
+
+type fakeComments struct {
+	domain.CommentRepository
+	comments []*domain.Comment
+}
+
+func (f *fakeComments) Create(_ context.Context, c *domain.Comment) error {
+	c.ID = len(f.comments) + 1
+	f.comments = append(f.comments, c)
+	return nil
+}
+
+func (f *fakeComments) GetByID(_ context.Context, id int) (*domain.Comment, error) {
+	if id < 1 || id > len(f.comments) {
+		return nil, domain.ErrNotFound
+	}
+	return f.comments[id-1], nil
+}
+
+func (f *fakeComments) ListByQuote(_ context.Context, quoteID int) ([]*domain.Comment, error) {
+	var list []*domain.Comment
+	for _, c := range f.comments {
+		if c.QuoteID == quoteID {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func newCommentService(t *testing.T, opts Options) (*CommentService, *fakeComments) {
+	t.Helper()
+	quotes := newFakeRepo()
+	quotes.quotes[1] = &domain.Quote{ID: 1}
+	quotes.quotes[2] = &domain.Quote{ID: 2}
+	comments := &fakeComments{}
+	return NewCommentService(comments, quotes, opts), comments
+}
+
+func TestPostComment(t *testing.T) {
+	s, comments := newCommentService(t, Options{})
+	ctx := context.Background()
+
+	c, err := s.Post(ctx, CommentSubmission{QuoteID: 1, Body: "  I was there\r\n"})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if c.Author != AnonymousAuthor || c.Body != "I was there" || c.ID != 1 {
+		t.Errorf("comment = %+v", c)
+	}
+
+	tests := []struct {
+		name string
+		sub  CommentSubmission
+		want error
+	}{
+		{"empty", CommentSubmission{QuoteID: 1, Body: " \n "}, domain.ErrInvalid},
+		{"long name", CommentSubmission{QuoteID: 1, Body: "hi", Author: "a-very-long-nickname-that-nobody-uses"}, domain.ErrInvalid},
+		{"missing quote", CommentSubmission{QuoteID: 9, Body: "hi"}, domain.ErrNotFound},
+		{"missing parent", CommentSubmission{QuoteID: 1, ParentID: 9, Body: "hi"}, domain.ErrNotFound},
+		{"parent on other quote", CommentSubmission{QuoteID: 2, ParentID: 1, Body: "hi"}, domain.ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := s.Post(ctx, tt.sub); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Post error = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+
+	comments.comments[0].Hidden = true
+	if _, err := s.Post(ctx, CommentSubmission{QuoteID: 1, ParentID: 1, Body: "hi"}); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("reply to hidden comment: error = %v; want ErrInvalid", err)
+	}
+}
+
+func TestPostCommentRejected(t *testing.T) {
+	var checked *spam.Submission
+	filter := spam.FilterFunc(func(_ context.Context, sub *spam.Submission) error {
+		checked = sub
+		return &spam.Rejection{Code: spam.CodeBannedWord, Reason: "no"}
+	})
+	s, comments := newCommentService(t, Options{Filter: filter})
+
+	_, err := s.Post(context.Background(), CommentSubmission{QuoteID: 1, Body: "buy now", Challenge: "c", Nonce: "n"})
+	if _, ok := spam.AsRejection(err); !ok {
+		t.Fatalf("Post error = %v; want a rejection", err)
+	}
+	if checked.Quote != "buy now" || checked.Challenge != "c" || checked.Nonce != "n" {
+		t.Errorf("filter saw %+v", checked)
+	}
+	if len(comments.comments) != 0 {
+		t.Error("rejected comment was stored")
+	}
+}
+
+func TestThread(t *testing.T) {
+	s, comments := newCommentService(t, Options{})
+	comments.comments = []*domain.Comment{
+		{ID: 1, QuoteID: 1, Author: "a", Body: "root"},
+		{ID: 2, QuoteID: 1, ParentID: 1, Author: "b", Body: "reply"},
+		{ID: 3, QuoteID: 1, Author: "c", Body: "hidden root", Hidden: true},
+		{ID: 4, QuoteID: 1, ParentID: 3, Author: "d", Body: "reply to hidden"},
+		{ID: 5, QuoteID: 1, ParentID: 2, Author: "e", Body: "hidden leaf", Hidden: true},
+		{ID: 6, QuoteID: 2, Author: "f", Body: "other quote"},
+	}
+	ctx := context.Background()
+
+	thread, err := s.Thread(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread) != 2 || thread[0].ID != 1 || thread[1].ID != 3 {
+		t.Fatalf("roots = %+v", thread)
+	}
+	if r := thread[0].Replies; len(r) != 1 || r[0].ID != 2 || len(r[0].Replies) != 0 {
+		t.Errorf("hidden leaf not pruned: %+v", r)
+	}
+	if h := thread[1]; h.Body != "" || h.Author != "" || len(h.Replies) != 1 {
+		t.Errorf("hidden comment with replies = %+v; want blanked with its reply", h)
+	}
+
+	thread, err = s.Thread(ctx, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thread[1].Body != "hidden root" || len(thread[0].Replies[0].Replies) != 1 {
+		t.Error("moderator thread is missing hidden comments")
+	}
+}
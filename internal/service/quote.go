@@ -0,0 +1,395 @@
+// Package service holds the business rules around quotes, shared by the
+// web handlers and the command line.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hionay/quotes/internal/dedup"
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/spam"
+)
+
+// Vote is the direction of a vote on a quote.
+type Vote int
+
+const (
+	VoteUp Vote = iota + 1
+	VoteDown
+)
+
+// ParseVote parses "up" or "down".
+func ParseVote(s string) (Vote, error) {
+	switch s {
+	case "up":
+		return VoteUp, nil
+	case "down":
+		return VoteDown, nil
+	}
+	return 0, fmt.Errorf("vote %q: %w", s, domain.ErrInvalid)
+}
+
+// Listener is told about changes, for example to push them to open pages.
+type Listener interface {
+	QuoteAdded(*domain.Quote)
+	QuoteVoted(*domain.Quote)
+}
+
+// maxDuplicatesShown is how many of the quotes a submission looks like are
+// reported.
+const maxDuplicatesShown = 3
+
+// Submission is a quote as entered by someone. IP is the submitter's raw
+// address; only its anonymised form is kept.
+type Submission struct {
+	Quote     string
+	Comment   string
+	IP        string
+	Challenge string
+	Nonce     string
+	// AllowDuplicate adds the quote even if it looks like one that is
+	// already in the archive.
+	AllowDuplicate bool
+}
+
+// DuplicateError is returned for a submission that looks like quotes that
+// are already in the archive.
+type DuplicateError struct {
+	Quotes []*domain.Quote
+}
+
+func (e *DuplicateError) Error() string {
+	ids := make([]string, len(e.Quotes))
+	for i, q := range e.Quotes {
+		ids[i] = "#" + strconv.Itoa(q.ID)
+	}
+	if len(ids) == 1 {
+		return "this looks like quote " + ids[0] + ", which is already here"
+	}
+	return "this looks like quotes " + strings.Join(ids, ", ") + ", which are already here"
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return domain.ErrConflict
+}
+
+// Options holds the optional collaborators of a QuoteService.
+type Options struct {
+	// Filter checks submissions; nil accepts everything, as the command
+	// line does.
+	Filter spam.Filter
+	// IPs anonymises submitter addresses; nil stores none.
+	IPs *privacy.Anonymizer
+	// Duplicates finds the quotes a submission looks like and indexes new
+	// quotes; nil does neither.
+	Duplicates *dedup.Index
+	// Location is the time zone of the day OnThisDay lists; nil is UTC.
+	Location *time.Location
+	Listener Listener
+	Logger   *slog.Logger
+}
+
+// QuoteService validates, normalises and stores quotes and votes, and tells
+// its Listener about every change.
+type QuoteService struct {
+	repo       domain.QuoteRepository
+	filter     spam.Filter
+	ips        *privacy.Anonymizer
+	duplicates *dedup.Index
+	listener   Listener
+	logger     *slog.Logger
+	loc        *time.Location
+	now        func() time.Time
+}
+
+func NewQuoteService(repo domain.QuoteRepository, opts Options) *QuoteService {
+	s := &QuoteService{
+		repo:       repo,
+		filter:     opts.Filter,
+		ips:        opts.IPs,
+		duplicates: opts.Duplicates,
+		listener:   opts.Listener,
+		logger:     opts.Logger,
+		loc:        opts.Location,
+		now:        time.Now,
+	}
+	if s.logger == nil {
+		s.logger = slog.New(slog.DiscardHandler)
+	}
+	if s.loc == nil {
+		s.loc = time.UTC
+	}
+	return s
+}
+
+// Add checks a submission and stores it as a new quote. Near-duplicates of
+// quotes in the archive are returned as *DuplicateError unless the
+// submission allows them, and rejections by the filter as *spam.Rejection.
+// The filter only records submissions that pass everything and only learns
+// from the quotes stored.
+func (s *QuoteService) Add(ctx context.Context, sub Submission) (*domain.Quote, error) {
+	check := &spam.Submission{
+		Quote:     normalise(sub.Quote),
+		Comment:   normalise(sub.Comment),
+		Challenge: sub.Challenge,
+		Nonce:     sub.Nonce,
+	}
+	if s.ips != nil {
+		check.IP = s.ips.Anonymize(sub.IP)
+	}
+	if check.Quote == "" {
+		return nil, fmt.Errorf("quote is empty: %w", domain.ErrInvalid)
+	}
+	if s.duplicates != nil && !sub.AllowDuplicate {
+		if err := s.checkDuplicates(ctx, check.Quote); err != nil {
+			return nil, err
+		}
+	}
+	if s.filter != nil {
+		if err := screen(ctx, s.filter, check); err != nil {
+			if rej, ok := spam.AsRejection(err); ok {
+				s.logger.Warn("Submission rejected",
+					slog.String("code", string(rej.Code)),
+					slog.String("reason", rej.Reason),
+					slog.String("ip", check.IP),
+				)
+			}
+			return nil, err
+		}
+	}
+
+	q := &domain.Quote{
+		Quote:   check.Quote,
+		Comment: check.Comment,
+		Date:    s.now(),
+		IP:      check.IP,
+	}
+	if err := s.repo.Create(ctx, q); err != nil {
+		return nil, err
+	}
+	stored(s.filter, check)
+	if s.duplicates != nil {
+		if err := s.duplicates.Add(ctx, q); err != nil {
+			s.logger.Warn("Failed to index quote", slog.Int("id", q.ID), slog.Any("err", err))
+		}
+	}
+	if s.listener != nil {
+		s.listener.QuoteAdded(q)
+	}
+	return q, nil
+}
+
+func (s *QuoteService) checkDuplicates(ctx context.Context, text string) error {
+	ids, err := s.duplicates.Near(ctx, text)
+	if err != nil {
+		return err
+	}
+	quotes, err := s.getByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	dup := &DuplicateError{}
+	for _, id := range ids {
+		q, ok := quotes[id]
+		if !ok {
+			continue
+		}
+		if dup.Quotes = append(dup.Quotes, q); len(dup.Quotes) == maxDuplicatesShown {
+			break
+		}
+	}
+	if len(dup.Quotes) > 0 {
+		return dup
+	}
+	return nil
+}
+
+// Vote records a vote and returns the quote with its new counts.
+func (s *QuoteService) Vote(ctx context.Context, id int, v Vote) (*domain.Quote, error) {
+	var err error
+	switch v {
+	case VoteUp:
+		err = s.repo.LikeQuote(ctx, id)
+	case VoteDown:
+		err = s.repo.DislikeQuote(ctx, id)
+	default:
+		err = fmt.Errorf("vote %d: %w", v, domain.ErrInvalid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.listener != nil {
+		s.listener.QuoteVoted(q)
+	}
+	return q, nil
+}
+
+func (s *QuoteService) Get(ctx context.Context, id int) (*domain.Quote, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *QuoteService) Delete(ctx context.Context, id int) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// Redirect returns the quote that the quote with an ID was merged into.
+func (s *QuoteService) Redirect(ctx context.Context, id int) (int, error) {
+	return s.repo.GetRedirect(ctx, id)
+}
+
+// Duplicates returns the groups of near-duplicate quotes in the archive,
+// each sorted by ID.
+func (s *QuoteService) Duplicates(ctx context.Context) ([][]*domain.Quote, error) {
+	if s.duplicates == nil {
+		return nil, nil
+	}
+	clusters, err := s.duplicates.Clusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := s.getByIDs(ctx, slices.Concat(clusters...))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([][]*domain.Quote, 0, len(clusters))
+	for _, ids := range clusters {
+		group := make([]*domain.Quote, 0, len(ids))
+		for _, id := range ids {
+			if q, ok := quotes[id]; ok {
+				group = append(group, q)
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// Merge folds the quotes with the given IDs into the one with ID keep,
+// which gets their likes, votes, comments and reactions, and returns it.
+// The merged IDs redirect to it from then on.
+func (s *QuoteService) Merge(ctx context.Context, keep int, ids []int) (*domain.Quote, error) {
+	var dups []int
+	for _, id := range ids {
+		if id != keep && !slices.Contains(dups, id) {
+			dups = append(dups, id)
+		}
+	}
+	quotes, err := s.getByIDs(ctx, append([]int{keep}, dups...))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range append([]int{keep}, dups...) {
+		if _, ok := quotes[id]; !ok {
+			return nil, fmt.Errorf("quote %d: %w", id, domain.ErrNotFound)
+		}
+	}
+	if len(dups) == 0 {
+		return nil, fmt.Errorf("no other quotes to merge into %d: %w", keep, domain.ErrInvalid)
+	}
+	if err := s.repo.Merge(ctx, keep, dups); err != nil {
+		return nil, err
+	}
+	q, err := s.repo.GetByID(ctx, keep)
+	if err != nil {
+		return nil, err
+	}
+	if s.listener != nil {
+		s.listener.QuoteVoted(q)
+	}
+	return q, nil
+}
+
+// getByIDs fetches the quotes with the given IDs in one query, by ID.
+// Missing quotes are left out.
+func (s *QuoteService) getByIDs(ctx context.Context, ids []int) (map[int]*domain.Quote, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	list, err := s.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	quotes := make(map[int]*domain.Quote, len(list))
+	for _, q := range list {
+		quotes[q.ID] = q
+	}
+	return quotes, nil
+}
+
+func (s *QuoteService) Latest(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return s.repo.GetLatest(ctx, cursor, limit)
+}
+
+func (s *QuoteService) Top(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return s.repo.GetTop(ctx, cursor, limit)
+}
+
+// OnThisDay lists quotes submitted on today's date, in the service's time
+// zone, in earlier years.
+func (s *QuoteService) OnThisDay(ctx context.Context, cursor string, limit int) (*domain.Page, error) {
+	return s.repo.GetOnThisDay(ctx, s.now().In(s.loc), cursor, limit)
+}
+
+// Month lists the quotes submitted in a calendar month.
+func (s *QuoteService) Month(ctx context.Context, year int, month time.Month, cursor string, limit int) (*domain.Page, error) {
+	from := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return s.repo.GetByPeriod(ctx, from, from.AddDate(0, 1, 0), cursor, limit)
+}
+
+func (s *QuoteService) CountByYear(ctx context.Context) ([]domain.PeriodCount, error) {
+	return s.repo.CountByYear(ctx)
+}
+
+func (s *QuoteService) CountByMonth(ctx context.Context, year int) ([]domain.PeriodCount, error) {
+	return s.repo.CountByMonth(ctx, year)
+}
+
+// Random picks a quote matching f. When the excluded quotes are all that
+// match, they are allowed again rather than showing nothing.
+func (s *QuoteService) Random(ctx context.Context, f domain.RandomFilter) (*domain.Quote, error) {
+	q, err := s.repo.GetRandom(ctx, f)
+	if errors.Is(err, domain.ErrNotFound) && len(f.ExcludeIDs) > 0 {
+		f.ExcludeIDs = nil
+		q, err = s.repo.GetRandom(ctx, f)
+	}
+	return q, err
+}
+
+// screen checks a submission with filter and, if it passes, lets the
+// filter record it.
+func screen(ctx context.Context, filter spam.Filter, sub *spam.Submission) error {
+	if err := filter.Check(ctx, sub); err != nil {
+		return err
+	}
+	if a, ok := filter.(spam.Accepter); ok {
+		return a.Accept(ctx, sub)
+	}
+	return nil
+}
+
+// stored tells filter, if set, that a submission it passed was stored.
+func stored(filter spam.Filter, sub *spam.Submission) {
+	if l, ok := filter.(spam.Learner); ok {
+		l.Stored(sub)
+	}
+}
+
+// normalise trims a submitted text and unifies its line endings.
+func normalise(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.TrimSpace(s)
+}
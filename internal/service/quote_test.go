@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/dedup"
+	"github.com/hionay/quotes/internal/domain"
+	"github.com/hionay/quotes/internal/privacy"
+	"github.com/hionay/quotes/internal/spam"
+)
+
+type fakeRepo struct {
+	domain.QuoteRepository
+	quotes  map[int]*domain.Quote
+	created []*domain.Quote
+	merged  [][]int
+	// lookups counts the calls to GetByIDs.
+	lookups int
+	random  func(domain.RandomFilter) (*domain.Quote, error)
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{quotes: map[int]*domain.Quote{}}
+}
+
+func (f *fakeRepo) Create(_ context.Context, q *domain.Quote) error {
+	q.ID = len(f.quotes) + 1
+	f.quotes[q.ID] = q
+	f.created = append(f.created, q)
+	return nil
+}
+
+func (f *fakeRepo) GetByID(_ context.Context, id int) (*domain.Quote, error) {
+	q, ok := f.quotes[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	c := *q
+	return &c, nil
+}
+
+func (f *fakeRepo) GetByIDs(ctx context.Context, ids []int) ([]*domain.Quote, error) {
+	f.lookups++
+	var list []*domain.Quote
+	for _, id := range ids {
+		if q, err := f.GetByID(ctx, id); err == nil {
+			list = append(list, q)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeRepo) vote(id, likes int) error {
+	q, ok := f.quotes[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	q.Likes += likes
+	q.Votes++
+	return nil
+}
+
+func (f *fakeRepo) LikeQuote(_ context.Context, id int) error    { return f.vote(id, 1) }
+func (f *fakeRepo) DislikeQuote(_ context.Context, id int) error { return f.vote(id, -1) }
+
+func (f *fakeRepo) GetRandom(_ context.Context, rf domain.RandomFilter) (*domain.Quote, error) {
+	return f.random(rf)
+}
+
+func (f *fakeRepo) Merge(_ context.Context, keep int, dups []int) error {
+	f.merged = append(f.merged, append([]int{keep}, dups...))
+	for _, id := range dups {
+		f.quotes[keep].Likes += f.quotes[id].Likes
+		f.quotes[keep].Votes += f.quotes[id].Votes
+		delete(f.quotes, id)
+	}
+	return nil
+}
+
+func (f *fakeRepo) Each(_ context.Context, fn func(*domain.Quote) error) error {
+	for _, q := range f.quotes {
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fakeFingerprints keeps fingerprints in memory.
+type fakeFingerprints map[int]uint64
+
+func (f fakeFingerprints) Put(_ context.Context, id int, fp uint64) error {
+	f[id] = fp
+	return nil
+}
+
+func (f fakeFingerprints) Near(_ context.Context, fp uint64, distance int) ([]int, error) {
+	var ids []int
+	for id, other := range f {
+		if dedup.Distance(fp, other) <= distance {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (f fakeFingerprints) All(context.Context) (map[int]uint64, error) {
+	return maps.Clone(f), nil
+}
+
+type recorder struct {
+	added, voted []*domain.Quote
+}
+
+func (r *recorder) QuoteAdded(q *domain.Quote) { r.added = append(r.added, q) }
+func (r *recorder) QuoteVoted(q *domain.Quote) { r.voted = append(r.voted, q) }
+
+func TestAdd(t *testing.T) {
+	repo := newFakeRepo()
+	ips, err := privacy.NewAnonymizer(privacy.ModeTruncate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	s := NewQuoteService(repo, Options{IPs: ips, Listener: rec})
+	now := time.Date(2006, time.May, 4, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	q, err := s.Add(context.Background(), Submission{
+		Quote:   "  <a> hi\r\n<b> hello\n",
+		Comment: "first\r\nsecond",
+		IP:      "192.0.2.33",
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if q.Quote != "<a> hi\n<b> hello" {
+		t.Errorf("Quote = %q", q.Quote)
+	}
+	if q.Comment != "first\nsecond" {
+		t.Errorf("Comment = %q", q.Comment)
+	}
+	if !q.Date.Equal(now) {
+		t.Errorf("Date = %v; want %v", q.Date, now)
+	}
+	if q.IP != "192.0.2.0/24" {
+		t.Errorf("IP = %q; want the truncated address", q.IP)
+	}
+	if q.ID == 0 || len(rec.added) != 1 || rec.added[0] != q {
+		t.Errorf("listener not told about quote %d", q.ID)
+	}
+}
+
+func TestAddRejected(t *testing.T) {
+	repo := newFakeRepo()
+	rejectAll := spam.FilterFunc(func(context.Context, *spam.Submission) error {
+		return &spam.Rejection{Code: spam.CodeBannedWord, Reason: "no"}
+	})
+	rec := &recorder{}
+	s := NewQuoteService(repo, Options{Filter: rejectAll, Listener: rec})
+
+	_, err := s.Add(context.Background(), Submission{Quote: "buy now"})
+	if _, ok := spam.AsRejection(err); !ok {
+		t.Fatalf("Add error = %v; want a rejection", err)
+	}
+	if len(repo.created) != 0 || len(rec.added) != 0 {
+		t.Error("rejected submission was stored")
+	}
+
+	s = NewQuoteService(repo, Options{})
+	if _, err := s.Add(context.Background(), Submission{Quote: " \r\n "}); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("empty quote error = %v; want ErrInvalid", err)
+	}
+}
+
+func TestAddDuplicate(t *testing.T) {
+	repo := newFakeRepo()
+	fingerprints := fakeFingerprints{}
+	s := NewQuoteService(repo, Options{Duplicates: dedup.NewIndex(fingerprints, repo)})
+	ctx := context.Background()
+
+	first, err := s.Add(ctx, Submission{Quote: "<a> is it plugged in?\n<b> ...brb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fingerprints[first.ID]; !ok {
+		t.Error("new quote was not indexed")
+	}
+
+	_, err = s.Add(ctx, Submission{Quote: "[10:02] <a> Is it plugged in\n[10:03] <b> brb"})
+	var dup *DuplicateError
+	if !errors.As(err, &dup) || !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("Add(copy) error = %v; want a DuplicateError", err)
+	}
+	if len(dup.Quotes) != 1 || dup.Quotes[0].ID != first.ID {
+		t.Errorf("DuplicateError.Quotes = %v; want quote %d", dup.Quotes, first.ID)
+	}
+
+	if _, err := s.Add(ctx, Submission{Quote: "<a> is it plugged in?\n<b> ...brb", AllowDuplicate: true}); err != nil {
+		t.Errorf("Add(copy, AllowDuplicate) error = %v", err)
+	}
+	if len(repo.created) != 2 {
+		t.Errorf("stored %d quotes; want 2", len(repo.created))
+	}
+}
+
+// trackingFilter passes everything and records what it was told.
+type trackingFilter struct {
+	checked, accepted, stored []string
+}
+
+func (f *trackingFilter) Check(_ context.Context, sub *spam.Submission) error {
+	f.checked = append(f.checked, sub.Quote)
+	return nil
+}
+
+func (f *trackingFilter) Accept(_ context.Context, sub *spam.Submission) error {
+	f.accepted = append(f.accepted, sub.Quote)
+	return nil
+}
+
+func (f *trackingFilter) Stored(sub *spam.Submission) {
+	f.stored = append(f.stored, sub.Quote)
+}
+
+func TestAddFiltersOnlyValidSubmissions(t *testing.T) {
+	repo := newFakeRepo()
+	filter := &trackingFilter{}
+	s := NewQuoteService(repo, Options{Filter: filter, Duplicates: dedup.NewIndex(fakeFingerprints{}, repo)})
+	ctx := context.Background()
+
+	if _, err := s.Add(ctx, Submission{Quote: "<a> is it plugged in?"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(ctx, Submission{Quote: " "}); !errors.Is(err, domain.ErrInvalid) {
+		t.Fatalf("Add(empty) error = %v; want ErrInvalid", err)
+	}
+	var dup *DuplicateError
+	if _, err := s.Add(ctx, Submission{Quote: "<a> Is it plugged in"}); !errors.As(err, &dup) {
+		t.Fatalf("Add(copy) error = %v; want a DuplicateError", err)
+	}
+	want := []string{"<a> is it plugged in?"}
+	if !slices.Equal(filter.checked, want) || !slices.Equal(filter.accepted, want) || !slices.Equal(filter.stored, want) {
+		t.Errorf("filter checked %q, accepted %q, stored %q; want only the stored quote", filter.checked, filter.accepted, filter.stored)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	repo := newFakeRepo()
+	repo.quotes[1] = &domain.Quote{ID: 1, Likes: 3, Votes: 5}
+	repo.quotes[2] = &domain.Quote{ID: 2, Likes: 1, Votes: 1}
+	repo.quotes[3] = &domain.Quote{ID: 3, Likes: -1, Votes: 2}
+	rec := &recorder{}
+	s := NewQuoteService(repo, Options{Listener: rec})
+	ctx := context.Background()
+
+	if _, err := s.Merge(ctx, 1, []int{1}); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("Merge into itself: error = %v; want ErrInvalid", err)
+	}
+	if _, err := s.Merge(ctx, 1, []int{2, 9}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Merge of a missing quote: error = %v; want ErrNotFound", err)
+	}
+	if len(repo.merged) != 0 {
+		t.Fatalf("merged %v after failed checks", repo.merged)
+	}
+
+	repo.lookups = 0
+	q, err := s.Merge(ctx, 1, []int{1, 3, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.lookups != 1 {
+		t.Errorf("looked quotes up %d times; want them fetched together", repo.lookups)
+	}
+	if want := [][]int{{1, 3, 2}}; !slices.EqualFunc(repo.merged, want, slices.Equal) {
+		t.Errorf("merged %v; want %v", repo.merged, want)
+	}
+	if q.Likes != 3 || q.Votes != 8 {
+		t.Errorf("merged quote has %d likes from %d votes; want 3 from 8", q.Likes, q.Votes)
+	}
+	if len(rec.voted) != 1 || rec.voted[0].ID != 1 {
+		t.Error("listener not told about the merged quote")
+	}
+}
+
+func TestVote(t *testing.T) {
+	repo := newFakeRepo()
+	repo.quotes[1] = &domain.Quote{ID: 1, Likes: 5, Votes: 5}
+	rec := &recorder{}
+	s := NewQuoteService(repo, Options{Listener: rec})
+	ctx := context.Background()
+
+	q, err := s.Vote(ctx, 1, VoteUp)
+	if err != nil || q.Likes != 6 {
+		t.Fatalf("Vote up = %+v, %v; want 6 likes", q, err)
+	}
+	q, err = s.Vote(ctx, 1, VoteDown)
+	if err != nil || q.Likes != 5 || q.Votes != 7 {
+		t.Fatalf("Vote down = %+v, %v; want 5 likes and 7 votes", q, err)
+	}
+	if len(rec.voted) != 2 {
+		t.Errorf("listener told about %d votes; want 2", len(rec.voted))
+	}
+
+	if _, err := s.Vote(ctx, 2, VoteUp); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Vote on missing quote = %v; want ErrNotFound", err)
+	}
+	if _, err := s.Vote(ctx, 1, 0); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("Vote 0 = %v; want ErrInvalid", err)
+	}
+	if len(rec.voted) != 2 {
+		t.Error("listener told about a failed vote")
+	}
+}
+
+func TestRandomAllowsExcludedWhenNothingElse(t *testing.T) {
+	repo := newFakeRepo()
+	var calls []domain.RandomFilter
+	repo.random = func(f domain.RandomFilter) (*domain.Quote, error) {
+		calls = append(calls, f)
+		if len(f.ExcludeIDs) > 0 {
+			return nil, domain.ErrNotFound
+		}
+		return &domain.Quote{ID: 3}, nil
+	}
+	s := NewQuoteService(repo, Options{})
+
+	q, err := s.Random(context.Background(), domain.RandomFilter{ExcludeIDs: []int{3}})
+	if err != nil || q.ID != 3 {
+		t.Fatalf("Random = %+v, %v; want quote 3", q, err)
+	}
+	if len(calls) != 2 {
+		t.Errorf("GetRandom called %d times; want 2", len(calls))
+	}
+}
+
+func TestParseVote(t *testing.T) {
+	for in, want := range map[string]Vote{"up": VoteUp, "down": VoteDown} {
+		if got, err := ParseVote(in); err != nil || got != want {
+			t.Errorf("ParseVote(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseVote("sideways"); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("ParseVote(sideways) = %v; want ErrInvalid", err)
+	}
+}
+
+type onThisDayRepo struct {
+	domain.QuoteRepository
+	day time.Time
+}
+
+func (r *onThisDayRepo) GetOnThisDay(_ context.Context, day time.Time, _ string, _ int) (*domain.Page, error) {
+	r.day = day
+	return &domain.Page{}, nil
+}
+
+func TestOnThisDayInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Skip(err)
+	}
+	repo := &onThisDayRepo{}
+	s := NewQuoteService(repo, Options{Location: loc})
+	s.now = func() time.Time { return time.Date(2026, time.March, 5, 12, 0, 0, 0, time.UTC) }
+	if _, err := s.OnThisDay(context.Background(), "", 10); err != nil {
+		t.Fatal(err)
+	}
+	if repo.day.Location() != loc || repo.day.Day() != 6 {
+		t.Errorf("OnThisDay asked for %v; want 6 March in Auckland", repo.day)
+	}
+}
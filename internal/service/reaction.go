@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+// ParseReactions parses configured reactions, each given as "name:emoji".
+func ParseReactions(list []string) ([]domain.Reaction, error) {
+	reactions := make([]domain.Reaction, 0, len(list))
+	for _, s := range list {
+		name, emoji, ok := strings.Cut(s, ":")
+		if !ok || name == "" || emoji == "" {
+			return nil, fmt.Errorf("reaction %q: want name:emoji: %w", s, domain.ErrInvalid)
+		}
+		reactions = append(reactions, domain.Reaction{Name: name, Emoji: emoji})
+	}
+	return reactions, nil
+}
+
+// Tally is how many visitors gave a reaction to a quote, and whether the
+// current visitor is one of them.
+type Tally struct {
+	domain.Reaction
+	Count int
+	Mine  bool
+}
+
+// ReactionService keeps the emoji reactions of visitors, at most one of
+// each kind per visitor and quote. They are separate from up and down
+// votes, which still make up the likes score.
+type ReactionService struct {
+	reactions domain.ReactionRepository
+	quotes    domain.QuoteRepository
+	available []domain.Reaction
+}
+
+// NewReactionService returns a ReactionService offering the given
+// reactions, in that order.
+func NewReactionService(reactions domain.ReactionRepository, quotes domain.QuoteRepository, available []domain.Reaction) *ReactionService {
+	return &ReactionService{reactions: reactions, quotes: quotes, available: available}
+}
+
+// Available returns the reactions visitors can give.
+func (s *ReactionService) Available() []domain.Reaction {
+	return s.available
+}
+
+// Lookup returns the reaction with the given name.
+func (s *ReactionService) Lookup(name string) (domain.Reaction, error) {
+	i := slices.IndexFunc(s.available, func(r domain.Reaction) bool { return r.Name == name })
+	if i < 0 {
+		return domain.Reaction{}, fmt.Errorf("reaction %q: %w", name, domain.ErrNotFound)
+	}
+	return s.available[i], nil
+}
+
+// Toggle gives a reaction of visitor to a quote, or takes it back if it
+// was already given. It returns the quote.
+func (s *ReactionService) Toggle(ctx context.Context, quoteID int, visitor, name string) (*domain.Quote, error) {
+	if _, err := s.Lookup(name); err != nil {
+		return nil, fmt.Errorf("reaction %q: %w", name, domain.ErrInvalid)
+	}
+	if visitor == "" {
+		return nil, fmt.Errorf("reacting needs a visitor: %w", domain.ErrInvalid)
+	}
+	q, err := s.quotes.GetByID(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.reactions.Toggle(ctx, quoteID, visitor, name); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Tallies returns the available reactions of each quote with their counts,
+// marking those visitor gave. visitor may be empty.
+func (s *ReactionService) Tallies(ctx context.Context, quotes []*domain.Quote, visitor string) (map[int][]Tally, error) {
+	ids := make([]int, len(quotes))
+	for i, q := range quotes {
+		ids[i] = q.ID
+	}
+	counts, err := s.reactions.Counts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mine, err := s.reactions.ByVisitor(ctx, ids, visitor)
+	if err != nil {
+		return nil, err
+	}
+	tallies := make(map[int][]Tally, len(ids))
+	for _, id := range ids {
+		t := make([]Tally, len(s.available))
+		for i, r := range s.available {
+			t[i] = Tally{
+				Reaction: r,
+				Count:    counts[id][r.Name],
+				Mine:     slices.Contains(mine[id], r.Name),
+			}
+		}
+		tallies[id] = t
+	}
+	return tallies, nil
+}
+
+// Top lists the quotes most visitors gave a reaction, for example the
+// funniest ones.
+func (s *ReactionService) Top(ctx context.Context, name, cursor string, limit int) (*domain.Page, error) {
+	if _, err := s.Lookup(name); err != nil {
+		return nil, err
+	}
+	return s.reactions.GetTop(ctx, name, cursor, limit)
+}
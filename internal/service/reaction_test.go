@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+type fakeReactions struct {
+	domain.ReactionRepository
+	given map[int]map[string][]string // quote -> reaction -> visitors
+}
+
+func (f *fakeReactions) Toggle(_ context.Context, quoteID int, visitor, reaction string) (bool, error) {
+	if f.given == nil {
+		f.given = map[int]map[string][]string{}
+	}
+	if f.given[quoteID] == nil {
+		f.given[quoteID] = map[string][]string{}
+	}
+	visitors := f.given[quoteID][reaction]
+	if i := slices.Index(visitors, visitor); i >= 0 {
+		f.given[quoteID][reaction] = slices.Delete(visitors, i, i+1)
+		return false, nil
+	}
+	f.given[quoteID][reaction] = append(visitors, visitor)
+	return true, nil
+}
+
+func (f *fakeReactions) Counts(_ context.Context, ids []int) (map[int]map[string]int, error) {
+	counts := map[int]map[string]int{}
+	for _, id := range ids {
+		for reaction, visitors := range f.given[id] {
+			if counts[id] == nil {
+				counts[id] = map[string]int{}
+			}
+			counts[id][reaction] = len(visitors)
+		}
+	}
+	return counts, nil
+}
+
+func (f *fakeReactions) ByVisitor(_ context.Context, ids []int, visitor string) (map[int][]string, error) {
+	mine := map[int][]string{}
+	for _, id := range ids {
+		for reaction, visitors := range f.given[id] {
+			if slices.Contains(visitors, visitor) {
+				mine[id] = append(mine[id], reaction)
+			}
+		}
+	}
+	return mine, nil
+}
+
+var testReactions = []domain.Reaction{{Name: "funny", Emoji: "😂"}, {Name: "love", Emoji: "❤️"}}
+
+func TestParseReactions(t *testing.T) {
+	got, err := ParseReactions([]string{"funny:😂", "love:❤️"})
+	if err != nil || !slices.Equal(got, testReactions) {
+		t.Errorf("ParseReactions() = %v, %v; want %v", got, err, testReactions)
+	}
+	for _, bad := range []string{"funny", ":😂", "funny:"} {
+		if _, err := ParseReactions([]string{bad}); !errors.Is(err, domain.ErrInvalid) {
+			t.Errorf("ParseReactions(%q) error = %v; want ErrInvalid", bad, err)
+		}
+	}
+}
+
+func TestToggleReaction(t *testing.T) {
+	quotes := newFakeRepo()
+	quotes.quotes[1] = &domain.Quote{ID: 1}
+	s := NewReactionService(&fakeReactions{}, quotes, testReactions)
+	ctx := context.Background()
+
+	for _, visitor := range []string{"a", "b", "a", "a"} {
+		if _, err := s.Toggle(ctx, 1, visitor, "funny"); err != nil {
+			t.Fatalf("Toggle: %v", err)
+		}
+	}
+	tallies, err := s.Tallies(ctx, []*domain.Quote{{ID: 1}}, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Tally{{Reaction: testReactions[0], Count: 2, Mine: true}, {Reaction: testReactions[1]}}
+	if !slices.Equal(tallies[1], want) {
+		t.Errorf("Tallies() = %+v; want %+v", tallies[1], want)
+	}
+
+	tests := []struct {
+		name     string
+		quoteID  int
+		visitor  string
+		reaction string
+		want     error
+	}{
+		{"unknown reaction", 1, "a", "sad", domain.ErrInvalid},
+		{"no visitor", 1, "", "funny", domain.ErrInvalid},
+		{"missing quote", 2, "a", "funny", domain.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.Toggle(ctx, tt.quoteID, tt.visitor, tt.reaction); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Toggle error = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := s.Top(ctx, "sad", "", 10); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Top(unknown) error = %v; want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,140 @@
+package spam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Classifier is a naive Bayes text classifier trained from the submissions
+// the other filters reject (spam) and accept (ham). It does not reject
+// anything until it has seen minDocs examples of each class. Training only
+// changes the model in memory; Save writes it to disk.
+type Classifier struct {
+	mu      sync.Mutex
+	path    string
+	minDocs int
+	model   bayesModel
+	// dirty is set when the model has changed since it was last saved.
+	dirty bool
+}
+
+type bayesModel struct {
+	SpamDocs   int            `json:"spam_docs"`
+	HamDocs    int            `json:"ham_docs"`
+	SpamTokens map[string]int `json:"spam_tokens"`
+	HamTokens  map[string]int `json:"ham_tokens"`
+	SpamTotal  int            `json:"spam_total"`
+	HamTotal   int            `json:"ham_total"`
+}
+
+// NewClassifier returns a classifier persisted at path. An empty path keeps
+// the model in memory only; a missing file starts an empty model.
+func NewClassifier(path string, minDocs int) (*Classifier, error) {
+	c := &Classifier{
+		path:    path,
+		minDocs: minDocs,
+		model: bayesModel{
+			SpamTokens: map[string]int{},
+			HamTokens:  map[string]int{},
+		},
+	}
+	if path == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile(%q): %w", path, err)
+	}
+	if err := json.Unmarshal(b, &c.model); err != nil {
+		return nil, fmt.Errorf("decoding classifier model %q: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Classifier) Train(text string, spam bool) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts, total, docs := c.model.HamTokens, &c.model.HamTotal, &c.model.HamDocs
+	if spam {
+		counts, total, docs = c.model.SpamTokens, &c.model.SpamTotal, &c.model.SpamDocs
+	}
+	for _, t := range tokens {
+		counts[t]++
+	}
+	*total += len(tokens)
+	*docs++
+	c.dirty = true
+}
+
+// SpamProbability returns P(spam | text), or 0 while the model is still
+// undertrained.
+func (c *Classifier) SpamProbability(text string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := &c.model
+	if m.SpamDocs < c.minDocs || m.HamDocs < c.minDocs {
+		return 0
+	}
+	vocab := float64(len(m.SpamTokens) + len(m.HamTokens))
+	spamLog := math.Log(float64(m.SpamDocs) / float64(m.SpamDocs+m.HamDocs))
+	hamLog := math.Log(float64(m.HamDocs) / float64(m.SpamDocs+m.HamDocs))
+	for _, t := range tokenize(text) {
+		spamLog += math.Log((float64(m.SpamTokens[t]) + 1) / (float64(m.SpamTotal) + vocab))
+		hamLog += math.Log((float64(m.HamTokens[t]) + 1) / (float64(m.HamTotal) + vocab))
+	}
+	return 1 / (1 + math.Exp(hamLog-spamLog))
+}
+
+// Filter rejects submissions the classifier scores at or above threshold.
+func (c *Classifier) Filter(threshold float64) Filter {
+	return FilterFunc(func(_ context.Context, s *Submission) error {
+		if c.SpamProbability(s.Text()) >= threshold {
+			return &Rejection{Code: CodeClassifier, Reason: "quote looks like spam", Spam: true}
+		}
+		return nil
+	})
+}
+
+// Save writes the model next to its final path and renames it into place,
+// if it has changed since it was last saved. Without a path it does
+// nothing: the in-memory model is authoritative.
+func (c *Classifier) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+	b, err := json.Marshal(&c.model)
+	if err != nil {
+		return fmt.Errorf("encoding classifier model: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".spam-model-*")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp(): %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing classifier model: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing classifier model: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("os.Rename(%q): %w", c.path, err)
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,158 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LengthFilter rejects quotes that are empty or longer than max runes. The
+// comment only counts towards the upper limit.
+func LengthFilter(minLen, maxLen int) Filter {
+	return FilterFunc(func(_ context.Context, s *Submission) error {
+		n := utf8.RuneCountInString(strings.TrimSpace(s.Quote))
+		if n < minLen {
+			return &Rejection{Code: CodeTooShort, Reason: fmt.Sprintf("quote must be at least %d characters", minLen)}
+		}
+		if n+utf8.RuneCountInString(s.Comment) > maxLen {
+			return &Rejection{Code: CodeTooLong, Reason: fmt.Sprintf("quote must be at most %d characters", maxLen)}
+		}
+		return nil
+	})
+}
+
+// CommentLengthFilter rejects discussion comments longer than max runes.
+// The text of a comment is carried in Submission.Quote.
+func CommentLengthFilter(maxLen int) Filter {
+	return FilterFunc(func(_ context.Context, s *Submission) error {
+		if utf8.RuneCountInString(s.Quote) > maxLen {
+			return &Rejection{Code: CodeTooLong, Reason: fmt.Sprintf("comment must be at most %d characters", maxLen)}
+		}
+		return nil
+	})
+}
+
+// LinkFilter rejects submissions with more than maxLinks URLs, or that
+// consist of nothing but links.
+func LinkFilter(maxLinks int) Filter {
+	return FilterFunc(func(_ context.Context, s *Submission) error {
+		text := s.Text()
+		links := linkRe.FindAllString(text, -1)
+		if len(links) > maxLinks {
+			return &Rejection{Code: CodeTooManyLinks, Reason: "too many links", Spam: true}
+		}
+		if len(links) > 0 && strings.TrimSpace(linkRe.ReplaceAllString(text, "")) == "" {
+			return &Rejection{Code: CodeLinkOnly, Reason: "quote cannot be only links", Spam: true}
+		}
+		return nil
+	})
+}
+
+// BannedWordsFilter rejects submissions containing any of words as a whole
+// word, case-insensitively.
+func BannedWordsFilter(words []string) Filter {
+	banned := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			banned[w] = struct{}{}
+		}
+	}
+	return FilterFunc(func(_ context.Context, s *Submission) error {
+		for _, w := range tokenize(s.Text()) {
+			if _, ok := banned[w]; ok {
+				return &Rejection{Code: CodeBannedWord, Reason: "quote contains a banned word", Spam: true}
+			}
+		}
+		return nil
+	})
+}
+
+// RateLimitFilter rejects submissions from an address that already had
+// limit submissions accepted in the last period. Submissions without an
+// address aren't limited.
+func RateLimitFilter(limit int, period time.Duration) Filter {
+	return &rateLimitFilter{limit: limit, period: period, now: time.Now, accepted: map[string][]time.Time{}}
+}
+
+type rateLimitFilter struct {
+	limit  int
+	period time.Duration
+	now    func() time.Time
+
+	mu sync.Mutex
+	// accepted holds the times of the submissions accepted from each
+	// address in the last period, oldest first.
+	accepted map[string][]time.Time
+}
+
+func (f *rateLimitFilter) Check(_ context.Context, s *Submission) error {
+	if s.IP == "" {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.recent(s.IP)) >= f.limit {
+		return &Rejection{Code: CodeRateLimited, Reason: "too many submissions, please try again later"}
+	}
+	return nil
+}
+
+func (f *rateLimitFilter) Accept(_ context.Context, s *Submission) error {
+	if s.IP == "" {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.recent(s.IP)) >= f.limit {
+		return &Rejection{Code: CodeRateLimited, Reason: "too many submissions, please try again later"}
+	}
+	f.accepted[s.IP] = append(f.accepted[s.IP], f.now())
+	return nil
+}
+
+// recent drops the submissions from ip older than the period, and every
+// address left without any, and returns the rest.
+func (f *rateLimitFilter) recent(ip string) []time.Time {
+	cutoff := f.now().Add(-f.period)
+	for addr, times := range f.accepted {
+		i := 0
+		for i < len(times) && !times[i].After(cutoff) {
+			i++
+		}
+		if i == len(times) {
+			delete(f.accepted, addr)
+		} else {
+			f.accepted[addr] = times[i:]
+		}
+	}
+	return f.accepted[ip]
+}
+
+// Normalize lowercases s and drops punctuation and line breaks so that
+// trivially different copies compare equal.
+func Normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case !space && b.Len() > 0:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func tokenize(s string) []string {
+	return strings.Fields(Normalize(s))
+}
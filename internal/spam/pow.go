@@ -0,0 +1,122 @@
+package spam
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProofOfWork issues signed challenges that the form solves in the browser
+// (see static/pow.js) by finding a nonce such that
+// sha256(challenge + nonce) starts with difficulty zero bits. Challenges
+// expire after ttl and can be redeemed only once: Accept redeems them, so
+// one sent with a submission that another filter rejects can be sent again.
+type ProofOfWork struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func NewProofOfWork(difficulty int, ttl time.Duration) (*ProofOfWork, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("rand.Read(): %w", err)
+	}
+	return &ProofOfWork{
+		secret:     secret,
+		difficulty: difficulty,
+		ttl:        ttl,
+		now:        time.Now,
+		used:       map[string]time.Time{},
+	}, nil
+}
+
+func (p *ProofOfWork) Difficulty() int {
+	return p.difficulty
+}
+
+func (p *ProofOfWork) NewChallenge() (string, error) {
+	payload := make([]byte, 24)
+	binary.BigEndian.PutUint64(payload, uint64(p.now().Unix()))
+	if _, err := rand.Read(payload[8:]); err != nil {
+		return "", fmt.Errorf("rand.Read(): %w", err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + p.sign(enc), nil
+}
+
+func (p *ProofOfWork) Check(_ context.Context, s *Submission) error {
+	reject := func(reason string) error {
+		return &Rejection{Code: CodeProofOfWork, Reason: reason}
+	}
+	enc, sig, ok := strings.Cut(s.Challenge, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(p.sign(enc))) {
+		return reject("missing or invalid challenge, please reload the page")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil || len(payload) != 24 {
+		return reject("missing or invalid challenge, please reload the page")
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	now := p.now()
+	if now.Sub(issued) > p.ttl {
+		return reject("challenge expired, please reload the page")
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(s.Challenge+s.Nonce))) < p.difficulty {
+		return reject("proof of work not solved")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, dup := p.used[s.Challenge]; dup {
+		return reject("challenge already used, please reload the page")
+	}
+	return nil
+}
+
+// Accept redeems the challenge of a submission that every filter passed.
+// Of two submissions racing with the same challenge, only one is accepted.
+func (p *ProofOfWork) Accept(_ context.Context, s *Submission) error {
+	now := p.now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c, exp := range p.used {
+		if now.After(exp) {
+			delete(p.used, c)
+		}
+	}
+	if _, dup := p.used[s.Challenge]; dup {
+		return &Rejection{Code: CodeProofOfWork, Reason: "challenge already used, please reload the page"}
+	}
+	p.used[s.Challenge] = now.Add(p.ttl)
+	return nil
+}
+
+func (p *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package spam
+
+import (
+	"context"
+	"errors"
+)
+
+// Code identifies why a submission was rejected. Codes are stable so they can
+// be grepped for in logs and counted.
+type Code string
+
+const (
+	CodeTooShort     Code = "too_short"
+	CodeTooLong      Code = "too_long"
+	CodeTooManyLinks Code = "too_many_links"
+	CodeLinkOnly     Code = "link_only"
+	CodeBannedWord   Code = "banned_word"
+	CodeClassifier   Code = "classifier"
+	CodeProofOfWork  Code = "proof_of_work"
+	CodeRateLimited  Code = "rate_limited"
+)
+
+// Submission is a quote as submitted through the form, before it is stored.
+type Submission struct {
+	Quote     string
+	Comment   string
+	IP        string
+	Challenge string
+	Nonce     string
+}
+
+// Text returns the submitted text the content filters look at.
+func (s *Submission) Text() string {
+	if s.Comment == "" {
+		return s.Quote
+	}
+	return s.Quote + "\n" + s.Comment
+}
+
+// Rejection is returned by filters when a submission must not be stored.
+type Rejection struct {
+	Code   Code
+	Reason string
+	// Spam marks rejections caused by the content itself, which are used
+	// to train the classifier.
+	Spam bool
+}
+
+func (r *Rejection) Error() string {
+	return string(r.Code) + ": " + r.Reason
+}
+
+// AsRejection reports whether err is, or wraps, a *Rejection.
+func AsRejection(err error) (*Rejection, bool) {
+	var rej *Rejection
+	ok := errors.As(err, &rej)
+	return rej, ok
+}
+
+// Filter inspects a submission and returns a *Rejection when it must not be
+// stored, or another error if the check itself failed.
+type Filter interface {
+	Check(ctx context.Context, s *Submission) error
+}
+
+type FilterFunc func(ctx context.Context, s *Submission) error
+
+func (f FilterFunc) Check(ctx context.Context, s *Submission) error {
+	return f(ctx, s)
+}
+
+// Accepter is implemented by filters that keep track of the submissions
+// they let through, such as the challenges already redeemed. Callers call
+// Accept once a submission has passed every check and is about to be
+// stored, so that nothing is recorded for one that is refused.
+type Accepter interface {
+	Accept(ctx context.Context, s *Submission) error
+}
+
+// Learner is implemented by filters that learn from the submissions that
+// were stored.
+type Learner interface {
+	Stored(s *Submission)
+}
+
+// Pipeline runs filters in order and stops at the first rejection. When a
+// classifier is attached it learns content rejections as spam and, once
+// they are stored, accepted submissions as ham.
+type Pipeline struct {
+	filters    []Filter
+	classifier *Classifier
+}
+
+func NewPipeline(classifier *Classifier, filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters, classifier: classifier}
+}
+
+func (p *Pipeline) Check(ctx context.Context, s *Submission) error {
+	for _, f := range p.filters {
+		if err := f.Check(ctx, s); err != nil {
+			if rej, ok := AsRejection(err); ok && rej.Spam && rej.Code != CodeClassifier {
+				p.train(s, true)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Accept lets the filters that keep track of submissions record s.
+func (p *Pipeline) Accept(ctx context.Context, s *Submission) error {
+	for _, f := range p.filters {
+		if a, ok := f.(Accepter); ok {
+			if err := a.Accept(ctx, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stored trains the classifier on s as ham.
+func (p *Pipeline) Stored(s *Submission) {
+	p.train(s, false)
+}
+
+func (p *Pipeline) train(s *Submission, spam bool) {
+	if p.classifier != nil {
+		p.classifier.Train(s.Text(), spam)
+	}
+}
@@ -0,0 +1,164 @@
+package spam
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline(nil,
+		LengthFilter(3, 50),
+		LinkFilter(1),
+		BannedWordsFilter([]string{"casino"}),
+	)
+	tests := []struct {
+		quote string
+		want  Code
+	}{
+		{"  ", CodeTooShort},
+		{strings.Repeat("a", 51), CodeTooLong},
+		{"see http://a.example and www.b.example", CodeTooManyLinks},
+		{"https://a.example", CodeLinkOnly},
+		{"best Casino in town", CodeBannedWord},
+		{"<nick> something new entirely", ""},
+	}
+	for _, tt := range tests {
+		err := p.Check(context.Background(), &Submission{Quote: tt.quote})
+		var got Code
+		if rej, ok := AsRejection(err); ok {
+			got = rej.Code
+		} else if err != nil {
+			t.Fatalf("Check(%q) unexpected error: %v", tt.quote, err)
+		}
+		if got != tt.want {
+			t.Errorf("Check(%q) = %q; want %q", tt.quote, got, tt.want)
+		}
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	c, err := NewClassifier("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.SpamProbability("cheap pills online"); p != 0 {
+		t.Errorf("untrained SpamProbability = %v; want 0", p)
+	}
+	c.Train("cheap pills online now", true)
+	c.Train("buy cheap pills", true)
+	c.Train("<ali> who broke the build again", false)
+	c.Train("<veli> the build is fine, you broke it", false)
+	if p := c.SpamProbability("cheap pills"); p < 0.5 {
+		t.Errorf("SpamProbability(spammy) = %v; want >= 0.5", p)
+	}
+	if p := c.SpamProbability("who broke the build"); p >= 0.5 {
+		t.Errorf("SpamProbability(hammy) = %v; want < 0.5", p)
+	}
+}
+
+func TestRateLimitFilter(t *testing.T) {
+	now := time.Now()
+	f := RateLimitFilter(2, time.Hour).(*rateLimitFilter)
+	f.now = func() time.Time { return now }
+	p := NewPipeline(nil, f, BannedWordsFilter([]string{"casino"}))
+	check := func(ip, quote string) Code {
+		sub := &Submission{Quote: quote, IP: ip}
+		err := p.Check(context.Background(), sub)
+		if err == nil {
+			err = p.Accept(context.Background(), sub)
+		}
+		rej, _ := AsRejection(err)
+		if rej == nil {
+			return ""
+		}
+		return rej.Code
+	}
+
+	// Rejected submissions don't count.
+	for _, q := range []string{"casino", "one", "two", "casino"} {
+		check("192.0.2.0/24", q)
+	}
+	if got := check("192.0.2.0/24", "three"); got != CodeRateLimited {
+		t.Errorf("third accepted submission = %q; want %q", got, CodeRateLimited)
+	}
+	if got := check("198.51.100.0/24", "one"); got != "" {
+		t.Errorf("submission from another address = %q; want accepted", got)
+	}
+	now = now.Add(time.Hour)
+	if got := check("192.0.2.0/24", "three"); got != "" {
+		t.Errorf("submission an hour later = %q; want accepted", got)
+	}
+}
+
+func TestClassifierSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.json")
+	c, err := NewClassifier(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Train("cheap pills", true)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("model written by Train: %v", err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewClassifier(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.model.SpamDocs != 1 {
+		t.Errorf("saved model has %d spam docs; want 1", loaded.model.SpamDocs)
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	p, err := NewProofOfWork(8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := p.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := 0
+	for leadingZeroBits(sha256.Sum256([]byte(challenge+strconv.Itoa(nonce)))) < 8 {
+		nonce++
+	}
+	sub := &Submission{Quote: "casino", Challenge: challenge, Nonce: strconv.Itoa(nonce)}
+	pipeline := NewPipeline(nil, p, BannedWordsFilter([]string{"casino"}))
+	if err := pipeline.Check(context.Background(), sub); err == nil {
+		t.Fatal("Check(banned) = nil; want rejection")
+	}
+	sub.Quote = "fixed"
+	if err := pipeline.Check(context.Background(), sub); err != nil {
+		t.Fatalf("Check(resubmitted after a rejection) = %v; want nil", err)
+	}
+	if err := pipeline.Check(context.Background(), sub); err != nil {
+		t.Fatalf("Check(checked again before being accepted) = %v; want nil", err)
+	}
+	if err := pipeline.Accept(context.Background(), sub); err != nil {
+		t.Fatalf("Accept() = %v", err)
+	}
+	if err := pipeline.Check(context.Background(), sub); err == nil {
+		t.Error("Check(replayed) = nil; want rejection")
+	}
+	if err := pipeline.Accept(context.Background(), sub); err == nil {
+		t.Error("Accept(replayed) = nil; want rejection")
+	}
+	if err := p.Check(context.Background(), &Submission{Challenge: challenge + "x", Nonce: "1"}); err == nil {
+		t.Error("Check(tampered) = nil; want rejection")
+	}
+
+	expired, _ := p.NewChallenge()
+	p.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := p.Check(context.Background(), &Submission{Challenge: expired}); err == nil {
+		t.Error("Check(expired) = nil; want rejection")
+	}
+}
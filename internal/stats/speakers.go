@@ -0,0 +1,39 @@
+package stats
+
+import (
+	"regexp"
+	"strings"
+)
+
+// nickPattern follows the RFC 2812 nickname syntax, loosened on length.
+const nickPattern = "[A-Za-z_\\[\\]\\\\^{|}`][\\w\\[\\]\\\\^{|}`-]{0,31}"
+
+// speakerRe matches the speaker at the start of an IRC log line, after an
+// optional timestamp: "<nick> text", "<@nick> text" or "* nick action".
+var speakerRe = regexp.MustCompile(
+	`^\s*(?:\[?\d{1,2}:\d{2}(?::\d{2})?\]?\s*)?` +
+		`(?:<[~&@%+ ]?(` + nickPattern + `)>|\*\s+(` + nickPattern + `)\s)`,
+)
+
+// Speakers returns the distinct IRC nicks that speak in a quote, in order
+// of appearance. Nicks are compared case-insensitively and reported as
+// first written.
+func Speakers(quote string) []string {
+	var nicks []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(quote, "\n") {
+		m := speakerRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		nick := m[1]
+		if nick == "" {
+			nick = m[2]
+		}
+		if key := strings.ToLower(nick); !seen[key] {
+			seen[key] = true
+			nicks = append(nicks, nick)
+		}
+	}
+	return nicks
+}
@@ -0,0 +1,194 @@
+// Package stats computes the archive statistics shown on /stats and caches
+// them, since they only change slowly.
+package stats
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+const (
+	voteBucketWidth = 5
+	topQuotes       = 5
+	topSpeakers     = 10
+)
+
+// Service returns cached statistics, recomputing them when they are older
+// than the TTL. A TTL of zero disables caching. The top speakers take a
+// scan of every quote, so they are counted once and then only by
+// RefreshSpeakers.
+type Service struct {
+	repo domain.StatsRepository
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu       sync.Mutex
+	cached   *domain.Stats
+	flight   *flight
+	speakers []domain.SpeakerCount
+	counted  bool
+}
+
+// flight is a computation of the statistics that callers wait for.
+type flight struct {
+	done chan struct{}
+	st   *domain.Stats
+	err  error
+}
+
+func NewService(repo domain.StatsRepository, ttl time.Duration) *Service {
+	return &Service{repo: repo, ttl: ttl, now: time.Now}
+}
+
+// Get returns the statistics. Concurrent callers wait for a single
+// computation instead of each running the queries, and it goes on when
+// they give up. While the database is unavailable, the last statistics are
+// returned however old they are.
+func (s *Service) Get(ctx context.Context) (*domain.Stats, error) {
+	s.mu.Lock()
+	if s.cached != nil && s.now().Sub(s.cached.GeneratedAt) < s.ttl {
+		defer s.mu.Unlock()
+		return s.cached, nil
+	}
+	f := s.flight
+	if f == nil {
+		f = &flight{done: make(chan struct{})}
+		s.flight = f
+		go s.load(context.WithoutCancel(ctx), f)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.st, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load computes the statistics for the callers waiting on f.
+func (s *Service) load(ctx context.Context, f *flight) {
+	st, err := s.compute(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case err == nil:
+		s.cached = st
+	case s.cached != nil && errors.Is(err, domain.ErrUnavailable):
+		st, err = s.cached, nil
+	}
+	s.flight = nil
+	f.st, f.err = st, err
+	close(f.done)
+}
+
+// Refresh recomputes the statistics ahead of the requests that would
+// otherwise wait for them.
+func (s *Service) Refresh(ctx context.Context) error {
+	st, err := s.compute(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached = st
+	return nil
+}
+
+// RefreshSpeakers counts the speakers of every quote again. It is a job,
+// run far less often than Refresh.
+func (s *Service) RefreshSpeakers(ctx context.Context) error {
+	speakers, err := s.countSpeakers(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speakers, s.counted = speakers, true
+	if s.cached != nil {
+		st := *s.cached
+		st.TopSpeakers = speakers
+		s.cached = &st
+	}
+	return nil
+}
+
+func (s *Service) compute(ctx context.Context) (*domain.Stats, error) {
+	st := &domain.Stats{GeneratedAt: s.now()}
+	var err error
+	if st.Total, st.TotalVotes, err = s.repo.Totals(ctx); err != nil {
+		return nil, err
+	}
+	if st.ByMonth, err = s.repo.CountPerMonth(ctx); err != nil {
+		return nil, err
+	}
+	if st.Votes, err = s.repo.VoteDistribution(ctx, voteBucketWidth); err != nil {
+		return nil, err
+	}
+	if st.MostVoted, err = s.repo.MostVoted(ctx, topQuotes); err != nil {
+		return nil, err
+	}
+	if st.MostControversial, err = s.repo.MostControversial(ctx, topQuotes); err != nil {
+		return nil, err
+	}
+	activity, err := s.repo.Activity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range activity {
+		if a.Weekday >= 0 && a.Weekday < 7 && a.Hour >= 0 && a.Hour < 24 {
+			st.Activity[a.Weekday][a.Hour] += a.Count
+		}
+	}
+
+	s.mu.Lock()
+	counted := s.counted
+	s.mu.Unlock()
+	if !counted {
+		if err := s.RefreshSpeakers(ctx); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.TopSpeakers = s.speakers
+	return st, nil
+}
+
+// countSpeakers returns the top speakers of all the quotes.
+func (s *Service) countSpeakers(ctx context.Context) ([]domain.SpeakerCount, error) {
+	speakers := make(map[string]int)
+	err := s.repo.EachText(ctx, func(text string) error {
+		for _, nick := range Speakers(text) {
+			speakers[nick]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return top(speakers, topSpeakers), nil
+}
+
+// top returns the n most frequent speakers, ties broken by nick.
+func top(counts map[string]int, n int) []domain.SpeakerCount {
+	list := make([]domain.SpeakerCount, 0, len(counts))
+	for nick, c := range counts {
+		list = append(list, domain.SpeakerCount{Nick: nick, Count: c})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Nick < list[j].Nick
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
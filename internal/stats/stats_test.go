@@ -0,0 +1,155 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hionay/quotes/internal/domain"
+)
+
+func TestSpeakers(t *testing.T) {
+	tests := []struct {
+		quote string
+		want  []string
+	}{
+		{"just some text", nil},
+		{"<alice> hi\n<bob> hello\n<alice> bye", []string{"alice", "bob"}},
+		{"<alice> hi\n<Bob> too", []string{"alice", "Bob"}},
+		{"[12:34] <@op> kicked\n[12:35:01] <+voice> ouch", []string{"op", "voice"}},
+		{"* carol waves\n<CAROL> hi", []string{"carol"}},
+		{"a < b > c", nil},
+	}
+	for _, tt := range tests {
+		if got := Speakers(tt.quote); !slices.Equal(got, tt.want) {
+			t.Errorf("Speakers(%q) = %q; want %q", tt.quote, got, tt.want)
+		}
+	}
+}
+
+type fakeRepo struct {
+	calls, scans int
+	err          error
+	// block, if set, holds Totals until it is closed.
+	block chan struct{}
+}
+
+func (f *fakeRepo) Totals(context.Context) (int, int, error) {
+	if f.block != nil {
+		<-f.block
+	}
+	f.calls++
+	return 3, 7, f.err
+}
+func (f *fakeRepo) CountPerMonth(context.Context) ([]domain.PeriodCount, error) {
+	return []domain.PeriodCount{{Year: 2006, Month: time.May, Count: 3}}, nil
+}
+func (f *fakeRepo) VoteDistribution(context.Context, int) ([]domain.VoteBucket, error) {
+	return nil, nil
+}
+func (f *fakeRepo) MostVoted(context.Context, int) ([]*domain.Quote, error) {
+	return nil, nil
+}
+func (f *fakeRepo) MostControversial(context.Context, int) ([]*domain.Quote, error) {
+	return nil, nil
+}
+func (f *fakeRepo) Activity(context.Context) ([]domain.ActivityCount, error) {
+	return []domain.ActivityCount{{Weekday: time.Monday, Hour: 13, Count: 2}, {Weekday: 9, Hour: 1, Count: 1}}, nil
+}
+func (f *fakeRepo) EachText(_ context.Context, fn func(string) error) error {
+	f.scans++
+	for _, q := range []string{"<a> x\n<b> y", "<b> z", "<c> w"} {
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestServiceCaches(t *testing.T) {
+	repo := &fakeRepo{}
+	s := NewService(repo, time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	st, err := s.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if st.Total != 3 || st.TotalVotes != 7 || st.Activity[time.Monday][13] != 2 {
+		t.Errorf("Get() = %+v; unexpected totals or activity", st)
+	}
+	want := []domain.SpeakerCount{{Nick: "b", Count: 2}, {Nick: "a", Count: 1}, {Nick: "c", Count: 1}}
+	if !slices.Equal(st.TopSpeakers, want) {
+		t.Errorf("TopSpeakers = %v; want %v", st.TopSpeakers, want)
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, err := s.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if repo.calls != 1 {
+		t.Errorf("repository queried %d times within the TTL; want 1", repo.calls)
+	}
+	now = now.Add(time.Minute)
+	if _, err := s.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if repo.calls != 2 {
+		t.Errorf("repository queried %d times after the TTL; want 2", repo.calls)
+	}
+	if repo.scans != 1 {
+		t.Errorf("quotes scanned for speakers %d times; want once", repo.scans)
+	}
+	if err := s.RefreshSpeakers(context.Background()); err != nil || repo.scans != 2 {
+		t.Errorf("RefreshSpeakers() = %v after %d scans; want a second scan", err, repo.scans)
+	}
+
+	now = now.Add(time.Hour)
+	repo.err = fmt.Errorf("totals: %w", domain.ErrUnavailable)
+	if st, err := s.Get(context.Background()); err != nil || st.Total != 3 {
+		t.Errorf("Get() with the database down = %v, %v; want the old statistics", st, err)
+	}
+}
+
+func TestServiceComputesOnce(t *testing.T) {
+	repo := &fakeRepo{block: make(chan struct{})}
+	s := NewService(repo, time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Get(context.Background())
+			errs <- err
+		}()
+	}
+	for computing := false; !computing; {
+		s.mu.Lock()
+		computing = s.flight != nil
+		s.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Get(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() with a cancelled context = %v while computing; want it to give up", err)
+	}
+	close(repo.block)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Get() error: %v", err)
+		}
+	}
+	if repo.calls != 1 {
+		t.Errorf("statistics computed %d times for concurrent callers; want 1", repo.calls)
+	}
+}
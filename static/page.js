@@ -0,0 +1,38 @@
+// Small behaviours of the page: reply buttons in discussion threads, and
+// clearing the error banner.
+(function () {
+  // Reply buttons of discussion threads point the comment form at the
+  // comment they belong to.
+  document.addEventListener('click', function (evt) {
+    const target = evt.target;
+    if (!(target instanceof Element)) {
+      return;
+    }
+    const reply = target.closest('[data-reply-to]');
+    const cancel = target.closest('[data-reply-cancel]');
+    if (!reply && !cancel) {
+      return;
+    }
+    const section = target.closest('#comments');
+    const form = section && section.querySelector('form');
+    if (!form) {
+      return;
+    }
+    const label = form.querySelector('[data-reply-label]');
+    form.elements.parent_id.value = reply ? reply.dataset.replyTo : '';
+    label.querySelector('span').textContent = reply ? reply.dataset.replyAuthor : '';
+    label.hidden = !reply;
+    if (reply) {
+      form.elements.body.focus();
+    }
+  });
+
+  // Error responses are swapped into #error-banner; clear it once a later
+  // request succeeds.
+  document.addEventListener('htmx:afterRequest', function (evt) {
+    const banner = document.getElementById('error-banner');
+    if (banner && evt.detail.successful) {
+      banner.replaceChildren();
+    }
+  });
+})();
@@ -0,0 +1,51 @@
+// Solves the proof-of-work challenge of forms marked with data-pow before
+// htmx sends them: fetches a fresh challenge, which can be used only once,
+// and finds a nonce such that SHA-256(challenge + nonce) starts with the
+// requested number of zero bits.
+(function () {
+  const encoder = new TextEncoder();
+
+  function leadingZeroBits(bytes) {
+    let n = 0;
+    for (const b of bytes) {
+      if (b === 0) {
+        n += 8;
+        continue;
+      }
+      return n + Math.clz32(b) - 24;
+    }
+    return n;
+  }
+
+  async function solve(challenge, bits) {
+    for (let nonce = 0; ; nonce++) {
+      const digest = await crypto.subtle.digest('SHA-256', encoder.encode(challenge + nonce));
+      if (leadingZeroBits(new Uint8Array(digest)) >= bits) {
+        return String(nonce);
+      }
+    }
+  }
+
+  document.addEventListener('htmx:confirm', async function (evt) {
+    const form = evt.detail.elt;
+    if (!form.matches || !form.matches('form[data-pow]')) {
+      return;
+    }
+    evt.preventDefault();
+    const button = form.querySelector('button[type=submit]');
+    button.disabled = true;
+    try {
+      const bits = parseInt(form.dataset.pow, 10);
+      const res = await fetch('/pow', { cache: 'no-store' });
+      if (!res.ok) {
+        throw new Error('fetching challenge: ' + res.status);
+      }
+      const challenge = await res.text();
+      form.elements.pow_challenge.value = challenge;
+      form.elements.pow_nonce.value = await solve(challenge, bits);
+      evt.detail.issueRequest(true);
+    } finally {
+      button.disabled = false;
+    }
+  });
+})();